@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"sck-pos-backend/internal/loyalty"
+	"sck-pos-backend/internal/phone"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// runCommand dispatches a maintenance command given on the command line
+func runCommand(db *sql.DB, name string, args []string) error {
+	switch name {
+	case "loyalty-ledger":
+		return runLoyaltyLedger(db, args)
+	case "customer-phones":
+		return runCustomerPhones(db)
+	default:
+		return fmt.Errorf("unknown command %q", name)
+	}
+}
+
+// runLoyaltyLedger checks the loyalty ledger and optionally repairs it
+//
+//	go run . loyalty-ledger          # report mismatches only
+//	go run . loyalty-ledger -repair  # report and repair
+func runLoyaltyLedger(db *sql.DB, args []string) error {
+	flags := flag.NewFlagSet("loyalty-ledger", flag.ContinueOnError)
+	repair := flags.Bool("repair", false, "commit repairs instead of a dry run")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	report, err := loyalty.ReconcileLedger(context.Background(), db, !*repair)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// runCustomerPhones fills customers.phone_normalized for customers saved before
+// phone numbers were normalized
+//
+//	go run . customer-phones
+func runCustomerPhones(db *sql.DB) error {
+	rows, err := db.Query("SELECT id, phone FROM customers WHERE phone IS NOT NULL AND phone_normalized IS NULL")
+	if err != nil {
+		return err
+	}
+	phones := map[int]string{}
+	for rows.Next() {
+		var id int
+		var raw string
+		if err := rows.Scan(&id, &raw); err != nil {
+			rows.Close()
+			return err
+		}
+		phones[id] = raw
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	updated, unrecognized, taken := 0, 0, 0
+	for id, raw := range phones {
+		normalized := phone.Normalize(raw)
+		if normalized == "" {
+			unrecognized++
+			continue
+		}
+		_, err := db.Exec("UPDATE customers SET phone_normalized = ? WHERE id = ?", normalized, id)
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+			// Another active customer has the number; merge them to fill it
+			taken++
+			continue
+		} else if err != nil {
+			return err
+		}
+		updated++
+	}
+
+	fmt.Printf("Normalized %d phone numbers; %d were not recognized; %d belong to another active customer\n", updated, unrecognized, taken)
+	return nil
+}
@@ -2,11 +2,14 @@ package api
 
 import (
 	"database/sql"
+	"log"
 	"net/http"
 
 	"sck-pos-backend/internal/config"
 	"sck-pos-backend/internal/handlers"
+	"sck-pos-backend/internal/jwtkeys"
 	"sck-pos-backend/internal/middleware"
+	"sck-pos-backend/internal/password"
 
 	"github.com/gin-gonic/gin"
 )
@@ -28,104 +31,257 @@ func SetupRouter(db *sql.DB, cfg *config.Config) *gin.Engine {
 		})
 	})
 
+	keys, err := jwtkeys.Load(jwtkeys.Options{
+		SigningKeyFile:   cfg.JWTSigningKeyFile,
+		SigningKeyID:     cfg.JWTSigningKeyID,
+		VerificationKeys: cfg.JWTVerificationKeys,
+		HMACSecret:       cfg.JWTSecret,
+	})
+	if err != nil {
+		log.Fatal("Failed to load JWT keys:", err)
+	}
+
+	passwords, err := password.NewPolicy(
+		cfg.PasswordMinLength, cfg.PasswordMinClasses, cfg.PasswordHistory, cfg.PasswordBreachedList,
+	)
+	if err != nil {
+		log.Fatal("Failed to load password policy:", err)
+	}
+
+	authHandler := handlers.NewAuthHandler(db, cfg, keys, passwords)
+
+	// Public keys for verifying access tokens
+	router.GET("/.well-known/jwks.json", authHandler.GetJWKS)
+
 	// API v1 routes
 	v1 := router.Group("/api/v1")
 	{
 		// Authentication routes
 		auth := v1.Group("/auth")
 		{
-			authHandler := handlers.NewAuthHandler(db, cfg.JWTSecret)
 			auth.POST("/login", authHandler.Login)
-			auth.POST("/register", authHandler.Register)
+			auth.POST("/register", middleware.AuditTrail(db), authHandler.Register)
+			auth.POST("/refresh", authHandler.Refresh)
+			auth.POST("/pin-login", authHandler.PinLogin)
+			auth.PUT("/pin", middleware.AuthRequired(db, keys), middleware.AuditTrail(db), authHandler.SetPin)
+			auth.POST("/change-password", middleware.AuthRequired(db, keys), middleware.AuditTrail(db), authHandler.ChangePassword)
+
+			// Two-factor authentication; reachable before enrollment so admins can enroll
+			auth.POST("/2fa/verify", authHandler.VerifyMFA)
+			twoFactor := auth.Group("/2fa")
+			twoFactor.Use(middleware.AuthRequired(db, keys), middleware.AuditTrail(db))
+			{
+				twoFactor.GET("", authHandler.GetMFAStatus)
+				twoFactor.POST("/setup", authHandler.SetupMFA)
+				twoFactor.POST("/enable", authHandler.EnableMFA)
+				twoFactor.POST("/disable", authHandler.DisableMFA)
+				twoFactor.POST("/recovery-codes", authHandler.RegenerateRecoveryCodes)
+			}
+			auth.POST("/logout", middleware.AuthRequired(db, keys), middleware.AuditTrail(db), authHandler.Logout)
+		}
+
+		// Protected routes; each route declares the permission it requires
+		can := func(perm middleware.Permission) gin.HandlerFunc {
+			return middleware.RequirePermission(db, perm)
 		}
 
-		// Protected routes
+		// Every mutating request is written to the audit trail, and POSTs with an
+		// Idempotency-Key header are safe to retry
 		protected := v1.Group("/")
-		protected.Use(middleware.AuthRequired(cfg.JWTSecret))
+		protected.Use(middleware.AuthRequired(db, keys), middleware.AuditTrail(db), middleware.Idempotency(db, cfg.IdempotencyKeyTTL))
 		{
 			// User routes
 			users := protected.Group("/users")
 			{
-				userHandler := handlers.NewUserHandler(db)
-				users.GET("", userHandler.GetUsers)
-				users.POST("", userHandler.CreateUser)
-				users.GET("/:id", userHandler.GetUser)
-				users.PUT("/:id", userHandler.UpdateUser)
-				users.DELETE("/:id", userHandler.DeleteUser)
+				userHandler := handlers.NewUserHandler(db, passwords)
+				users.GET("", can(middleware.PermUsersRead), userHandler.GetUsers)
+				users.POST("", can(middleware.PermUsersManage), userHandler.CreateUser)
+				users.GET("/:id", can(middleware.PermUsersRead), userHandler.GetUser)
+				users.PUT("/:id", can(middleware.PermUsersManage), userHandler.UpdateUser)
+				users.DELETE("/:id", can(middleware.PermUsersManage), userHandler.DeleteUser)
+				users.POST("/:id/reset-password", can(middleware.PermUsersManage), userHandler.ResetPassword)
+				users.POST("/:id/sessions/revoke", can(middleware.PermUsersManage), authHandler.RevokeUserSessions)
+				users.DELETE("/:id/pin", can(middleware.PermUsersManage), userHandler.ClearPin)
+				users.POST("/:id/unlock", can(middleware.PermUsersManage), authHandler.UnlockUser)
+				users.DELETE("/:id/2fa", can(middleware.PermUsersManage), authHandler.ResetUserMFA)
+				users.GET("/failed-logins", can(middleware.PermUsersManage), authHandler.GetFailedLogins)
+				users.GET("/invites", can(middleware.PermUsersManage), userHandler.GetInvites)
+				users.POST("/invites", can(middleware.PermUsersManage), userHandler.CreateInvite)
+				users.DELETE("/invites/:inviteId", can(middleware.PermUsersManage), userHandler.RevokeInvite)
 			}
 
 			// Product routes
 			products := protected.Group("/products")
 			{
 				productHandler := handlers.NewProductHandler(db)
-				products.GET("", productHandler.GetProducts)
-				products.POST("", productHandler.CreateProduct)
-				products.GET("/:id", productHandler.GetProduct)
-				products.PUT("/:id", productHandler.UpdateProduct)
-				products.DELETE("/:id", productHandler.DeleteProduct)
-				products.GET("/search", productHandler.SearchProducts)
+				products.GET("", can(middleware.PermProductsRead), productHandler.GetProducts)
+				products.POST("", can(middleware.PermProductsWrite), productHandler.CreateProduct)
+				products.GET("/:id", can(middleware.PermProductsRead), productHandler.GetProduct)
+				products.PUT("/:id", can(middleware.PermProductsWrite), productHandler.UpdateProduct)
+				products.DELETE("/:id", can(middleware.PermProductsWrite), productHandler.DeleteProduct)
+				products.GET("/search", can(middleware.PermProductsRead), productHandler.SearchProducts)
 			}
 
 			// Category routes
 			categories := protected.Group("/categories")
 			{
 				categoryHandler := handlers.NewCategoryHandler(db)
-				categories.GET("", categoryHandler.GetCategories)
-				categories.POST("", categoryHandler.CreateCategory)
-				categories.GET("/:id", categoryHandler.GetCategory)
-				categories.PUT("/:id", categoryHandler.UpdateCategory)
-				categories.DELETE("/:id", categoryHandler.DeleteCategory)
+				categories.GET("", can(middleware.PermCategoriesRead), categoryHandler.GetCategories)
+				categories.POST("", can(middleware.PermCategoriesWrite), categoryHandler.CreateCategory)
+				categories.GET("/:id", can(middleware.PermCategoriesRead), categoryHandler.GetCategory)
+				categories.PUT("/:id", can(middleware.PermCategoriesWrite), categoryHandler.UpdateCategory)
+				categories.DELETE("/:id", can(middleware.PermCategoriesWrite), categoryHandler.DeleteCategory)
 			}
 
 			// Customer routes
 			customers := protected.Group("/customers")
 			{
 				customerHandler := handlers.NewCustomerHandler(db)
-				customers.GET("", customerHandler.GetCustomers)
-				customers.POST("", customerHandler.CreateCustomer)
-				customers.GET("/:id", customerHandler.GetCustomer)
-				customers.PUT("/:id", customerHandler.UpdateCustomer)
-				customers.DELETE("/:id", customerHandler.DeleteCustomer)
+				customers.GET("", can(middleware.PermCustomersRead), customerHandler.GetCustomers)
+				customers.POST("", can(middleware.PermCustomersWrite), customerHandler.CreateCustomer)
+				customers.GET("/:id", can(middleware.PermCustomersRead), customerHandler.GetCustomer)
+				customers.GET("/:id/sales", can(middleware.PermCustomersRead), customerHandler.GetCustomerSales)
+				customers.PUT("/:id", can(middleware.PermCustomersWrite), customerHandler.UpdateCustomer)
+				customers.DELETE("/:id", can(middleware.PermCustomersDelete), customerHandler.DeleteCustomer)
+				customers.GET("/duplicates", can(middleware.PermCustomersMerge), customerHandler.GetDuplicateCustomers)
+				customers.POST("/:id/merge", can(middleware.PermCustomersMerge), customerHandler.MergeCustomer)
+				customers.GET("/:id/consents", can(middleware.PermCustomersRead), customerHandler.GetCustomerConsents)
+				customers.PUT("/:id/consents", can(middleware.PermCustomersWrite), customerHandler.UpdateCustomerConsents)
+				customers.POST("/:id/export", can(middleware.PermCustomersPrivacy), customerHandler.ExportCustomerData)
+				customers.POST("/:id/erase", can(middleware.PermCustomersPrivacy), customerHandler.EraseCustomer)
+				customers.PUT("/:id/group", can(middleware.PermCustomerGroups), customerHandler.SetCustomerGroup)
+				customers.GET("/:id/prices", can(middleware.PermCustomersRead), customerHandler.GetCustomerPrices)
 				
 				// Loyalty points sub-routes
 				loyaltyHandler := handlers.NewLoyaltyHandler(db)
-				customers.GET("/:id/loyalty/summary", loyaltyHandler.GetCustomerLoyaltySummary)
-				customers.GET("/:id/loyalty/transactions", loyaltyHandler.GetCustomerLoyaltyTransactions)
-				customers.GET("/:id/loyalty/balances", loyaltyHandler.GetCustomerLoyaltyBalances)
-				customers.GET("/:id/loyalty/available", loyaltyHandler.GetAvailableLoyaltyPoints)
+				customers.GET("/:id/loyalty/summary", can(middleware.PermLoyaltyRead), loyaltyHandler.GetCustomerLoyaltySummary)
+				customers.GET("/:id/loyalty/transactions", can(middleware.PermLoyaltyRead), loyaltyHandler.GetCustomerLoyaltyTransactions)
+				customers.GET("/:id/loyalty/balances", can(middleware.PermLoyaltyRead), loyaltyHandler.GetCustomerLoyaltyBalances)
+				customers.GET("/:id/loyalty/available", can(middleware.PermLoyaltyRead), loyaltyHandler.GetAvailableLoyaltyPoints)
+				customers.GET("/:id/loyalty/tier-history", can(middleware.PermLoyaltyRead), loyaltyHandler.GetCustomerTierHistory)
+				customers.POST("/:id/loyalty/adjustments", can(middleware.PermLoyaltyAdjust), loyaltyHandler.AdjustLoyaltyPoints)
+			}
+
+			// Customer group pricing routes
+			customerGroups := protected.Group("/customer-groups")
+			{
+				customerGroupHandler := handlers.NewCustomerGroupHandler(db)
+				customerGroups.GET("", can(middleware.PermCustomersRead), customerGroupHandler.GetCustomerGroups)
+				customerGroups.POST("", can(middleware.PermCustomerGroups), customerGroupHandler.CreateCustomerGroup)
+				customerGroups.PUT("/:id", can(middleware.PermCustomerGroups), customerGroupHandler.UpdateCustomerGroup)
+				customerGroups.GET("/:id/prices", can(middleware.PermCustomersRead), customerGroupHandler.GetCustomerGroupPrices)
+				customerGroups.PUT("/:id/prices", can(middleware.PermCustomerGroups), customerGroupHandler.SetCustomerGroupPrices)
+				customerGroups.DELETE("/:id/prices/:product_id", can(middleware.PermCustomerGroups), customerGroupHandler.DeleteCustomerGroupPrice)
+			}
+
+			// Customer segment routes
+			customerSegments := protected.Group("/customer-segments")
+			{
+				customerSegmentHandler := handlers.NewCustomerSegmentHandler(db)
+				customerSegments.GET("", can(middleware.PermCustomerGroups), customerSegmentHandler.GetCustomerSegments)
+				customerSegments.POST("", can(middleware.PermCustomerGroups), customerSegmentHandler.CreateCustomerSegment)
+				customerSegments.PUT("/:id", can(middleware.PermCustomerGroups), customerSegmentHandler.UpdateCustomerSegment)
+				customerSegments.GET("/:id/snapshots", can(middleware.PermCustomerGroups), customerSegmentHandler.GetSegmentSnapshots)
+				customerSegments.POST("/:id/snapshots", can(middleware.PermCustomerGroups), customerSegmentHandler.CreateSegmentSnapshot)
+				customerSegments.GET("/snapshots/:id", can(middleware.PermCustomerGroups), customerSegmentHandler.GetSegmentSnapshot)
 			}
 
 			// Loyalty points routes
 			loyalty := protected.Group("/loyalty")
 			{
 				loyaltyHandler := handlers.NewLoyaltyHandler(db)
-				loyalty.POST("/redeem", loyaltyHandler.RedeemLoyaltyPoints)
-				loyalty.GET("/calculate-points", loyaltyHandler.CalculatePointsEarned)
-				loyalty.GET("/calculate-value", loyaltyHandler.CalculatePointsValue)
-				loyalty.POST("/expire-points", loyaltyHandler.ExpireLoyaltyPoints)
+				loyalty.POST("/redeem", can(middleware.PermLoyaltyRedeem), loyaltyHandler.RedeemLoyaltyPoints)
+				loyalty.GET("/calculate-points", can(middleware.PermLoyaltyRead), loyaltyHandler.CalculatePointsEarned)
+				loyalty.GET("/calculate-value", can(middleware.PermLoyaltyRead), loyaltyHandler.CalculatePointsValue)
+				loyalty.POST("/expire-points", can(middleware.PermLoyaltyManage), loyaltyHandler.ExpireLoyaltyPoints)
+				loyalty.GET("/expiring", can(middleware.PermLoyaltyManage), loyaltyHandler.GetExpiringLoyaltyPoints)
+				loyalty.GET("/tiers", can(middleware.PermLoyaltyRead), loyaltyHandler.GetLoyaltyTiers)
+				loyalty.POST("/evaluate-tiers", can(middleware.PermLoyaltyManage), loyaltyHandler.EvaluateLoyaltyTiers)
+				loyalty.GET("/ledger/check", can(middleware.PermLoyaltyLedger), loyaltyHandler.CheckLoyaltyLedger)
+				loyalty.POST("/ledger/repair", can(middleware.PermLoyaltyLedger), loyaltyHandler.RepairLoyaltyLedger)
 			}
 
 			// Sales routes
 			sales := protected.Group("/sales")
 			{
-				salesHandler := handlers.NewSalesHandler(db)
-				sales.GET("", salesHandler.GetSales)
-				sales.POST("", salesHandler.CreateSale)
-				sales.GET("/:id", salesHandler.GetSale)
-				sales.POST("/:id/refund", salesHandler.RefundSale)
-				sales.GET("/reports/daily", salesHandler.GetDailyReport)
-				sales.GET("/reports/monthly", salesHandler.GetMonthlyReport)
+				salesHandler := handlers.NewSalesHandler(db, cfg.OverrideDiscountPercent)
+				sales.GET("", can(middleware.PermSalesRead), salesHandler.GetSales)
+				sales.POST("", can(middleware.PermSalesCreate), salesHandler.CreateSale)
+				sales.GET("/:id", can(middleware.PermSalesRead), salesHandler.GetSale)
+				// Cashiers can start these but need a manager override token
+				sales.POST("/:id/refund", can(middleware.PermSalesCreate), salesHandler.RefundSale)
+				sales.POST("/:id/void", can(middleware.PermSalesCreate), salesHandler.VoidSale)
+				sales.GET("/reports/daily", can(middleware.PermReportsRead), salesHandler.GetDailyReport)
+				sales.GET("/reports/monthly", can(middleware.PermReportsRead), salesHandler.GetMonthlyReport)
 			}
 
+			// Background job routes
+			jobs := protected.Group("/jobs")
+			{
+				jobHandler := handlers.NewJobHandler(db)
+				jobs.GET("/runs", can(middleware.PermJobsRead), jobHandler.GetJobRuns)
+			}
+
+			// Terminal routes
+			terminals := protected.Group("/terminals")
+			{
+				terminalHandler := handlers.NewTerminalHandler(db)
+				terminals.GET("", can(middleware.PermTerminalsManage), terminalHandler.GetTerminals)
+				terminals.POST("", can(middleware.PermTerminalsManage), terminalHandler.CreateTerminal)
+				terminals.GET("/:id", can(middleware.PermTerminalsManage), terminalHandler.GetTerminal)
+				terminals.PUT("/:id", can(middleware.PermTerminalsManage), terminalHandler.UpdateTerminal)
+				terminals.POST("/:id/disable", can(middleware.PermTerminalsManage), terminalHandler.DisableTerminal)
+				terminals.POST("/:id/enable", can(middleware.PermTerminalsManage), terminalHandler.EnableTerminal)
+				terminals.POST("/:id/secret", can(middleware.PermTerminalsManage), terminalHandler.RotateTerminalSecret)
+			}
+
+			// Shift and cash drawer routes; cashiers can only reach their own shifts
+			shifts := protected.Group("/shifts")
+			{
+				shiftHandler := handlers.NewShiftHandler(db)
+				shifts.POST("", can(middleware.PermShiftsOperate), shiftHandler.OpenShift)
+				shifts.GET("", can(middleware.PermShiftsManage), shiftHandler.GetShifts)
+				shifts.GET("/current", can(middleware.PermShiftsOperate), shiftHandler.GetCurrentShift)
+				shifts.GET("/:id", can(middleware.PermShiftsOperate), shiftHandler.GetShift)
+				shifts.GET("/:id/x-report", can(middleware.PermShiftsOperate), shiftHandler.GetXReport)
+				shifts.POST("/:id/cash-movements", can(middleware.PermShiftsOperate), shiftHandler.AddCashMovement)
+				shifts.POST("/:id/close", can(middleware.PermShiftsOperate), shiftHandler.CloseShift)
+				shifts.GET("/z-reports", can(middleware.PermShiftsManage), shiftHandler.GetZReports)
+				shifts.POST("/z-reports", can(middleware.PermShiftsManage), shiftHandler.CreateZReport)
+				shifts.GET("/z-reports/:id", can(middleware.PermShiftsManage), shiftHandler.GetZReport)
+			}
+
+			// Offline terminal sync routes
+			offlineSync := protected.Group("/sync")
+			{
+				syncHandler := handlers.NewSyncHandler(db, cfg.OverrideDiscountPercent)
+				offlineSync.POST("/sales", can(middleware.PermSalesCreate), syncHandler.SyncSales)
+				offlineSync.GET("/catalog", can(middleware.PermProductsRead), syncHandler.GetCatalogChanges)
+				offlineSync.GET("/conflicts", can(middleware.PermSyncConflicts), syncHandler.GetSyncConflicts)
+				offlineSync.POST("/conflicts/:id/resolve", can(middleware.PermSyncConflicts), syncHandler.ResolveSyncConflict)
+			}
+
+			// Audit trail routes
+			auditLogs := protected.Group("/audit")
+			{
+				auditHandler := handlers.NewAuditHandler(db)
+				auditLogs.GET("/logs", can(middleware.PermAuditRead), auditHandler.GetAuditLogs)
+				auditLogs.GET("/logs/:id", can(middleware.PermAuditRead), auditHandler.GetAuditLog)
+				auditLogs.GET("/verify", can(middleware.PermAuditRead), auditHandler.VerifyAuditLogs)
+			}
+
+			// Manager override routes; the approver's credentials are in the body
+			protected.POST("/overrides", can(middleware.PermSalesCreate), authHandler.ApproveOverride)
+
 			// Store routes
 			stores := protected.Group("/stores")
 			{
 				storeHandler := handlers.NewStoreHandler(db)
-				stores.GET("", storeHandler.GetStores)
-				stores.POST("", storeHandler.CreateStore)
-				stores.GET("/:id", storeHandler.GetStore)
-				stores.PUT("/:id", storeHandler.UpdateStore)
-				stores.DELETE("/:id", storeHandler.DeleteStore)
+				stores.GET("", can(middleware.PermStoresRead), storeHandler.GetStores)
+				stores.POST("", can(middleware.PermStoresManage), storeHandler.CreateStore)
+				stores.GET("/:id", can(middleware.PermStoresRead), storeHandler.GetStore)
+				stores.PUT("/:id", can(middleware.PermStoresManage), storeHandler.UpdateStore)
+				stores.DELETE("/:id", can(middleware.PermStoresManage), storeHandler.DeleteStore)
 			}
 		}
 	}
@@ -0,0 +1,175 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Outcomes recorded against an audit entry
+const (
+	OutcomeSuccess = "success"
+	OutcomeDenied  = "denied"
+	OutcomeFailure = "failure"
+)
+
+// Entry represents a single audited action
+type Entry struct {
+	UserID     *int
+	Username   string
+	Role       string
+	Action     string
+	Resource   string
+	EntityType string
+	EntityID   string
+	Outcome    string
+	StatusCode int
+	IPAddress  string
+	Details    string
+
+	// Before and After are marshalled to JSON; nil means not recorded
+	Before interface{}
+	After  interface{}
+}
+
+// record is an audit_logs row as it is hashed
+// Field order is part of the hash, so only append new fields.
+type record struct {
+	UserID     *int64
+	Username   *string
+	Role       *string
+	Action     string
+	Resource   *string
+	EntityType *string
+	EntityID   *string
+	Outcome    string
+	StatusCode *int64
+	IPAddress  *string
+	Details    *string
+	Before     *string
+	After      *string
+	CreatedAt  time.Time
+}
+
+// hash chains the record to the previous row's hash
+func (r record) hash(prevHash string) (string, error) {
+	payload, err := json.Marshal([]interface{}{
+		prevHash, r.UserID, r.Username, r.Role, r.Action, r.Resource, r.EntityType, r.EntityID,
+		r.Outcome, r.StatusCode, r.IPAddress, r.Details, r.Before, r.After,
+		r.CreatedAt.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Log appends an entry to the audit_logs table and the hash chain
+func Log(ctx context.Context, db *sql.DB, entry Entry) error {
+	rec, err := newRecord(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit log: %w", err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the chain head so concurrent writers link one after another
+	var prevHash string
+	if err := tx.QueryRowContext(ctx, "SELECT last_hash FROM audit_chain WHERE id = 1 FOR UPDATE").Scan(&prevHash); err != nil {
+		return fmt.Errorf("failed to read audit chain: %w", err)
+	}
+
+	hash, err := rec.hash(prevHash)
+	if err != nil {
+		return fmt.Errorf("failed to hash audit log: %w", err)
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO audit_logs (
+			user_id, username, role, action, resource, entity_type, entity_id, outcome,
+			status_code, ip_address, details, before_data, after_data, prev_hash, hash, created_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, rec.UserID, rec.Username, rec.Role, rec.Action, rec.Resource, rec.EntityType, rec.EntityID, rec.Outcome,
+		rec.StatusCode, rec.IPAddress, rec.Details, rec.Before, rec.After, prevHash, hash, rec.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+
+	logID, _ := result.LastInsertId()
+	if _, err := tx.ExecContext(ctx, "UPDATE audit_chain SET last_log_id = ?, last_hash = ? WHERE id = 1", logID, hash); err != nil {
+		return fmt.Errorf("failed to advance audit chain: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
+
+// newRecord converts an entry to its stored form
+func newRecord(entry Entry) (record, error) {
+	rec := record{
+		Username:   optional(entry.Username),
+		Role:       optional(entry.Role),
+		Action:     entry.Action,
+		Resource:   optional(entry.Resource),
+		EntityType: optional(entry.EntityType),
+		EntityID:   optional(entry.EntityID),
+		Outcome:    entry.Outcome,
+		IPAddress:  optional(entry.IPAddress),
+		Details:    optional(entry.Details),
+		// TIMESTAMP keeps whole seconds, so hash what will be stored
+		CreatedAt: time.Now().Truncate(time.Second),
+	}
+	if entry.UserID != nil {
+		id := int64(*entry.UserID)
+		rec.UserID = &id
+	}
+	if entry.StatusCode != 0 {
+		code := int64(entry.StatusCode)
+		rec.StatusCode = &code
+	}
+
+	var err error
+	if rec.Before, err = marshalOptional(entry.Before); err != nil {
+		return rec, err
+	}
+	if rec.After, err = marshalOptional(entry.After); err != nil {
+		return rec, err
+	}
+	return rec, nil
+}
+
+// optional maps an empty string to NULL
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// marshalOptional encodes v as JSON, or NULL when v is nil
+func marshalOptional(v interface{}) (*string, error) {
+	if v == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if string(data) == "null" {
+		return nil, nil
+	}
+	s := string(data)
+	return &s, nil
+}
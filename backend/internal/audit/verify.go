@@ -0,0 +1,131 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// genesisHash is the prev_hash of the first chained row
+var genesisHash = fmt.Sprintf("%064d", 0)
+
+// VerifyResult reports whether the audit chain is intact
+type VerifyResult struct {
+	Valid    bool   `json:"valid"`
+	Checked  int    `json:"checked"`
+	Skipped  int    `json:"skipped"` // rows logged before hashing was enabled
+	BrokenAt *int64 `json:"broken_at,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Verify recomputes the hash chain over every audit log and reports the first
+// row that was altered, removed or inserted out of order
+func Verify(ctx context.Context, db *sql.DB) (VerifyResult, error) {
+	var result VerifyResult
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, user_id, username, role, action, resource, entity_type, entity_id, outcome,
+			status_code, ip_address, details, before_data, after_data, prev_hash, hash, created_at
+		FROM audit_logs
+		ORDER BY id
+	`)
+	if err != nil {
+		return result, fmt.Errorf("failed to read audit logs: %w", err)
+	}
+	defer rows.Close()
+
+	chain := newChainVerifier()
+	for rows.Next() {
+		var id int64
+		var rec record
+		var prevHash, hash sql.NullString
+		err := rows.Scan(
+			&id, &rec.UserID, &rec.Username, &rec.Role, &rec.Action, &rec.Resource, &rec.EntityType,
+			&rec.EntityID, &rec.Outcome, &rec.StatusCode, &rec.IPAddress, &rec.Details,
+			&rec.Before, &rec.After, &prevHash, &hash, &rec.CreatedAt,
+		)
+		if err != nil {
+			return result, fmt.Errorf("failed to read audit logs: %w", err)
+		}
+
+		intact, err := chain.add(id, rec, prevHash, hash)
+		if err != nil {
+			return chain.result, err
+		}
+		if !intact {
+			return chain.result, nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return result, fmt.Errorf("failed to read audit logs: %w", err)
+	}
+
+	var headHash string
+	err = db.QueryRowContext(ctx, "SELECT last_hash FROM audit_chain WHERE id = 1").Scan(&headHash)
+	if err != nil {
+		return result, fmt.Errorf("failed to read audit chain: %w", err)
+	}
+	return chain.finish(headHash), nil
+}
+
+// chainVerifier checks audit rows one at a time, in id order
+type chainVerifier struct {
+	result       VerifyResult
+	expectedPrev string
+}
+
+func newChainVerifier() *chainVerifier {
+	return &chainVerifier{expectedPrev: genesisHash}
+}
+
+// add checks the next row against the chain so far
+// It returns false, with the reason in result, once the chain is broken.
+func (v *chainVerifier) add(id int64, rec record, prevHash, hash sql.NullString) (bool, error) {
+	if !hash.Valid {
+		// Unhashed rows are only allowed before the chain starts
+		if v.result.Checked > 0 {
+			v.result = v.result.broken(id, "row is missing its hash")
+			return false, nil
+		}
+		v.result.Skipped++
+		return true, nil
+	}
+
+	if prevHash.String != v.expectedPrev {
+		v.result = v.result.broken(id, "previous row was removed or changed")
+		return false, nil
+	}
+
+	computed, err := rec.hash(prevHash.String)
+	if err != nil {
+		return false, fmt.Errorf("failed to hash audit log %d: %w", id, err)
+	}
+	if computed != hash.String {
+		v.result = v.result.broken(id, "row contents do not match its hash")
+		return false, nil
+	}
+
+	v.expectedPrev = hash.String
+	v.result.Checked++
+	return true, nil
+}
+
+// finish checks the chain head once every row has been added
+// Rows removed from the end of the log leave the head pointing past them.
+func (v *chainVerifier) finish(headHash string) VerifyResult {
+	if headHash != v.expectedPrev {
+		return v.result.broken(0, "newest rows are missing")
+	}
+	v.result.Valid = true
+	return v.result
+}
+
+// broken marks the result invalid at the given row
+func (r VerifyResult) broken(id int64, reason string) VerifyResult {
+	r.Valid = false
+	if id != 0 {
+		r.BrokenAt = &id
+	}
+	r.Reason = reason
+	return r
+}
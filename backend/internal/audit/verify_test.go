@@ -0,0 +1,234 @@
+package audit
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// chainRow is an audit_logs row as Verify reads it
+type chainRow struct {
+	id       int64
+	rec      record
+	prevHash sql.NullString
+	hash     sql.NullString
+}
+
+// newChain logs n entries the way Log does and returns the rows and chain head
+func newChain(t *testing.T, n int) ([]chainRow, string) {
+	t.Helper()
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	prev := genesisHash
+	var rows []chainRow
+	for i := 1; i <= n; i++ {
+		userID := i
+		rec, err := newRecord(Entry{
+			UserID:     &userID,
+			Username:   fmt.Sprintf("user%d", i),
+			Action:     "PUT /api/v1/products/:id",
+			EntityType: "product",
+			EntityID:   fmt.Sprint(i),
+			Outcome:    OutcomeSuccess,
+			StatusCode: 200,
+			Before:     map[string]interface{}{"price": 100},
+			After:      map[string]interface{}{"price": 120},
+		})
+		if err != nil {
+			t.Fatalf("newRecord: %v", err)
+		}
+		rec.CreatedAt = start.Add(time.Duration(i) * time.Minute)
+
+		hash, err := rec.hash(prev)
+		if err != nil {
+			t.Fatalf("hash: %v", err)
+		}
+		rows = append(rows, chainRow{
+			id:       int64(i),
+			rec:      rec,
+			prevHash: sql.NullString{String: prev, Valid: true},
+			hash:     sql.NullString{String: hash, Valid: true},
+		})
+		prev = hash
+	}
+	return rows, prev
+}
+
+// verifyRows runs the chain check over rows the way Verify does
+func verifyRows(t *testing.T, rows []chainRow, headHash string) VerifyResult {
+	t.Helper()
+	chain := newChainVerifier()
+	for _, row := range rows {
+		intact, err := chain.add(row.id, row.rec, row.prevHash, row.hash)
+		if err != nil {
+			t.Fatalf("add: %v", err)
+		}
+		if !intact {
+			return chain.result
+		}
+	}
+	return chain.finish(headHash)
+}
+
+func TestVerifyChain(t *testing.T) {
+	legacy := chainRow{id: 0, rec: record{Action: "POST /api/v1/sales", Outcome: OutcomeSuccess}}
+
+	tests := []struct {
+		name        string
+		tamper      func(rows []chainRow, head string) ([]chainRow, string)
+		wantChecked int
+		wantSkipped int
+		wantBroken  int64 // 0 when the chain is intact or broken at the head
+		wantReason  string
+	}{
+		{
+			name:        "intact",
+			tamper:      func(rows []chainRow, head string) ([]chainRow, string) { return rows, head },
+			wantChecked: 4,
+		},
+		{
+			name:   "empty log",
+			tamper: func(rows []chainRow, head string) ([]chainRow, string) { return nil, genesisHash },
+		},
+		{
+			name: "unhashed rows before the chain starts",
+			tamper: func(rows []chainRow, head string) ([]chainRow, string) {
+				first, second := legacy, legacy
+				first.id, second.id = -2, -1
+				return append([]chainRow{first, second}, rows...), head
+			},
+			wantChecked: 4,
+			wantSkipped: 2,
+		},
+		{
+			name: "unhashed row inside the chain",
+			tamper: func(rows []chainRow, head string) ([]chainRow, string) {
+				rows[2].hash = sql.NullString{}
+				return rows, head
+			},
+			wantChecked: 2,
+			wantBroken:  3,
+			wantReason:  "row is missing its hash",
+		},
+		{
+			name: "row contents changed",
+			tamper: func(rows []chainRow, head string) ([]chainRow, string) {
+				after := `{"price":1}`
+				rows[1].rec.After = &after
+				return rows, head
+			},
+			wantChecked: 1,
+			wantBroken:  2,
+			wantReason:  "row contents do not match its hash",
+		},
+		{
+			name: "row changed and rehashed",
+			tamper: func(rows []chainRow, head string) ([]chainRow, string) {
+				username := "someone-else"
+				rows[1].rec.Username = &username
+				hash, _ := rows[1].rec.hash(rows[1].prevHash.String)
+				rows[1].hash.String = hash
+				return rows, head
+			},
+			wantChecked: 2,
+			wantBroken:  3,
+			wantReason:  "previous row was removed or changed",
+		},
+		{
+			name: "row removed",
+			tamper: func(rows []chainRow, head string) ([]chainRow, string) {
+				return append(rows[:1:1], rows[2:]...), head
+			},
+			wantChecked: 1,
+			wantBroken:  3,
+			wantReason:  "previous row was removed or changed",
+		},
+		{
+			name: "rows reordered",
+			tamper: func(rows []chainRow, head string) ([]chainRow, string) {
+				rows[1], rows[2] = rows[2], rows[1]
+				return rows, head
+			},
+			wantChecked: 1,
+			wantBroken:  3,
+			wantReason:  "previous row was removed or changed",
+		},
+		{
+			name: "newest row removed",
+			tamper: func(rows []chainRow, head string) ([]chainRow, string) {
+				return rows[:len(rows)-1], head
+			},
+			wantChecked: 3,
+			wantReason:  "newest rows are missing",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, head := newChain(t, 4)
+			rows, head = tt.tamper(rows, head)
+			got := verifyRows(t, rows, head)
+
+			if got.Valid != (tt.wantReason == "") || got.Reason != tt.wantReason {
+				t.Fatalf("got valid %v (%q), want reason %q", got.Valid, got.Reason, tt.wantReason)
+			}
+			if got.Checked != tt.wantChecked || got.Skipped != tt.wantSkipped {
+				t.Errorf("checked %d and skipped %d rows, want %d and %d", got.Checked, got.Skipped, tt.wantChecked, tt.wantSkipped)
+			}
+			switch {
+			case tt.wantBroken == 0 && got.BrokenAt != nil:
+				t.Errorf("broken at row %d, want no row", *got.BrokenAt)
+			case tt.wantBroken != 0 && (got.BrokenAt == nil || *got.BrokenAt != tt.wantBroken):
+				t.Errorf("broken at %v, want row %d", got.BrokenAt, tt.wantBroken)
+			}
+		})
+	}
+}
+
+func TestRecordHash(t *testing.T) {
+	rows, _ := newChain(t, 1)
+	rec := rows[0].rec
+	base, err := rec.hash(genesisHash)
+	if err != nil {
+		t.Fatalf("hash: %v", err)
+	}
+
+	bangkok := time.FixedZone("ICT", 7*60*60)
+	details := "price changed"
+	tests := []struct {
+		name     string
+		change   func(r *record) string // returns the previous hash to chain to
+		wantSame bool
+	}{
+		{"same row", func(r *record) string { return genesisHash }, true},
+		{"same instant in another zone", func(r *record) string {
+			r.CreatedAt = r.CreatedAt.In(bangkok)
+			return genesisHash
+		}, true},
+		{"different previous hash", func(r *record) string { return rows[0].hash.String }, false},
+		{"one second later", func(r *record) string {
+			r.CreatedAt = r.CreatedAt.Add(time.Second)
+			return genesisHash
+		}, false},
+		{"details added", func(r *record) string {
+			r.Details = &details
+			return genesisHash
+		}, false},
+		{"before data dropped", func(r *record) string {
+			r.Before = nil
+			return genesisHash
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changed := rec
+			prev := tt.change(&changed)
+			got, err := changed.hash(prev)
+			if err != nil {
+				t.Fatalf("hash: %v", err)
+			}
+			if (got == base) != tt.wantSame {
+				t.Fatalf("hash equal to the original = %v, want %v", got == base, tt.wantSame)
+			}
+		})
+	}
+}
@@ -1,36 +1,85 @@
 package config
 
 import (
+	"errors"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Config holds application configuration
 type Config struct {
-	Environment    string
-	DatabaseURL    string
-	JWTSecret      string
-	Port          string
-	AllowedOrigins []string
+	Environment             string
+	DatabaseURL             string
+	JWTSecret               string
+	JWTSigningKeyFile       string
+	JWTSigningKeyID         string
+	JWTVerificationKeys     string
+	AccessTokenTTL          time.Duration
+	RefreshTokenTTL         time.Duration
+	LoginThrottleStore      string
+	PasswordMinLength       int
+	PasswordMinClasses      int
+	PasswordHistory         int
+	PasswordBreachedList    string
+	OverrideDiscountPercent float64
+	IdempotencyKeyTTL       time.Duration
+	Port                    string
+	AllowedOrigins          []string
+	SchedulerEnabled        bool
+	LoyaltyExpiryNoticeDays int
+	NotificationWebhookURL  string
 }
 
+// defaultJWTSecret is the development fallback secret; never valid in production
+const defaultJWTSecret = "your-secret-key-change-in-production"
+
 // Load reads configuration from environment variables
 func Load() *Config {
 	frontendURL := getEnv("FRONTEND_URL", "http://localhost:3000")
 	origins := strings.Split(frontendURL, ",")
-	
+
 	// Trim whitespace from each origin
 	for i, origin := range origins {
 		origins[i] = strings.TrimSpace(origin)
 	}
-	
+
 	return &Config{
-		Environment: getEnv("ENVIRONMENT", "development"),
-		DatabaseURL: getEnv("DATABASE_URL", "root:password@tcp(localhost:3306)/sck_pos?charset=utf8mb4&parseTime=True&loc=Local"),
-		JWTSecret:   getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
-		Port:        getEnv("PORT", "8080"),
-		AllowedOrigins: origins,
+		Environment:             getEnv("ENVIRONMENT", "development"),
+		DatabaseURL:             getEnv("DATABASE_URL", "root:password@tcp(localhost:3306)/sck_pos?charset=utf8mb4&parseTime=True&loc=Local"),
+		JWTSecret:               getEnv("JWT_SECRET", defaultJWTSecret),
+		JWTSigningKeyFile:       getEnv("JWT_SIGNING_KEY_FILE", ""),
+		JWTSigningKeyID:         getEnv("JWT_SIGNING_KEY_ID", ""),
+		JWTVerificationKeys:     getEnv("JWT_VERIFICATION_KEYS", ""),
+		AccessTokenTTL:          getEnvDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL:         getEnvDuration("REFRESH_TOKEN_TTL", 7*24*time.Hour),
+		LoginThrottleStore:      getEnv("LOGIN_THROTTLE_STORE", "database"),
+		PasswordMinLength:       getEnvInt("PASSWORD_MIN_LENGTH", 10),
+		PasswordMinClasses:      getEnvInt("PASSWORD_MIN_CLASSES", 3),
+		PasswordHistory:         getEnvInt("PASSWORD_HISTORY", 5),
+		PasswordBreachedList:    getEnv("PASSWORD_BREACHED_LIST", ""),
+		OverrideDiscountPercent: getEnvFloat("OVERRIDE_DISCOUNT_PERCENT", 10),
+		IdempotencyKeyTTL:       getEnvDuration("IDEMPOTENCY_KEY_TTL", 24*time.Hour),
+		Port:                    getEnv("PORT", "8080"),
+		AllowedOrigins:          origins,
+		SchedulerEnabled:        getEnv("SCHEDULER_ENABLED", "true") == "true",
+		LoyaltyExpiryNoticeDays: getEnvInt("LOYALTY_EXPIRY_NOTICE_DAYS", 14),
+		NotificationWebhookURL:  getEnv("NOTIFICATION_WEBHOOK_URL", ""),
+	}
+}
+
+// Validate rejects configuration that is unsafe to run with
+func (c *Config) Validate() error {
+	if c.Environment == "production" && c.JWTSigningKeyFile == "" {
+		if c.JWTSecret == defaultJWTSecret {
+			return errors.New("JWT_SECRET is the default value; set JWT_SIGNING_KEY_FILE or a real secret in production")
+		}
+		if len(c.JWTSecret) < 32 {
+			return errors.New("JWT_SECRET must be at least 32 characters in production")
+		}
 	}
+	return nil
 }
 
 // getEnv returns environment variable value or default
@@ -40,3 +89,27 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvInt returns environment variable value as an int or default
+func getEnvInt(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvFloat returns environment variable value as a float or default
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value, err := strconv.ParseFloat(os.Getenv(key), 64); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvDuration returns environment variable value as a duration (e.g. "15m") or default
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
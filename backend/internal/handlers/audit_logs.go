@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"sck-pos-backend/internal/audit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuditHandler handles audit trail queries
+type AuditHandler struct {
+	db *sql.DB
+}
+
+// NewAuditHandler creates a new audit handler
+func NewAuditHandler(db *sql.DB) *AuditHandler {
+	return &AuditHandler{db: db}
+}
+
+// AuditLog represents an audit trail entry
+type AuditLog struct {
+	ID         int64           `json:"id"`
+	UserID     *int            `json:"user_id,omitempty"`
+	Username   *string         `json:"username,omitempty"`
+	Role       *string         `json:"role,omitempty"`
+	Action     string          `json:"action"`
+	Resource   *string         `json:"resource,omitempty"`
+	EntityType *string         `json:"entity_type,omitempty"`
+	EntityID   *string         `json:"entity_id,omitempty"`
+	Outcome    string          `json:"outcome"`
+	StatusCode *int            `json:"status_code,omitempty"`
+	IPAddress  *string         `json:"ip_address,omitempty"`
+	Details    *string         `json:"details,omitempty"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	PrevHash   *string         `json:"prev_hash,omitempty"`
+	Hash       *string         `json:"hash,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+const auditLogColumns = `
+	id, user_id, username, role, action, resource, entity_type, entity_id, outcome,
+	status_code, ip_address, details, before_data, after_data, prev_hash, hash, created_at
+`
+
+// scanAuditLog reads a row selected with auditLogColumns
+func scanAuditLog(row interface{ Scan(...interface{}) error }) (AuditLog, error) {
+	var l AuditLog
+	var before, after *string
+	err := row.Scan(
+		&l.ID, &l.UserID, &l.Username, &l.Role, &l.Action, &l.Resource, &l.EntityType, &l.EntityID,
+		&l.Outcome, &l.StatusCode, &l.IPAddress, &l.Details, &before, &after, &l.PrevHash, &l.Hash,
+		&l.CreatedAt,
+	)
+	if before != nil {
+		l.Before = json.RawMessage(*before)
+	}
+	if after != nil {
+		l.After = json.RawMessage(*after)
+	}
+	return l, err
+}
+
+// GetAuditLogs lists audit entries, newest first
+// Filters: user_id, username, action, entity_type, entity_id, outcome, from, to (RFC 3339);
+// page with limit and before_id.
+func (h *AuditHandler) GetAuditLogs(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 || limit > 500 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 500"})
+		return
+	}
+
+	query := "SELECT " + auditLogColumns + " FROM audit_logs WHERE 1 = 1"
+	args := []interface{}{}
+
+	for _, filter := range []struct{ param, column string }{
+		{"user_id", "user_id"},
+		{"username", "username"},
+		{"action", "action"},
+		{"entity_type", "entity_type"},
+		{"entity_id", "entity_id"},
+		{"outcome", "outcome"},
+	} {
+		if value := c.Query(filter.param); value != "" {
+			query += " AND " + filter.column + " = ?"
+			args = append(args, value)
+		}
+	}
+
+	for _, bound := range []struct{ param, op string }{{"from", ">="}, {"to", "<"}} {
+		if value := c.Query(bound.param); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": bound.param + " must be an RFC 3339 timestamp"})
+				return
+			}
+			query += " AND created_at " + bound.op + " ?"
+			args = append(args, t)
+		}
+	}
+
+	if beforeID := c.Query("before_id"); beforeID != "" {
+		id, err := strconv.ParseInt(beforeID, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid before_id"})
+			return
+		}
+		query += " AND id < ?"
+		args = append(args, id)
+	}
+
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	logs := []AuditLog{}
+	for rows.Next() {
+		l, err := scanAuditLog(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan audit log"})
+			return
+		}
+		logs = append(logs, l)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	response := gin.H{"audit_logs": logs}
+	if len(logs) == limit {
+		response["next_before_id"] = logs[len(logs)-1].ID
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetAuditLog retrieves a single audit entry
+func (h *AuditHandler) GetAuditLog(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid audit log ID"})
+		return
+	}
+
+	l, err := scanAuditLog(h.db.QueryRow("SELECT "+auditLogColumns+" FROM audit_logs WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Audit log not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, l)
+}
+
+// VerifyAuditLogs recomputes the hash chain and reports the first tampered row
+func (h *AuditHandler) VerifyAuditLogs(c *gin.Context) {
+	result, err := audit.Verify(c.Request.Context(), h.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify audit logs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// auditSecretColumns are never copied into audit snapshots
+var auditSecretColumns = map[string]bool{
+	"password_hash":      true,
+	"pin_hash":           true,
+	"totp_secret":        true,
+	"token_hash":         true,
+	"device_secret_hash": true,
+}
+
+// auditSnapshotColumns lists the columns audited for tables holding personal
+// data, which must stay out of the audit log because it can never be erased.
+// Listing what is kept, rather than what is left out, keeps new personal
+// columns out by default.
+var auditSnapshotColumns = map[string]string{
+	"customers": `id, loyalty_points, loyalty_tier, tier_evaluated_at, customer_group_id, is_active,
+		merged_into_id, erased_at, erased_by, created_at, updated_at`,
+}
+
+// auditSnapshot loads a row as a column map for the audit trail
+// table must be a constant; a nil map means the row could not be read.
+// Tables in auditSnapshotColumns are limited to the listed columns.
+func auditSnapshot(q interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}, table string, id interface{}) map[string]interface{} {
+	columns, ok := auditSnapshotColumns[table]
+	if !ok {
+		columns = "*"
+	}
+	rows, err := q.Query("SELECT "+columns+" FROM "+table+" WHERE id = ?", id)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil
+	}
+	snapshot, err := scanRowMap(rows)
+	if err != nil {
+		return nil
+	}
+	return snapshot
+}
+
+// scanRowMap reads the current row as a column map, leaving out secrets
+func scanRowMap(rows *sql.Rows) (map[string]interface{}, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	if err := rows.Scan(pointers...); err != nil {
+		return nil, err
+	}
+
+	row := make(map[string]interface{}, len(columns))
+	for i, column := range columns {
+		if auditSecretColumns[column] {
+			continue
+		}
+		// Text and DECIMAL columns arrive as bytes
+		if b, ok := values[i].([]byte); ok {
+			row[column] = string(b)
+		} else {
+			row[column] = values[i]
+		}
+	}
+	return row, nil
+}
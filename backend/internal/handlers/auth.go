@@ -2,25 +2,48 @@ package handlers
 
 import (
 	"database/sql"
+	"fmt"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"sck-pos-backend/internal/config"
+	"sck-pos-backend/internal/jwtkeys"
+	"sck-pos-backend/internal/middleware"
+	"sck-pos-backend/internal/password"
+	"sck-pos-backend/internal/throttle"
+
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v4"
 	"golang.org/x/crypto/bcrypt"
 )
 
 // AuthHandler handles authentication requests
 type AuthHandler struct {
-	db        *sql.DB
-	jwtSecret string
+	db              *sql.DB
+	keys            *jwtkeys.KeySet
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+	loginGuard      *throttle.Guard
+	passwords       *password.Policy
 }
 
 // NewAuthHandler creates a new auth handler
-func NewAuthHandler(db *sql.DB, jwtSecret string) *AuthHandler {
+// Failed login counters are kept in the database unless LOGIN_THROTTLE_STORE=memory.
+func NewAuthHandler(db *sql.DB, cfg *config.Config, keys *jwtkeys.KeySet, passwords *password.Policy) *AuthHandler {
+	var store throttle.Store = throttle.NewMySQLStore(db)
+	if cfg.LoginThrottleStore == "memory" {
+		store = throttle.NewMemoryStore()
+	}
+
 	return &AuthHandler{
-		db:        db,
-		jwtSecret: jwtSecret,
+		db:              db,
+		keys:            keys,
+		accessTokenTTL:  cfg.AccessTokenTTL,
+		refreshTokenTTL: cfg.RefreshTokenTTL,
+		loginGuard:      throttle.NewGuard(store),
+		passwords:       passwords,
 	}
 }
 
@@ -37,13 +60,24 @@ type User struct {
 	Email    string `json:"email"`
 	FullName string `json:"full_name"`
 	Role     string `json:"role"`
+	StoreID  *int   `json:"store_id,omitempty"`
 	IsActive bool   `json:"is_active"`
 }
 
 // LoginResponse represents login response
 type LoginResponse struct {
-	Token string `json:"token"`
-	User  User   `json:"user"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"` // access token lifetime in seconds
+	User         User   `json:"user"`
+
+	// MFAEnrollmentRequired is set when the role requires two-factor authentication
+	// but the user has not enrolled yet; the session can only reach /auth/2fa.
+	MFAEnrollmentRequired bool `json:"mfa_enrollment_required,omitempty"`
+
+	// PasswordChangeRequired is set when the user must change their password
+	// before the session can reach anything but /auth routes.
+	PasswordChangeRequired bool `json:"password_change_required,omitempty"`
 }
 
 // Login handles user authentication
@@ -54,22 +88,58 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
+	// A till signing in with a password binds the session to itself
+	terminal, ok := requestTerminal(h.db, c)
+	if !ok {
+		return
+	}
+
+	// Slow down or refuse attempts after repeated failures; an allowed attempt
+	// is counted as a failure until the password proves otherwise
+	decision, err := h.loginGuard.Begin(c.Request.Context(), req.Username, c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !decision.Allowed {
+		retryAfter := int(decision.RetryAfter.Seconds()) + 1
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		if decision.Locked {
+			h.recordFailedLogin(c, req.Username, nil, "locked")
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error":       "Account temporarily locked after too many failed logins",
+				"retry_after": retryAfter,
+			})
+			return
+		}
+		h.recordFailedLogin(c, req.Username, nil, "throttled")
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":       "Too many failed logins, try again later",
+			"retry_after": retryAfter,
+		})
+		return
+	}
+
 	// Query user from database
 	var user User
 	var passwordHash string
+	var totpEnabled bool
 	query := `
-		SELECT id, username, email, full_name, role, is_active, password_hash 
+		SELECT id, username, email, full_name, role, store_id, is_active, password_hash, totp_enabled 
 		FROM users 
 		WHERE username = ? AND is_active = true
 	`
 	
-	err := h.db.QueryRow(query, req.Username).Scan(
+	err = h.db.QueryRow(query, req.Username).Scan(
 		&user.ID, &user.Username, &user.Email, &user.FullName, 
-		&user.Role, &user.IsActive, &passwordHash,
+		&user.Role, &user.StoreID, &user.IsActive, &passwordHash, &totpEnabled,
 	)
 	
 	if err == sql.ErrNoRows {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		// Spend as long as a real password check so response times do not
+		// reveal which usernames exist
+		bcrypt.CompareHashAndPassword([]byte(dummyPasswordHash), []byte(req.Password))
+		h.loginFailed(c, req.Username, nil, decision)
 		return
 	} else if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
@@ -78,40 +148,56 @@ func (h *AuthHandler) Login(c *gin.Context) {
 
 	// Verify password
 	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.Password)); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		h.loginFailed(c, req.Username, &user.ID, decision)
 		return
 	}
 
-	// Generate JWT token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id":  user.ID,
-		"username": user.Username,
-		"role":     user.Role,
-		"exp":      time.Now().Add(time.Hour * 24).Unix(),
-	})
+	// The password was right, so this attempt no longer counts as a failure.
+	// Enrolled users keep their failed login count until the code is accepted.
+	if totpEnabled {
+		err = h.loginGuard.Release(c.Request.Context(), req.Username, c.ClientIP())
+	} else {
+		err = h.loginGuard.Success(c.Request.Context(), req.Username, c.ClientIP())
+	}
+	if err != nil {
+		log.Printf("Failed to reset login counter for %s: %v", req.Username, err)
+	}
+
+	if !terminalAllowed(c, terminal, user) {
+		return
+	}
+
+	// Enrolled users must complete a second step before getting tokens
+	if totpEnabled {
+		h.startMFAChallenge(c, user)
+		return
+	}
 
-	tokenString, err := token.SignedString([]byte(h.jwtSecret))
+	// Start a session and issue its first token pair
+	response, err := h.startSession(c, user, terminalIDOf(terminal), false)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
+	response.MFAEnrollmentRequired = middleware.MFARequired(user.Role)
 
-	c.JSON(http.StatusOK, LoginResponse{
-		Token: tokenString,
-		User:  user,
-	})
+	c.JSON(http.StatusOK, response)
 }
 
 // RegisterRequest represents registration request body
 type RegisterRequest struct {
-	Username string `json:"username" binding:"required"`
-	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=6"`
-	FullName string `json:"full_name" binding:"required"`
-	Role     string `json:"role"`
+	Username   string `json:"username" binding:"required"`
+	Email      string `json:"email" binding:"required,email"`
+	Password   string `json:"password" binding:"required"`
+	FullName   string `json:"full_name" binding:"required"`
+	Role       string `json:"role" binding:"omitempty,oneof=admin manager cashier"`
+	StoreID    *int   `json:"store_id"`
+	InviteCode string `json:"invite_code"`
 }
 
 // Register handles user registration
+// Callers must either present an admin token or redeem a one-time invite code;
+// with an invite the role and store always come from the invite.
 func (h *AuthHandler) Register(c *gin.Context) {
 	var req RegisterRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -119,34 +205,138 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	// Set default role if not provided
-	if req.Role == "" {
-		req.Role = "cashier"
+	role := "cashier"
+	storeID := req.StoreID
+	var inviteID int
+	// Passwords chosen by an admin are temporary; invitees pick their own
+	mustChange := false
+
+	if authHeader := c.GetHeader("Authorization"); authHeader != "" {
+		claims, err := h.keys.Parse(strings.TrimPrefix(authHeader, "Bearer "))
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			return
+		}
+		if claims["role"] != "admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can register users directly"})
+			return
+		}
+		// This route skips AuthRequired, so check the session here
+		var mfaVerified bool
+		err = h.db.QueryRow(
+			"SELECT mfa_verified FROM user_sessions WHERE id = ? AND revoked_at IS NULL",
+			claims["sid"],
+		).Scan(&mfaVerified)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if !mfaVerified {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication required", "code": "mfa_required"})
+			return
+		}
+		if req.Role != "" {
+			role = req.Role
+		}
+		mustChange = true
+		// Attribute the audit entry to the admin, as AuthRequired would
+		c.Set("user_id", claims["user_id"])
+		c.Set("username", claims["username"])
+		c.Set("role", claims["role"])
+	} else {
+		if req.InviteCode == "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "An invite code is required to register"})
+			return
+		}
+
+		var inviteEmail *string
+		query := `
+			SELECT id, role, store_id, email
+			FROM user_invites
+			WHERE code_hash = ? AND used_at IS NULL AND revoked_at IS NULL AND expires_at > NOW()
+		`
+		err := h.db.QueryRow(query, hashToken(req.InviteCode)).Scan(&inviteID, &role, &storeID, &inviteEmail)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Invalid or expired invite code"})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		if inviteEmail != nil && !strings.EqualFold(*inviteEmail, req.Email) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Invite code was issued for a different email"})
+			return
+		}
+
+		if req.Role != "" && req.Role != role {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Role is set by the invite"})
+			return
+		}
 	}
 
-	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	// Check the password policy and hash
+	hashedPassword, err := hashNewPassword(h.passwords, req.Password, req.Username)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		respondPasswordError(c, h.passwords, err)
 		return
 	}
 
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
 	// Insert user into database
 	query := `
-		INSERT INTO users (username, email, password_hash, full_name, role) 
-		VALUES (?, ?, ?, ?, ?)
+		INSERT INTO users (username, email, password_hash, must_change_password, full_name, role, store_id) 
+		VALUES (?, ?, ?, ?, ?, ?, ?)
 	`
 	
-	result, err := h.db.Exec(query, req.Username, req.Email, string(hashedPassword), req.FullName, req.Role)
-	if err != nil {
+	result, err := tx.Exec(query, req.Username, req.Email, hashedPassword, mustChange, req.FullName, role, storeID)
+	if isDuplicateKeyError(err) {
 		c.JSON(http.StatusConflict, gin.H{"error": "Username or email already exists"})
 		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
 	}
 
 	userID, _ := result.LastInsertId()
 
+	// Consume the invite; the used_at guard stops two registrations racing on one code
+	if inviteID != 0 {
+		result, err := tx.Exec(`
+			UPDATE user_invites SET used_at = NOW(), used_by = ? 
+			WHERE id = ? AND used_at IS NULL
+		`, userID, inviteID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to redeem invite"})
+			return
+		}
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Invite code has already been used"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+	middleware.AuditChange(c, "user", userID, nil, auditSnapshot(h.db, "users", userID))
+	if inviteID != 0 {
+		middleware.AuditDetails(c, fmt.Sprintf("registered with invite #%d", inviteID))
+	}
+
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "User created successfully",
 		"user_id": userID,
+		"role":    role,
 	})
 }
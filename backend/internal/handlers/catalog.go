@@ -4,24 +4,80 @@ import (
 	"database/sql"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"sck-pos-backend/internal/middleware"
+	"sck-pos-backend/internal/phone"
+
 	"github.com/gin-gonic/gin"
 )
 
 // Customer represents a customer
 type Customer struct {
+	ID              int       `json:"id"`
+	Name            string    `json:"name"`
+	Email           *string   `json:"email"`
+	Phone           *string   `json:"phone"`
+	PhoneNormalized *string   `json:"phone_normalized"` // E.164, derived from phone
+	Address         *string   `json:"address"`
+	TaxID           *string   `json:"tax_id"` // 13-digit Thai national ID or tax ID
+	CustomerGroupID *int      `json:"customer_group_id"` // set with PUT /customers/:id/group
+	LoyaltyPoints   int       `json:"loyalty_points"`
+	IsActive        bool      `json:"is_active"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+const customerColumns = `
+	id, name, email, phone, phone_normalized, address, tax_id, customer_group_id, loyalty_points, is_active, created_at, updated_at
+`
+
+// scanCustomer reads a row selected with customerColumns
+func scanCustomer(row interface{ Scan(...interface{}) error }) (Customer, error) {
+	var customer Customer
+	err := row.Scan(
+		&customer.ID,
+		&customer.Name,
+		&customer.Email,
+		&customer.Phone,
+		&customer.PhoneNormalized,
+		&customer.Address,
+		&customer.TaxID,
+		&customer.CustomerGroupID,
+		&customer.LoyaltyPoints,
+		&customer.IsActive,
+		&customer.CreatedAt,
+		&customer.UpdatedAt,
+	)
+	return customer, err
+}
+
+// Product represents a catalog product
+type Product struct {
 	ID            int       `json:"id"`
+	SKU           string    `json:"sku"`
 	Name          string    `json:"name"`
-	Email         *string   `json:"email"`
-	Phone         *string   `json:"phone"`
-	Address       *string   `json:"address"`
-	LoyaltyPoints int       `json:"loyalty_points"`
+	Description   *string   `json:"description"`
+	CategoryID    *int      `json:"category_id"`
+	Price         float64   `json:"price"`
+	StockQuantity int       `json:"stock_quantity"`
+	MinStockLevel int       `json:"min_stock_level"`
+	Barcode       *string   `json:"barcode"`
+	ImageURL      *string   `json:"image_url"`
 	IsActive      bool      `json:"is_active"`
-	CreatedAt     time.Time `json:"created_at"`
 	UpdatedAt     time.Time `json:"updated_at"`
 }
 
+// Category represents a product category
+type Category struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	Description *string   `json:"description"`
+	IsActive    bool      `json:"is_active"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
 // ProductHandler handles product-related requests
 type ProductHandler struct {
 	db *sql.DB
@@ -107,36 +163,55 @@ func NewCustomerHandler(db *sql.DB) *CustomerHandler {
 	return &CustomerHandler{db: db}
 }
 
-// GetCustomers retrieves all customers
+// GetCustomers lists active customers by name a page at a time
+// q matches part of the name, the start of the email, or the phone number in
+// any format (a full number exactly, or at least 3 digits anywhere in it).
+// Page with page (from 1) and page_size (default 20, at most 100).
 func (h *CustomerHandler) GetCustomers(c *gin.Context) {
-	query := `
-		SELECT id, name, email, phone, address, loyalty_points, is_active, created_at, updated_at 
-		FROM customers 
-		WHERE is_active = 1 
-		ORDER BY name ASC
-	`
-	
-	rows, err := h.db.Query(query)
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "page must be a positive number"})
+		return
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if err != nil || pageSize < 1 || pageSize > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "page_size must be between 1 and 100"})
+		return
+	}
+
+	where := "WHERE is_active = 1"
+	args := []interface{}{}
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		conditions := []string{"name LIKE ?", "email LIKE ?"}
+		args = append(args, "%"+escapeLike(q)+"%", escapeLike(q)+"%")
+
+		if normalized := phone.Normalize(q); normalized != "" {
+			conditions = append(conditions, "phone_normalized = ?")
+			args = append(args, normalized)
+		} else if digits := strings.TrimLeft(phone.Digits(q), "0"); len(digits) >= 3 {
+			conditions = append(conditions, "phone_normalized LIKE ?")
+			args = append(args, "%"+digits+"%")
+		}
+		where += " AND (" + strings.Join(conditions, " OR ") + ")"
+	}
+
+	var total int
+	if err := h.db.QueryRow("SELECT COUNT(*) FROM customers "+where, args...).Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch customers"})
+		return
+	}
+
+	query := "SELECT " + customerColumns + " FROM customers " + where + " ORDER BY name ASC, id ASC LIMIT ? OFFSET ?"
+	rows, err := h.db.Query(query, append(args, pageSize, (page-1)*pageSize)...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch customers"})
 		return
 	}
 	defer rows.Close()
 
-	var customers []Customer
+	customers := []Customer{}
 	for rows.Next() {
-		var customer Customer
-		err := rows.Scan(
-			&customer.ID,
-			&customer.Name,
-			&customer.Email,
-			&customer.Phone,
-			&customer.Address,
-			&customer.LoyaltyPoints,
-			&customer.IsActive,
-			&customer.CreatedAt,
-			&customer.UpdatedAt,
-		)
+		customer, err := scanCustomer(rows)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan customer data"})
 			return
@@ -149,7 +224,17 @@ func (h *CustomerHandler) GetCustomers(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, customers)
+	c.JSON(http.StatusOK, gin.H{
+		"customers": customers,
+		"page":      page,
+		"page_size": pageSize,
+		"total":     total,
+	})
+}
+
+// escapeLike escapes the LIKE wildcards in s
+func escapeLike(s string) string {
+	return strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(s)
 }
 
 // GetCustomer retrieves a single customer
@@ -161,28 +246,16 @@ func (h *CustomerHandler) GetCustomer(c *gin.Context) {
 		return
 	}
 
-	query := `
-		SELECT id, name, email, phone, address, loyalty_points, is_active, created_at, updated_at 
-		FROM customers 
-		WHERE id = ? AND is_active = 1
-	`
-	
-	var customer Customer
-	err = h.db.QueryRow(query, id).Scan(
-		&customer.ID,
-		&customer.Name,
-		&customer.Email,
-		&customer.Phone,
-		&customer.Address,
-		&customer.LoyaltyPoints,
-		&customer.IsActive,
-		&customer.CreatedAt,
-		&customer.UpdatedAt,
-	)
-	
+	query := "SELECT " + customerColumns + " FROM customers WHERE id = ? AND is_active = 1"
+	customer, err := scanCustomer(h.db.QueryRow(query, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+			response := gin.H{"error": "Customer not found"}
+			// Tills holding a merged duplicate can switch to the customer it became
+			if survivor, err := survivingCustomerID(h.db, id); err == nil && survivor != 0 && survivor != id {
+				response["merged_into_id"] = survivor
+			}
+			c.JSON(http.StatusNotFound, response)
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch customer"})
 		}
@@ -193,6 +266,8 @@ func (h *CustomerHandler) GetCustomer(c *gin.Context) {
 }
 
 // CreateCustomer creates a new customer
+// Invalid fields, or a phone number another active customer has, are
+// answered with 422 and the problem with each field.
 func (h *CustomerHandler) CreateCustomer(c *gin.Context) {
 	var customer Customer
 	if err := c.ShouldBindJSON(&customer); err != nil {
@@ -200,18 +275,30 @@ func (h *CustomerHandler) CreateCustomer(c *gin.Context) {
 		return
 	}
 
-	if customer.Name == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Customer name is required"})
+	customer.ID = 0
+	customer.CustomerGroupID = nil
+	if errs := normalizeCustomer(&customer); errs != nil {
+		errs.respond(c)
+		return
+	}
+	if errs, err := checkPhoneAvailable(h.db, &customer); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	} else if errs != nil {
+		errs.respond(c)
 		return
 	}
 
 	query := `
-		INSERT INTO customers (name, email, phone, address, loyalty_points, is_active) 
-		VALUES (?, ?, ?, ?, 0, 1)
+		INSERT INTO customers (name, email, phone, phone_normalized, address, tax_id, loyalty_points, is_active) 
+		VALUES (?, ?, ?, ?, ?, ?, 0, 1)
 	`
 	
-	result, err := h.db.Exec(query, customer.Name, customer.Email, customer.Phone, customer.Address)
-	if err != nil {
+	result, err := h.db.Exec(query, customer.Name, customer.Email, customer.Phone, customer.PhoneNormalized, customer.Address, customer.TaxID)
+	if isDuplicateKeyError(err) {
+		phoneTaken.respond(c)
+		return
+	} else if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create customer"})
 		return
 	}
@@ -222,6 +309,8 @@ func (h *CustomerHandler) CreateCustomer(c *gin.Context) {
 		return
 	}
 
+	middleware.AuditChange(c, "customer", id, nil, auditSnapshot(h.db, "customers", id))
+
 	customer.ID = int(id)
 	customer.LoyaltyPoints = 0
 	customer.IsActive = true
@@ -232,6 +321,7 @@ func (h *CustomerHandler) CreateCustomer(c *gin.Context) {
 }
 
 // UpdateCustomer updates an existing customer
+// Fields are checked as in CreateCustomer.
 func (h *CustomerHandler) UpdateCustomer(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.Atoi(idStr)
@@ -246,19 +336,41 @@ func (h *CustomerHandler) UpdateCustomer(c *gin.Context) {
 		return
 	}
 
-	if customer.Name == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Customer name is required"})
+	customer.ID = id
+	if errs := normalizeCustomer(&customer); errs != nil {
+		errs.respond(c)
+		return
+	}
+	if errs, err := checkPhoneAvailable(h.db, &customer); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	} else if errs != nil {
+		errs.respond(c)
+		return
+	}
+
+	before := auditSnapshot(h.db, "customers", id)
+	if before == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+		return
+	}
+	changed, err := changedCustomerFields(h.db, &customer)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
 
 	query := `
 		UPDATE customers 
-		SET name = ?, email = ?, phone = ?, address = ?, updated_at = CURRENT_TIMESTAMP 
+		SET name = ?, email = ?, phone = ?, phone_normalized = ?, address = ?, tax_id = ?, updated_at = CURRENT_TIMESTAMP 
 		WHERE id = ? AND is_active = 1
 	`
 	
-	result, err := h.db.Exec(query, customer.Name, customer.Email, customer.Phone, customer.Address, id)
-	if err != nil {
+	result, err := h.db.Exec(query, customer.Name, customer.Email, customer.Phone, customer.PhoneNormalized, customer.Address, customer.TaxID, id)
+	if isDuplicateKeyError(err) {
+		phoneTaken.respond(c)
+		return
+	} else if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update customer"})
 		return
 	}
@@ -274,6 +386,11 @@ func (h *CustomerHandler) UpdateCustomer(c *gin.Context) {
 		return
 	}
 
+	middleware.AuditChange(c, "customer", id, before, auditSnapshot(h.db, "customers", id))
+	if len(changed) > 0 {
+		middleware.AuditDetails(c, "changed: "+strings.Join(changed, ", "))
+	}
+
 	customer.ID = id
 	c.JSON(http.StatusOK, customer)
 }
@@ -287,6 +404,8 @@ func (h *CustomerHandler) DeleteCustomer(c *gin.Context) {
 		return
 	}
 
+	before := auditSnapshot(h.db, "customers", id)
+
 	query := `
 		UPDATE customers 
 		SET is_active = 0, updated_at = CURRENT_TIMESTAMP 
@@ -310,5 +429,7 @@ func (h *CustomerHandler) DeleteCustomer(c *gin.Context) {
 		return
 	}
 
+	middleware.AuditChange(c, "customer", id, before, auditSnapshot(h.db, "customers", id))
+
 	c.JSON(http.StatusOK, gin.H{"message": "Customer deleted successfully"})
 }
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+)
+
+// currentUserID returns the authenticated user's ID set by the auth middleware
+func currentUserID(c *gin.Context) (int, bool) {
+	value, exists := c.Get("user_id")
+	if !exists {
+		return 0, false
+	}
+
+	// JWT numeric claims are decoded as float64
+	switch id := value.(type) {
+	case float64:
+		return int(id), true
+	case int:
+		return id, true
+	default:
+		return 0, false
+	}
+}
+
+// currentRole returns the authenticated user's role set by the auth middleware
+func currentRole(c *gin.Context) string {
+	role, _ := c.Get("role")
+	roleStr, _ := role.(string)
+	return roleStr
+}
+
+// currentTerminalID returns the till the session is bound to, if any
+func currentTerminalID(c *gin.Context) *int {
+	if value, exists := c.Get("terminal_id"); exists {
+		if id, ok := value.(int); ok {
+			return &id
+		}
+	}
+	return nil
+}
+
+// isInsufficientPointsError reports whether err is the SIGNAL raised by the redemption procedures
+func isInsufficientPointsError(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1644 && mysqlErr.Message == "Insufficient loyalty points"
+}
@@ -0,0 +1,495 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"sck-pos-backend/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CustomerGroupHandler handles customer group and group price list requests
+type CustomerGroupHandler struct {
+	db *sql.DB
+}
+
+// NewCustomerGroupHandler creates a new customer group handler
+func NewCustomerGroupHandler(db *sql.DB) *CustomerGroupHandler {
+	return &CustomerGroupHandler{db: db}
+}
+
+// CustomerGroup is a set of customers, such as wholesale or staff, with its own pricing
+// Products on the group's price list sell at that price; everything else
+// sells at the list price less DiscountPercent.
+type CustomerGroup struct {
+	ID              int       `json:"id"`
+	Code            string    `json:"code"`
+	Name            string    `json:"name"`
+	DiscountPercent float64   `json:"discount_percent"`
+	IsActive        bool      `json:"is_active"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// CustomerGroupRequest represents create and update customer group request bodies
+type CustomerGroupRequest struct {
+	Code            string  `json:"code" binding:"required,max=30"`
+	Name            string  `json:"name" binding:"required,max=100"`
+	DiscountPercent float64 `json:"discount_percent" binding:"min=0,max=100"`
+	IsActive        *bool   `json:"is_active"`
+}
+
+// GroupPrice is a product's price on a group's price list
+type GroupPrice struct {
+	ProductID   int     `json:"product_id" binding:"required"`
+	ProductName string  `json:"product_name,omitempty"`
+	ListPrice   float64 `json:"list_price,omitempty"`
+	Price       float64 `json:"price" binding:"min=0"`
+}
+
+// SetGroupPricesRequest adds or changes entries on a group's price list
+type SetGroupPricesRequest struct {
+	Prices []GroupPrice `json:"prices" binding:"required,min=1,dive"`
+}
+
+// SetCustomerGroupRequest moves a customer into a group, or out of any with null
+type SetCustomerGroupRequest struct {
+	CustomerGroupID *int `json:"customer_group_id"`
+}
+
+// ItemPrice is what a customer pays for a product and why
+type ItemPrice struct {
+	ProductID int     `json:"product_id"`
+	ListPrice float64 `json:"list_price"`
+	UnitPrice float64 `json:"unit_price"`
+	Source    string  `json:"source"`
+}
+
+// Where the price a customer pays comes from
+const (
+	PriceSourceList          = "list"
+	PriceSourcePriceList     = "price_list"
+	PriceSourceGroupDiscount = "group_discount"
+)
+
+const customerGroupColumns = `id, code, name, discount_percent, is_active, created_at, updated_at`
+
+// scanCustomerGroup reads a row selected with customerGroupColumns
+func scanCustomerGroup(row interface{ Scan(...interface{}) error }) (CustomerGroup, error) {
+	var group CustomerGroup
+	err := row.Scan(
+		&group.ID, &group.Code, &group.Name, &group.DiscountPercent, &group.IsActive, &group.CreatedAt, &group.UpdatedAt,
+	)
+	return group, err
+}
+
+// GetCustomerGroups lists customer groups with how many active customers each has
+func (h *CustomerGroupHandler) GetCustomerGroups(c *gin.Context) {
+	rows, err := h.db.Query(`
+		SELECT g.id, g.code, g.name, g.discount_percent, g.is_active, g.created_at, g.updated_at,
+			(SELECT COUNT(*) FROM customers WHERE customer_group_id = g.id AND is_active = 1)
+		FROM customer_groups g
+		ORDER BY g.name
+	`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch customer groups"})
+		return
+	}
+	defer rows.Close()
+
+	type groupWithCount struct {
+		CustomerGroup
+		CustomerCount int `json:"customer_count"`
+	}
+	groups := []groupWithCount{}
+	for rows.Next() {
+		var group groupWithCount
+		err := rows.Scan(
+			&group.ID, &group.Code, &group.Name, &group.DiscountPercent, &group.IsActive,
+			&group.CreatedAt, &group.UpdatedAt, &group.CustomerCount,
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan customer group data"})
+			return
+		}
+		groups = append(groups, group)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"customer_groups": groups})
+}
+
+// CreateCustomerGroup creates a customer group
+func (h *CustomerGroupHandler) CreateCustomerGroup(c *gin.Context) {
+	var req CustomerGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	isActive := req.IsActive == nil || *req.IsActive
+
+	result, err := h.db.Exec(`
+		INSERT INTO customer_groups (code, name, discount_percent, is_active) VALUES (?, ?, ?, ?)
+	`, strings.ToLower(strings.TrimSpace(req.Code)), strings.TrimSpace(req.Name), req.DiscountPercent, isActive)
+	if isDuplicateKeyError(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "A customer group with this code already exists"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create customer group"})
+		return
+	}
+	id, _ := result.LastInsertId()
+
+	group, err := scanCustomerGroup(h.db.QueryRow("SELECT "+customerGroupColumns+" FROM customer_groups WHERE id = ?", id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch customer group"})
+		return
+	}
+	middleware.AuditChange(c, "customer_group", id, nil, group)
+
+	c.JSON(http.StatusCreated, group)
+}
+
+// UpdateCustomerGroup changes a customer group's code, name, discount or status
+// Deactivating a group stops its pricing at checkout; its customers keep
+// their membership.
+func (h *CustomerGroupHandler) UpdateCustomerGroup(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer group ID"})
+		return
+	}
+
+	var req CustomerGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	before := auditSnapshot(h.db, "customer_groups", id)
+	if before == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Customer group not found"})
+		return
+	}
+
+	_, err = h.db.Exec(`
+		UPDATE customer_groups SET code = ?, name = ?, discount_percent = ?, is_active = COALESCE(?, is_active)
+		WHERE id = ?
+	`, strings.ToLower(strings.TrimSpace(req.Code)), strings.TrimSpace(req.Name), req.DiscountPercent, req.IsActive, id)
+	if isDuplicateKeyError(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "A customer group with this code already exists"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update customer group"})
+		return
+	}
+	middleware.AuditChange(c, "customer_group", id, before, auditSnapshot(h.db, "customer_groups", id))
+
+	group, err := scanCustomerGroup(h.db.QueryRow("SELECT "+customerGroupColumns+" FROM customer_groups WHERE id = ?", id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch customer group"})
+		return
+	}
+	c.JSON(http.StatusOK, group)
+}
+
+// GetCustomerGroupPrices lists a group's price list
+func (h *CustomerGroupHandler) GetCustomerGroupPrices(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer group ID"})
+		return
+	}
+
+	group, err := scanCustomerGroup(h.db.QueryRow("SELECT "+customerGroupColumns+" FROM customer_groups WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Customer group not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch customer group"})
+		return
+	}
+
+	rows, err := h.db.Query(`
+		SELECT gp.product_id, p.name, p.price, gp.price
+		FROM customer_group_prices gp
+		JOIN products p ON p.id = gp.product_id
+		WHERE gp.customer_group_id = ?
+		ORDER BY p.name
+	`, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch group prices"})
+		return
+	}
+	defer rows.Close()
+
+	prices := []GroupPrice{}
+	for rows.Next() {
+		var price GroupPrice
+		if err := rows.Scan(&price.ProductID, &price.ProductName, &price.ListPrice, &price.Price); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan group price data"})
+			return
+		}
+		prices = append(prices, price)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"customer_group": group, "prices": prices})
+}
+
+// SetCustomerGroupPrices adds products to a group's price list or changes their price
+func (h *CustomerGroupHandler) SetCustomerGroupPrices(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer group ID"})
+		return
+	}
+
+	var req SetGroupPricesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM customer_groups WHERE id = ?)", id).Scan(&exists); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Customer group not found"})
+		return
+	}
+
+	for _, price := range req.Prices {
+		_, err := tx.Exec(`
+			INSERT INTO customer_group_prices (customer_group_id, product_id, price) VALUES (?, ?, ?)
+			ON DUPLICATE KEY UPDATE price = VALUES(price)
+		`, id, price.ProductID, roundMoney(price.Price))
+		if isForeignKeyError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Product not found", "product_id": price.ProductID})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set group price"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit group prices"})
+		return
+	}
+	middleware.AuditChange(c, "customer_group", id, nil, req.Prices)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Group prices updated successfully", "updated": len(req.Prices)})
+}
+
+// DeleteCustomerGroupPrice takes a product off a group's price list
+// The group's percentage discount applies to it again.
+func (h *CustomerGroupHandler) DeleteCustomerGroupPrice(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer group ID"})
+		return
+	}
+	productID, err := strconv.Atoi(c.Param("product_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	result, err := h.db.Exec(
+		"DELETE FROM customer_group_prices WHERE customer_group_id = ? AND product_id = ?", id, productID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete group price"})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product is not on the group's price list"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Group price deleted successfully"})
+}
+
+// SetCustomerGroup moves a customer into a group, or out of any group
+func (h *CustomerHandler) SetCustomerGroup(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	var req SetCustomerGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var exists bool
+	err = h.db.QueryRow("SELECT EXISTS(SELECT 1 FROM customers WHERE id = ? AND is_active = 1)", id).Scan(&exists)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+		return
+	}
+
+	before := auditSnapshot(h.db, "customers", id)
+	_, err = h.db.Exec("UPDATE customers SET customer_group_id = ? WHERE id = ?", req.CustomerGroupID, id)
+	if isForeignKeyError(err) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Customer group not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update customer group"})
+		return
+	}
+	middleware.AuditChange(c, "customer", id, before, auditSnapshot(h.db, "customers", id))
+
+	c.JSON(http.StatusOK, gin.H{"customer_id": id, "customer_group_id": req.CustomerGroupID})
+}
+
+// GetCustomerPrices returns what the customer pays for each product in
+// product_ids (comma separated), so the till can price the cart as soon as the
+// customer is attached
+func (h *CustomerHandler) GetCustomerPrices(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	var productIDs []int
+	for _, field := range strings.Split(c.Query("product_ids"), ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+		productID, err := strconv.Atoi(field)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "product_ids must be a comma-separated list of product IDs"})
+			return
+		}
+		productIDs = append(productIDs, productID)
+	}
+	if len(productIDs) == 0 || len(productIDs) > 200 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "product_ids must list between 1 and 200 products"})
+		return
+	}
+
+	var exists bool
+	err = h.db.QueryRow("SELECT EXISTS(SELECT 1 FROM customers WHERE id = ? AND is_active = 1)", id).Scan(&exists)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+		return
+	}
+
+	group, err := customerGroupOf(h.db, &id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch customer group"})
+		return
+	}
+
+	in, args := inClause(productIDs)
+	rows, err := h.db.Query("SELECT id, price FROM products WHERE id IN ("+in+") ORDER BY id", args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch products"})
+		return
+	}
+	listPrices := map[int]float64{}
+	for rows.Next() {
+		var productID int
+		var listPrice float64
+		if err := rows.Scan(&productID, &listPrice); err != nil {
+			rows.Close()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan product data"})
+			return
+		}
+		listPrices[productID] = listPrice
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	prices := []ItemPrice{}
+	for _, productID := range productIDs {
+		listPrice, ok := listPrices[productID]
+		if !ok {
+			continue
+		}
+		unitPrice, source, err := groupPrice(h.db, group, productID, listPrice)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch group prices"})
+			return
+		}
+		prices = append(prices, ItemPrice{ProductID: productID, ListPrice: listPrice, UnitPrice: unitPrice, Source: source})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"customer_id": id, "customer_group": group, "prices": prices})
+}
+
+// customerGroupOf returns the active group a customer belongs to
+// Returns nil when there is no customer or it is in no active group.
+func customerGroupOf(q queryRower, customerID *int) (*CustomerGroup, error) {
+	if customerID == nil {
+		return nil, nil
+	}
+	group, err := scanCustomerGroup(q.QueryRow(`
+		SELECT g.id, g.code, g.name, g.discount_percent, g.is_active, g.created_at, g.updated_at
+		FROM customers c
+		JOIN customer_groups g ON g.id = c.customer_group_id
+		WHERE c.id = ? AND g.is_active = 1
+	`, *customerID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// groupPrice returns what a member of group pays for a product listed at
+// listPrice, and where that price comes from
+func groupPrice(q queryRower, group *CustomerGroup, productID int, listPrice float64) (float64, string, error) {
+	if group == nil {
+		return listPrice, PriceSourceList, nil
+	}
+	var price float64
+	err := q.QueryRow(
+		"SELECT price FROM customer_group_prices WHERE customer_group_id = ? AND product_id = ?", group.ID, productID,
+	).Scan(&price)
+	if err == nil {
+		return price, PriceSourcePriceList, nil
+	} else if err != sql.ErrNoRows {
+		return 0, "", err
+	}
+	if group.DiscountPercent > 0 {
+		return roundMoney(listPrice * (1 - group.DiscountPercent/100)), PriceSourceGroupDiscount, nil
+	}
+	return listPrice, PriceSourceList, nil
+}
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CustomerMetrics summarises a customer's completed purchases
+type CustomerMetrics struct {
+	LifetimeSpend      float64            `json:"lifetime_spend"`
+	SaleCount          int                `json:"sale_count"`
+	VisitCount         int                `json:"visit_count"` // days with at least one purchase
+	AverageBasket      float64            `json:"average_basket"`
+	FirstVisit         *time.Time         `json:"first_visit"`
+	LastVisit          *time.Time         `json:"last_visit"`
+	FavoriteCategories []FavoriteCategory `json:"favorite_categories"`
+	RFM                *RFMScore          `json:"rfm"`
+}
+
+// FavoriteCategory is a category the customer spends the most on
+type FavoriteCategory struct {
+	CategoryID int     `json:"category_id"`
+	Name       string  `json:"name"`
+	Quantity   int     `json:"quantity"`
+	Spend      float64 `json:"spend"`
+}
+
+// RFMScore ranks a customer's recency, frequency and monetary value from 1 to 5
+// against every other customer with a completed purchase
+type RFMScore struct {
+	Recency   int       `json:"recency"`
+	Frequency int       `json:"frequency"`
+	Monetary  int       `json:"monetary"`
+	Score     string    `json:"score"` // the three digits, e.g. "545"
+	Segment   string    `json:"segment"`
+	ScoredAt  time.Time `json:"scored_at"`
+}
+
+// favoriteCategoryLimit is how many favourite categories are reported
+const favoriteCategoryLimit = 3
+
+// GetCustomerSales lists a customer's sales, newest first, with their items and
+// payments, along with metrics worked out from every completed sale: lifetime
+// spend, visits, average basket, favourite categories and an RFM score.
+// Refunded and voided sales are listed but not counted. Page with page (from 1)
+// and page_size (default 20, at most 100).
+func (h *CustomerHandler) GetCustomerSales(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "page must be a positive number"})
+		return
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if err != nil || pageSize < 1 || pageSize > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "page_size must be between 1 and 100"})
+		return
+	}
+
+	var exists bool
+	err = h.db.QueryRow("SELECT EXISTS(SELECT 1 FROM customers WHERE id = ? AND is_active = 1)", id).Scan(&exists)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+		return
+	}
+
+	var total int
+	if err := h.db.QueryRow("SELECT COUNT(*) FROM sales WHERE customer_id = ?", id).Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sales"})
+		return
+	}
+
+	rows, err := h.db.Query(
+		"SELECT "+saleColumns+" FROM sales WHERE customer_id = ? ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?",
+		id, pageSize, (page-1)*pageSize,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sales"})
+		return
+	}
+	sales := []Sale{}
+	for rows.Next() {
+		sale, err := scanSale(rows)
+		if err != nil {
+			rows.Close()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan sale data"})
+			return
+		}
+		sales = append(sales, sale)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err := loadSaleLines(h.db, sales); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sale items"})
+		return
+	}
+
+	metrics, err := customerMetrics(h.db, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate customer metrics"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"customer_id": id,
+		"metrics":     metrics,
+		"sales":       sales,
+		"page":        page,
+		"page_size":   pageSize,
+		"total":       total,
+	})
+}
+
+// customerMetrics works out a customer's metrics from their completed sales
+func customerMetrics(db *sql.DB, customerID int) (*CustomerMetrics, error) {
+	metrics := &CustomerMetrics{FavoriteCategories: []FavoriteCategory{}}
+	var firstVisit, lastVisit sql.NullTime
+	err := db.QueryRow(`
+		SELECT COALESCE(SUM(total_amount), 0), COUNT(*), COUNT(DISTINCT DATE(created_at)),
+			MIN(created_at), MAX(created_at)
+		FROM sales
+		WHERE customer_id = ? AND payment_status = 'completed'
+	`, customerID).Scan(&metrics.LifetimeSpend, &metrics.SaleCount, &metrics.VisitCount, &firstVisit, &lastVisit)
+	if err != nil {
+		return nil, err
+	}
+	if metrics.SaleCount == 0 {
+		return metrics, nil
+	}
+	metrics.AverageBasket = roundMoney(metrics.LifetimeSpend / float64(metrics.SaleCount))
+	metrics.FirstVisit = &firstVisit.Time
+	metrics.LastVisit = &lastVisit.Time
+
+	rows, err := db.Query(`
+		SELECT cat.id, cat.name, SUM(si.quantity), SUM(si.subtotal) AS spend
+		FROM sales s
+		JOIN sale_items si ON si.sale_id = s.id
+		JOIN products p ON p.id = si.product_id
+		JOIN categories cat ON cat.id = p.category_id
+		WHERE s.customer_id = ? AND s.payment_status = 'completed'
+		GROUP BY cat.id, cat.name
+		ORDER BY spend DESC, cat.id
+		LIMIT ?
+	`, customerID, favoriteCategoryLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var category FavoriteCategory
+		if err := rows.Scan(&category.CategoryID, &category.Name, &category.Quantity, &category.Spend); err != nil {
+			return nil, err
+		}
+		metrics.FavoriteCategories = append(metrics.FavoriteCategories, category)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	metrics.RFM, err = customerRFM(db, customerID)
+	if err != nil {
+		return nil, err
+	}
+	return metrics, nil
+}
+
+// customerRFM reads the customer's score from the nightly RFM run
+// Customers whose first completed sale came after the last run have no score yet.
+func customerRFM(db *sql.DB, customerID int) (*RFMScore, error) {
+	var rfm RFMScore
+	err := db.QueryRow(`
+		SELECT recency, frequency, monetary, scored_at FROM customer_rfm_scores WHERE customer_id = ?
+	`, customerID).Scan(&rfm.Recency, &rfm.Frequency, &rfm.Monetary, &rfm.ScoredAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	rfm.Score = strconv.Itoa(rfm.Recency*100 + rfm.Frequency*10 + rfm.Monetary)
+	rfm.Segment = rfmSegment(rfm.Recency, rfm.Frequency, rfm.Monetary)
+	return &rfm, nil
+}
+
+// rfmSegment names the group a set of RFM scores falls into
+func rfmSegment(r, f, m int) string {
+	switch {
+	case r >= 4 && f >= 4 && m >= 4:
+		return "champion"
+	case r <= 2 && f >= 3:
+		return "at_risk"
+	case f >= 4:
+		return "loyal"
+	case r >= 4 && f <= 2:
+		return "new"
+	case r <= 2:
+		return "lost"
+	default:
+		return "regular"
+	}
+}
@@ -0,0 +1,345 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"sck-pos-backend/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DuplicateCustomerGroup is a set of active customers that look like one person
+type DuplicateCustomerGroup struct {
+	Match     string     `json:"match"` // phone, email or name
+	Value     string     `json:"value"`
+	Customers []Customer `json:"customers"`
+}
+
+// MergeCustomerRequest represents a customer merge request body
+type MergeCustomerRequest struct {
+	DuplicateID int `json:"duplicate_id" binding:"required"`
+}
+
+// GetDuplicateCustomers finds active customers sharing a phone number, an email
+// address or a name, strongest match first
+func (h *CustomerHandler) GetDuplicateCustomers(c *gin.Context) {
+	rows, err := h.db.Query(`
+		SELECT 'phone', phone_normalized, GROUP_CONCAT(id ORDER BY id)
+		FROM customers
+		WHERE is_active = 1 AND phone_normalized IS NOT NULL
+		GROUP BY phone_normalized
+		HAVING COUNT(*) > 1
+		UNION ALL
+		SELECT 'email', LOWER(TRIM(email)), GROUP_CONCAT(id ORDER BY id)
+		FROM customers
+		WHERE is_active = 1 AND email IS NOT NULL AND TRIM(email) <> ''
+		GROUP BY LOWER(TRIM(email))
+		HAVING COUNT(*) > 1
+		UNION ALL
+		SELECT 'name', LOWER(TRIM(name)), GROUP_CONCAT(id ORDER BY id)
+		FROM customers
+		WHERE is_active = 1
+		GROUP BY LOWER(TRIM(name))
+		HAVING COUNT(*) > 1
+		LIMIT 100
+	`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find duplicate customers"})
+		return
+	}
+
+	groups := []DuplicateCustomerGroup{}
+	var ids [][]int
+	for rows.Next() {
+		var group DuplicateCustomerGroup
+		var idList string
+		if err := rows.Scan(&group.Match, &group.Value, &idList); err != nil {
+			rows.Close()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan duplicate customers"})
+			return
+		}
+		var groupIDs []int
+		for _, id := range strings.Split(idList, ",") {
+			if n, err := strconv.Atoi(id); err == nil {
+				groupIDs = append(groupIDs, n)
+			}
+		}
+		groups = append(groups, group)
+		ids = append(ids, groupIDs)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	for i, groupIDs := range ids {
+		in, args := inClause(groupIDs)
+		rows, err := h.db.Query("SELECT "+customerColumns+" FROM customers WHERE id IN ("+in+") ORDER BY id", args...)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch customers"})
+			return
+		}
+		for rows.Next() {
+			customer, err := scanCustomer(rows)
+			if err != nil {
+				rows.Close()
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan customer data"})
+				return
+			}
+			groups[i].Customers = append(groups[i].Customers, customer)
+		}
+		rows.Close()
+	}
+
+	c.JSON(http.StatusOK, gin.H{"groups": groups})
+}
+
+// MergeCustomer folds a duplicate into the customer in the URL
+// The duplicate's sales, loyalty transactions, point balances, tier history and
+// consent records move across and its points are added to the kept customer's
+// total. Contact details, tax ID and customer group the kept customer lacks are
+// copied over. The duplicate is deactivated and remembers who it was merged
+// into. The combined spend counts towards the tier at the next nightly
+// evaluation.
+func (h *CustomerHandler) MergeCustomer(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	var req MergeCustomerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.DuplicateID == id {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A customer cannot be merged into itself"})
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock both customers in ID order so concurrent merges cannot deadlock
+	rows, err := tx.Query(
+		"SELECT id, loyalty_points FROM customers WHERE id IN (?, ?) AND is_active = 1 ORDER BY id FOR UPDATE",
+		id, req.DuplicateID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	points := map[int]int{}
+	for rows.Next() {
+		var customerID, balance int
+		if err := rows.Scan(&customerID, &balance); err != nil {
+			rows.Close()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		points[customerID] = balance
+	}
+	rows.Close()
+	if _, ok := points[id]; !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+		return
+	}
+	if _, ok := points[req.DuplicateID]; !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Duplicate customer not found"})
+		return
+	}
+
+	before := map[string]interface{}{
+		"customer":           auditSnapshot(tx, "customers", id),
+		"duplicate_customer": auditSnapshot(tx, "customers", req.DuplicateID),
+	}
+
+	result, err := tx.Exec("UPDATE sales SET customer_id = ? WHERE customer_id = ?", id, req.DuplicateID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move sales"})
+		return
+	}
+	salesMoved, _ := result.RowsAffected()
+
+	if err := mergeLoyalty(tx, id, req.DuplicateID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move loyalty points"})
+		return
+	}
+	if err := mergeConsents(tx, id, req.DuplicateID, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move consents"})
+		return
+	}
+
+	// Earlier merges into the duplicate now point at the kept customer too. The
+	// duplicate is deactivated first so its phone number is free to move across.
+	pointsMoved := points[req.DuplicateID]
+	_, err = tx.Exec(`
+		UPDATE customers SET loyalty_points = 0, is_active = 0, merged_into_id = ?
+		WHERE id = ? OR merged_into_id = ?
+	`, id, req.DuplicateID, req.DuplicateID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to deactivate duplicate customer"})
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE customers c
+		JOIN customers d ON d.id = ?
+		SET c.loyalty_points = c.loyalty_points + ?,
+			c.email = COALESCE(c.email, d.email),
+			c.phone = COALESCE(c.phone, d.phone),
+			c.phone_normalized = COALESCE(c.phone_normalized, d.phone_normalized),
+			c.address = COALESCE(c.address, d.address),
+			c.tax_id = COALESCE(c.tax_id, d.tax_id),
+			c.customer_group_id = COALESCE(c.customer_group_id, d.customer_group_id)
+		WHERE c.id = ?
+	`, req.DuplicateID, pointsMoved, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update customer"})
+		return
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO customer_merges (customer_id, merged_customer_id, points_moved, sales_moved, merged_by)
+		VALUES (?, ?, ?, ?, ?)
+	`, id, req.DuplicateID, pointsMoved, salesMoved, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record merge"})
+		return
+	}
+
+	after := map[string]interface{}{
+		"customer":           auditSnapshot(tx, "customers", id),
+		"duplicate_customer": auditSnapshot(tx, "customers", req.DuplicateID),
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit merge"})
+		return
+	}
+	middleware.AuditChange(c, "customer", id, before, after)
+	middleware.AuditDetails(c, fmt.Sprintf("merged customer #%d", req.DuplicateID))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":            "Customers merged successfully",
+		"customer_id":        id,
+		"merged_customer_id": req.DuplicateID,
+		"points_moved":       pointsMoved,
+		"sales_moved":        salesMoved,
+	})
+}
+
+// mergeLoyalty moves a duplicate customer's loyalty records to the kept customer
+// Point balances are unique per customer and earned date, so balances earned on
+// the same day are added together; when only one of the pair has expired, the
+// expired one is dropped, as its points no longer count.
+func mergeLoyalty(tx *sql.Tx, customerID, duplicateID int) error {
+	keep, dup := customerID, duplicateID
+	statements := []struct {
+		query string
+		args  []interface{}
+	}{
+		{`UPDATE loyalty_point_balances k
+		JOIN loyalty_point_balances d
+			ON d.customer_id = ? AND d.earned_date = k.earned_date AND d.is_expired = k.is_expired
+		SET k.points = k.points + d.points, k.expiry_date = GREATEST(k.expiry_date, d.expiry_date)
+		WHERE k.customer_id = ?`, []interface{}{dup, keep}},
+		{`DELETE d FROM loyalty_point_balances d
+		JOIN loyalty_point_balances k
+			ON k.customer_id = ? AND k.earned_date = d.earned_date AND k.is_expired = d.is_expired
+		WHERE d.customer_id = ?`, []interface{}{keep, dup}},
+		{`DELETE x FROM loyalty_point_balances x
+		JOIN loyalty_point_balances y
+			ON y.earned_date = x.earned_date AND y.customer_id IN (?, ?) AND y.customer_id <> x.customer_id
+		WHERE x.customer_id IN (?, ?) AND x.is_expired = TRUE AND y.is_expired = FALSE`, []interface{}{keep, dup, keep, dup}},
+		{"UPDATE loyalty_point_balances SET customer_id = ? WHERE customer_id = ?", []interface{}{keep, dup}},
+		{`DELETE d FROM loyalty_expiry_notifications d
+		JOIN loyalty_expiry_notifications k ON k.customer_id = ? AND k.expiry_date = d.expiry_date
+		WHERE d.customer_id = ?`, []interface{}{keep, dup}},
+		{"UPDATE loyalty_expiry_notifications SET customer_id = ? WHERE customer_id = ?", []interface{}{keep, dup}},
+		{"UPDATE loyalty_point_transactions SET customer_id = ? WHERE customer_id = ?", []interface{}{keep, dup}},
+		{"UPDATE loyalty_tier_history SET customer_id = ? WHERE customer_id = ?", []interface{}{keep, dup}},
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement.query, statement.args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeConsents moves a duplicate customer's consent history to the kept customer
+// A withdrawal by either customer wins: when the newest moved row would grant
+// a purpose one of them had withdrawn, a withdrawal is recorded on top.
+func mergeConsents(tx *sql.Tx, customerID, duplicateID, userID int) error {
+	kept, err := consentHistory(tx, customerID)
+	if err != nil {
+		return err
+	}
+	duplicate, err := consentHistory(tx, duplicateID)
+	if err != nil {
+		return err
+	}
+	withdrawn := map[string]bool{}
+	for _, consent := range append(currentConsents(kept), currentConsents(duplicate)...) {
+		if consent.RecordedAt != nil && !consent.Granted {
+			withdrawn[consent.Purpose] = true
+		}
+	}
+
+	_, err = tx.Exec("UPDATE customer_consents SET customer_id = ? WHERE customer_id = ?", customerID, duplicateID)
+	if err != nil {
+		return err
+	}
+	merged, err := consentHistory(tx, customerID)
+	if err != nil {
+		return err
+	}
+	for _, consent := range currentConsents(merged) {
+		if !consent.Granted || !withdrawn[consent.Purpose] {
+			continue
+		}
+		_, err := tx.Exec(`
+			INSERT INTO customer_consents (customer_id, purpose, granted, source, recorded_by)
+			VALUES (?, ?, FALSE, 'merge', ?)
+		`, customerID, consent.Purpose, userID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// survivingCustomerID returns the customer that now holds id's account: id
+// itself, or the customer it was merged into. Returns 0 if id does not exist
+// or has been erased.
+func survivingCustomerID(q queryRower, id int) (int, error) {
+	var mergedInto sql.NullInt64
+	var erased bool
+	err := q.QueryRow("SELECT merged_into_id, erased_at IS NOT NULL FROM customers WHERE id = ?", id).Scan(&mergedInto, &erased)
+	if err == sql.ErrNoRows || (err == nil && erased) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	if mergedInto.Valid {
+		return int(mergedInto.Int64), nil
+	}
+	return id, nil
+}
@@ -0,0 +1,390 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"sck-pos-backend/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// consentPurposes are the uses of personal data a customer can agree to
+var consentPurposes = []string{"marketing", "loyalty", "email_receipts"}
+
+// CustomerConsent is a customer's answer for one purpose
+// A purpose that was never asked about is reported as not granted, with no
+// recorded_at.
+type CustomerConsent struct {
+	ID         int        `json:"id,omitempty"`
+	Purpose    string     `json:"purpose"`
+	Granted    bool       `json:"granted"`
+	Source     *string    `json:"source,omitempty"`
+	RecordedBy *int       `json:"recorded_by,omitempty"`
+	RecordedAt *time.Time `json:"recorded_at"`
+}
+
+// UpdateConsentsRequest sets one or more consent purposes, e.g.
+// {"consents": {"marketing": false, "email_receipts": true}, "source": "pos"}
+type UpdateConsentsRequest struct {
+	Consents map[string]bool `json:"consents" binding:"required"`
+	Source   string          `json:"source"`
+}
+
+// GetCustomerConsents returns the customer's current consent for each purpose
+// and every grant and withdrawal behind it, newest first
+func (h *CustomerHandler) GetCustomerConsents(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	var exists bool
+	if err := h.db.QueryRow("SELECT EXISTS(SELECT 1 FROM customers WHERE id = ?)", id).Scan(&exists); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+		return
+	}
+
+	history, err := consentHistory(h.db, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch consents"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"customer_id": id,
+		"consents":    currentConsents(history),
+		"history":     history,
+	})
+}
+
+// UpdateCustomerConsents records the customer's answers for the given purposes
+// Only answers that change the current state are stored, so re-sending the
+// same form does not clutter the history.
+func (h *CustomerHandler) UpdateCustomerConsents(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	var req UpdateConsentsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Consents) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one consent is required"})
+		return
+	}
+	for purpose := range req.Consents {
+		if !isConsentPurpose(purpose) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":    fmt.Sprintf("Unknown consent purpose %q", purpose),
+				"purposes": consentPurposes,
+			})
+			return
+		}
+	}
+	source := strings.TrimSpace(req.Source)
+	if source == "" {
+		source = "pos"
+	} else if len(source) > 50 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "source must be at most 50 characters"})
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock the customer so two tills recording answers at once keep a clean history
+	var locked int
+	err = tx.QueryRow("SELECT id FROM customers WHERE id = ? AND is_active = 1 FOR UPDATE", id).Scan(&locked)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	history, err := consentHistory(tx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch consents"})
+		return
+	}
+
+	var changes []string
+	for _, current := range currentConsents(history) {
+		granted, ok := req.Consents[current.Purpose]
+		if !ok || (current.RecordedAt != nil && current.Granted == granted) {
+			continue
+		}
+		_, err := tx.Exec(`
+			INSERT INTO customer_consents (customer_id, purpose, granted, source, recorded_by)
+			VALUES (?, ?, ?, ?, ?)
+		`, id, current.Purpose, granted, source, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record consent"})
+			return
+		}
+		if granted {
+			changes = append(changes, current.Purpose+" granted")
+		} else {
+			changes = append(changes, current.Purpose+" withdrawn")
+		}
+	}
+
+	if history, err = consentHistory(tx, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch consents"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit consents"})
+		return
+	}
+	if len(changes) > 0 {
+		middleware.AuditDetails(c, "consent: "+strings.Join(changes, ", ")+" via "+source)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"customer_id": id,
+		"consents":    currentConsents(history),
+		"changed":     len(changes),
+	})
+}
+
+// ExportCustomerData returns everything held on a customer as one JSON document,
+// for a data-subject access request: the customer row, customers merged into
+// it, consents, sales with their items and payments, and the loyalty ledger.
+// It is a POST so every export lands in the audit trail.
+func (h *CustomerHandler) ExportCustomerData(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	customers, err := rowMaps(h.db, "SELECT * FROM customers WHERE id = ?", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export customer"})
+		return
+	}
+	if len(customers) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+		return
+	}
+
+	export := gin.H{
+		"exported_at": time.Now(),
+		"customer":    customers[0],
+	}
+	sections := []struct {
+		name  string
+		query string
+		args  []interface{}
+	}{
+		{"merged_customers", "SELECT * FROM customers WHERE merged_into_id = ? ORDER BY id", []interface{}{id}},
+		{"merges", "SELECT * FROM customer_merges WHERE customer_id = ? OR merged_customer_id = ? ORDER BY id", []interface{}{id, id}},
+		{"consents", "SELECT * FROM customer_consents WHERE customer_id = ? ORDER BY id", []interface{}{id}},
+		{"sales", "SELECT * FROM sales WHERE customer_id = ? ORDER BY id", []interface{}{id}},
+		{"sale_items", `SELECT si.* FROM sale_items si JOIN sales s ON s.id = si.sale_id
+			WHERE s.customer_id = ? ORDER BY si.id`, []interface{}{id}},
+		{"payments", `SELECT pd.* FROM payment_details pd JOIN sales s ON s.id = pd.sale_id
+			WHERE s.customer_id = ? ORDER BY pd.id`, []interface{}{id}},
+		{"loyalty_transactions", "SELECT * FROM loyalty_point_transactions WHERE customer_id = ? ORDER BY id", []interface{}{id}},
+		{"loyalty_balances", "SELECT * FROM loyalty_point_balances WHERE customer_id = ? ORDER BY id", []interface{}{id}},
+		{"loyalty_tier_history", "SELECT * FROM loyalty_tier_history WHERE customer_id = ? ORDER BY id", []interface{}{id}},
+		{"loyalty_expiry_notifications", "SELECT * FROM loyalty_expiry_notifications WHERE customer_id = ? ORDER BY id", []interface{}{id}},
+		{"segment_snapshots", "SELECT * FROM customer_segment_snapshot_members WHERE customer_id = ? ORDER BY snapshot_id", []interface{}{id}},
+	}
+	for _, section := range sections {
+		rows, err := rowMaps(h.db, section.query, section.args...)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export " + section.name})
+			return
+		}
+		export[section.name] = rows
+	}
+
+	middleware.AuditDetails(c, "customer data exported")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="customer-%d-export.json"`, id))
+	c.JSON(http.StatusOK, export)
+}
+
+// EraseCustomer anonymizes a customer's personal data at their request
+// Name, email, phone, address and tax ID are cleared, along with those of any
+// duplicates merged into the customer, and every consent is withdrawn. Sales,
+// payments and the loyalty ledger keep pointing at the anonymized row so the
+// books still balance. The audit entry holds only the anonymized row, so
+// erasing does not copy the data into the append-only log.
+func (h *CustomerHandler) EraseCustomer(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	var erasedAt sql.NullTime
+	err = tx.QueryRow("SELECT erased_at FROM customers WHERE id = ? FOR UPDATE", id).Scan(&erasedAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if erasedAt.Valid {
+		c.JSON(http.StatusConflict, gin.H{"error": "Customer has already been erased", "erased_at": erasedAt.Time})
+		return
+	}
+
+	result, err := tx.Exec(`
+		UPDATE customers
+		SET name = CONCAT('Erased customer #', id), email = NULL, phone = NULL, phone_normalized = NULL,
+			address = NULL, tax_id = NULL, is_active = 0, erased_at = NOW(), erased_by = ?
+		WHERE (id = ? OR merged_into_id = ?) AND erased_at IS NULL
+	`, userID, id, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to erase customer"})
+		return
+	}
+	erased, _ := result.RowsAffected()
+
+	for _, purpose := range consentPurposes {
+		_, err := tx.Exec(`
+			INSERT INTO customer_consents (customer_id, purpose, granted, source, recorded_by)
+			VALUES (?, ?, FALSE, 'erasure', ?)
+		`, id, purpose, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to withdraw consents"})
+			return
+		}
+	}
+
+	after := auditSnapshot(tx, "customers", id)
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit erasure"})
+		return
+	}
+	middleware.AuditChange(c, "customer", id, nil, after)
+	middleware.AuditDetails(c, fmt.Sprintf("customer personal data erased (%d customer records)", erased))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "Customer personal data erased",
+		"customer_id":      id,
+		"customers_erased": erased,
+	})
+}
+
+// consentHistory lists a customer's consent records, newest first
+func consentHistory(q interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}, customerID int) ([]CustomerConsent, error) {
+	rows, err := q.Query(`
+		SELECT id, purpose, granted, source, recorded_by, created_at
+		FROM customer_consents
+		WHERE customer_id = ?
+		ORDER BY id DESC
+	`, customerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []CustomerConsent{}
+	for rows.Next() {
+		var consent CustomerConsent
+		var recordedBy sql.NullInt64
+		var recordedAt time.Time
+		err := rows.Scan(&consent.ID, &consent.Purpose, &consent.Granted, &consent.Source, &recordedBy, &recordedAt)
+		if err != nil {
+			return nil, err
+		}
+		if recordedBy.Valid {
+			by := int(recordedBy.Int64)
+			consent.RecordedBy = &by
+		}
+		consent.RecordedAt = &recordedAt
+		history = append(history, consent)
+	}
+	return history, rows.Err()
+}
+
+// currentConsents picks the newest answer for each purpose from a history
+// listed newest first
+func currentConsents(history []CustomerConsent) []CustomerConsent {
+	consents := make([]CustomerConsent, 0, len(consentPurposes))
+	for _, purpose := range consentPurposes {
+		current := CustomerConsent{Purpose: purpose}
+		for _, consent := range history {
+			if consent.Purpose == purpose {
+				current = consent
+				break
+			}
+		}
+		consents = append(consents, current)
+	}
+	return consents
+}
+
+// isConsentPurpose reports whether purpose is one customers can consent to
+func isConsentPurpose(purpose string) bool {
+	for _, p := range consentPurposes {
+		if p == purpose {
+			return true
+		}
+	}
+	return false
+}
+
+// rowMaps runs a query and returns each row as a column map
+func rowMaps(db *sql.DB, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []map[string]interface{}{}
+	for rows.Next() {
+		row, err := scanRowMap(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,496 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"sck-pos-backend/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CustomerSegmentHandler handles customer segment and snapshot requests
+type CustomerSegmentHandler struct {
+	db *sql.DB
+}
+
+// NewCustomerSegmentHandler creates a new customer segment handler
+func NewCustomerSegmentHandler(db *sql.DB) *CustomerSegmentHandler {
+	return &CustomerSegmentHandler{db: db}
+}
+
+// SegmentRules selects active customers; every rule given must match
+// Spend and sale counts come from completed sales in the last SpendDays days,
+// or from every completed sale when SpendDays is 0. No rules select every
+// active customer.
+type SegmentRules struct {
+	MinSpend         *float64 `json:"min_spend,omitempty"`
+	MaxSpend         *float64 `json:"max_spend,omitempty"`
+	SpendDays        int      `json:"spend_days,omitempty"`
+	MinSales         *int     `json:"min_sales,omitempty"`
+	LastPurchaseDays *int     `json:"last_purchase_days,omitempty"` // bought within this many days
+	InactiveDays     *int     `json:"inactive_days,omitempty"`      // has not bought for at least this many days
+	Tiers            []string `json:"tiers,omitempty"`              // loyalty tier codes
+	CustomerGroupIDs []int    `json:"customer_group_ids,omitempty"`
+	MarketingConsent bool     `json:"marketing_consent,omitempty"` // only customers who currently agree to marketing; always on for snapshots
+}
+
+// CustomerSegment is a named set of rules for picking customers
+type CustomerSegment struct {
+	ID          int          `json:"id"`
+	Name        string       `json:"name"`
+	Description *string      `json:"description"`
+	Rules       SegmentRules `json:"rules"`
+	CreatedBy   *int         `json:"created_by"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+}
+
+// SegmentSnapshot is the customers a segment matched at one moment
+type SegmentSnapshot struct {
+	ID            int          `json:"id"`
+	SegmentID     int          `json:"segment_id"`
+	Rules         SegmentRules `json:"rules"`
+	CustomerCount int          `json:"customer_count"`
+	CreatedBy     *int         `json:"created_by"`
+	CreatedAt     time.Time    `json:"created_at"`
+}
+
+// CustomerSegmentRequest represents create and update segment request bodies
+type CustomerSegmentRequest struct {
+	Name        string       `json:"name" binding:"required,max=100"`
+	Description *string      `json:"description"`
+	Rules       SegmentRules `json:"rules"`
+}
+
+const customerSegmentColumns = `id, name, description, rules, created_by, created_at, updated_at`
+
+// scanCustomerSegment reads a row selected with customerSegmentColumns
+func scanCustomerSegment(row interface{ Scan(...interface{}) error }) (CustomerSegment, error) {
+	var segment CustomerSegment
+	var rules []byte
+	err := row.Scan(
+		&segment.ID, &segment.Name, &segment.Description, &rules, &segment.CreatedBy, &segment.CreatedAt, &segment.UpdatedAt,
+	)
+	if err != nil {
+		return segment, err
+	}
+	return segment, json.Unmarshal(rules, &segment.Rules)
+}
+
+const segmentSnapshotColumns = `id, segment_id, rules, customer_count, created_by, created_at`
+
+// scanSegmentSnapshot reads a row selected with segmentSnapshotColumns
+func scanSegmentSnapshot(row interface{ Scan(...interface{}) error }) (SegmentSnapshot, error) {
+	var snapshot SegmentSnapshot
+	var rules []byte
+	err := row.Scan(
+		&snapshot.ID, &snapshot.SegmentID, &rules, &snapshot.CustomerCount, &snapshot.CreatedBy, &snapshot.CreatedAt,
+	)
+	if err != nil {
+		return snapshot, err
+	}
+	return snapshot, json.Unmarshal(rules, &snapshot.Rules)
+}
+
+// GetCustomerSegments lists customer segments by name
+func (h *CustomerSegmentHandler) GetCustomerSegments(c *gin.Context) {
+	rows, err := h.db.Query("SELECT " + customerSegmentColumns + " FROM customer_segments ORDER BY name")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch customer segments"})
+		return
+	}
+	segments := []CustomerSegment{}
+	for rows.Next() {
+		segment, err := scanCustomerSegment(rows)
+		if err != nil {
+			rows.Close()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan customer segment data"})
+			return
+		}
+		segments = append(segments, segment)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"customer_segments": segments})
+}
+
+// CreateCustomerSegment saves a segment and reports how many customers it matches now
+func (h *CustomerSegmentHandler) CreateCustomerSegment(c *gin.Context) {
+	var req CustomerSegmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !h.checkSegmentRules(c, req.Rules) {
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	rules, _ := json.Marshal(req.Rules)
+	result, err := h.db.Exec(`
+		INSERT INTO customer_segments (name, description, rules, created_by) VALUES (?, ?, ?, ?)
+	`, strings.TrimSpace(req.Name), req.Description, string(rules), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create customer segment"})
+		return
+	}
+	id, _ := result.LastInsertId()
+	middleware.AuditChange(c, "customer_segment", id, nil, auditSnapshot(h.db, "customer_segments", id))
+
+	h.respondSegment(c, http.StatusCreated, int(id))
+}
+
+// UpdateCustomerSegment changes a segment's name, description or rules
+// Snapshots already taken keep the rules they were taken with.
+func (h *CustomerSegmentHandler) UpdateCustomerSegment(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid segment ID"})
+		return
+	}
+
+	var req CustomerSegmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !h.checkSegmentRules(c, req.Rules) {
+		return
+	}
+
+	before := auditSnapshot(h.db, "customer_segments", id)
+	if before == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Customer segment not found"})
+		return
+	}
+
+	rules, _ := json.Marshal(req.Rules)
+	_, err = h.db.Exec(`
+		UPDATE customer_segments SET name = ?, description = ?, rules = ? WHERE id = ?
+	`, strings.TrimSpace(req.Name), req.Description, string(rules), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update customer segment"})
+		return
+	}
+	middleware.AuditChange(c, "customer_segment", id, before, auditSnapshot(h.db, "customer_segments", id))
+
+	h.respondSegment(c, http.StatusOK, id)
+}
+
+// respondSegment sends a segment with the number of customers it matches now
+func (h *CustomerSegmentHandler) respondSegment(c *gin.Context, status, id int) {
+	segment, err := scanCustomerSegment(h.db.QueryRow("SELECT "+customerSegmentColumns+" FROM customer_segments WHERE id = ?", id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch customer segment"})
+		return
+	}
+
+	query, args := segmentQuery(segment.Rules)
+	var count int
+	if err := h.db.QueryRow("SELECT COUNT(*) FROM ("+query+") matched", args...).Scan(&count); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count segment customers"})
+		return
+	}
+
+	c.JSON(status, gin.H{"customer_segment": segment, "matching_customers": count})
+}
+
+// CreateSegmentSnapshot records which customers the segment matches right now
+// A campaign sent to a snapshot can later be traced to exactly who was in it.
+// Snapshots are for campaigns, so they only ever hold customers who currently
+// agree to marketing, whatever the segment's own rules say.
+func (h *CustomerSegmentHandler) CreateSegmentSnapshot(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid segment ID"})
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	segment, err := scanCustomerSegment(tx.QueryRow("SELECT "+customerSegmentColumns+" FROM customer_segments WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Customer segment not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch customer segment"})
+		return
+	}
+
+	snapshotRules := segment.Rules
+	snapshotRules.MarketingConsent = true
+	rules, _ := json.Marshal(snapshotRules)
+	result, err := tx.Exec(`
+		INSERT INTO customer_segment_snapshots (segment_id, rules, customer_count, created_by) VALUES (?, ?, 0, ?)
+	`, id, string(rules), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create snapshot"})
+		return
+	}
+	snapshotID, _ := result.LastInsertId()
+
+	query, args := segmentQuery(snapshotRules)
+	result, err = tx.Exec(
+		"INSERT INTO customer_segment_snapshot_members (snapshot_id, customer_id) SELECT ?, id FROM ("+query+") matched",
+		append([]interface{}{snapshotID}, args...)...,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record snapshot customers"})
+		return
+	}
+	count, _ := result.RowsAffected()
+
+	if _, err := tx.Exec("UPDATE customer_segment_snapshots SET customer_count = ? WHERE id = ?", count, snapshotID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create snapshot"})
+		return
+	}
+
+	snapshot, err := scanSegmentSnapshot(tx.QueryRow("SELECT "+segmentSnapshotColumns+" FROM customer_segment_snapshots WHERE id = ?", snapshotID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch snapshot"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit snapshot"})
+		return
+	}
+	middleware.AuditDetails(c, fmt.Sprintf("snapshot #%d of segment %q with %d customers", snapshotID, segment.Name, count))
+
+	c.JSON(http.StatusCreated, snapshot)
+}
+
+// GetSegmentSnapshots lists a segment's snapshots, newest first
+func (h *CustomerSegmentHandler) GetSegmentSnapshots(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid segment ID"})
+		return
+	}
+
+	rows, err := h.db.Query(
+		"SELECT "+segmentSnapshotColumns+" FROM customer_segment_snapshots WHERE segment_id = ? ORDER BY id DESC LIMIT 100", id,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch snapshots"})
+		return
+	}
+	defer rows.Close()
+
+	snapshots := []SegmentSnapshot{}
+	for rows.Next() {
+		snapshot, err := scanSegmentSnapshot(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan snapshot data"})
+			return
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"snapshots": snapshots})
+}
+
+// GetSegmentSnapshot returns a snapshot and a page of its customers
+// Page with page (from 1) and page_size (default 100, at most 500).
+func (h *CustomerSegmentHandler) GetSegmentSnapshot(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid snapshot ID"})
+		return
+	}
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "page must be a positive number"})
+		return
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", "100"))
+	if err != nil || pageSize < 1 || pageSize > 500 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "page_size must be between 1 and 500"})
+		return
+	}
+
+	snapshot, err := scanSegmentSnapshot(h.db.QueryRow("SELECT "+segmentSnapshotColumns+" FROM customer_segment_snapshots WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Snapshot not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch snapshot"})
+		return
+	}
+
+	// Customers erased since the snapshot are listed by ID with their anonymized details
+	rows, err := h.db.Query(`
+		SELECT `+customerColumns+`
+		FROM customer_segment_snapshot_members m
+		JOIN customers ON customers.id = m.customer_id
+		WHERE m.snapshot_id = ?
+		ORDER BY m.customer_id
+		LIMIT ? OFFSET ?
+	`, id, pageSize, (page-1)*pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch snapshot customers"})
+		return
+	}
+	defer rows.Close()
+
+	customers := []Customer{}
+	for rows.Next() {
+		customer, err := scanCustomer(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan customer data"})
+			return
+		}
+		customers = append(customers, customer)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"snapshot":  snapshot,
+		"customers": customers,
+		"page":      page,
+		"page_size": pageSize,
+		"total":     snapshot.CustomerCount,
+	})
+}
+
+// checkSegmentRules rejects rules that cannot match sensibly
+// Responds and returns false when the rules are invalid.
+func (h *CustomerSegmentHandler) checkSegmentRules(c *gin.Context, rules SegmentRules) bool {
+	invalid := func(message string) bool {
+		c.JSON(http.StatusBadRequest, gin.H{"error": message})
+		return false
+	}
+	switch {
+	case rules.MinSpend != nil && *rules.MinSpend < 0, rules.MaxSpend != nil && *rules.MaxSpend < 0:
+		return invalid("Spend limits cannot be negative")
+	case rules.MinSpend != nil && rules.MaxSpend != nil && *rules.MinSpend > *rules.MaxSpend:
+		return invalid("min_spend cannot be more than max_spend")
+	case rules.SpendDays < 0, rules.MinSales != nil && *rules.MinSales < 0,
+		rules.LastPurchaseDays != nil && *rules.LastPurchaseDays < 0, rules.InactiveDays != nil && *rules.InactiveDays < 0:
+		return invalid("Day and sale counts cannot be negative")
+	}
+
+	for _, tier := range rules.Tiers {
+		var exists bool
+		if err := h.db.QueryRow("SELECT EXISTS(SELECT 1 FROM loyalty_tiers WHERE code = ?)", tier).Scan(&exists); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return false
+		}
+		if !exists {
+			return invalid(fmt.Sprintf("Unknown loyalty tier %q", tier))
+		}
+	}
+	for _, groupID := range rules.CustomerGroupIDs {
+		var exists bool
+		if err := h.db.QueryRow("SELECT EXISTS(SELECT 1 FROM customer_groups WHERE id = ?)", groupID).Scan(&exists); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return false
+		}
+		if !exists {
+			return invalid(fmt.Sprintf("Unknown customer group %d", groupID))
+		}
+	}
+	return true
+}
+
+// segmentQuery builds a query selecting the id of every customer the rules match
+func segmentQuery(rules SegmentRules) (string, []interface{}) {
+	var args []interface{}
+	spendWindow := ""
+	if rules.SpendDays > 0 {
+		spendWindow = "AND created_at >= NOW() - INTERVAL ? DAY"
+		args = append(args, rules.SpendDays)
+	}
+
+	query := `
+		SELECT c.id
+		FROM customers c
+		LEFT JOIN (
+			SELECT customer_id, SUM(total_amount) AS spend, COUNT(*) AS sale_count
+			FROM sales
+			WHERE customer_id IS NOT NULL AND payment_status = 'completed' ` + spendWindow + `
+			GROUP BY customer_id
+		) w ON w.customer_id = c.id
+		LEFT JOIN (
+			SELECT customer_id, MAX(created_at) AS last_purchase
+			FROM sales
+			WHERE customer_id IS NOT NULL AND payment_status = 'completed'
+			GROUP BY customer_id
+		) lp ON lp.customer_id = c.id
+	`
+	conditions := []string{"c.is_active = 1"}
+
+	if rules.MinSpend != nil {
+		conditions = append(conditions, "COALESCE(w.spend, 0) >= ?")
+		args = append(args, *rules.MinSpend)
+	}
+	if rules.MaxSpend != nil {
+		conditions = append(conditions, "COALESCE(w.spend, 0) <= ?")
+		args = append(args, *rules.MaxSpend)
+	}
+	if rules.MinSales != nil {
+		conditions = append(conditions, "COALESCE(w.sale_count, 0) >= ?")
+		args = append(args, *rules.MinSales)
+	}
+	if rules.LastPurchaseDays != nil {
+		conditions = append(conditions, "lp.last_purchase >= NOW() - INTERVAL ? DAY")
+		args = append(args, *rules.LastPurchaseDays)
+	}
+	if rules.InactiveDays != nil {
+		conditions = append(conditions, "(lp.last_purchase IS NULL OR lp.last_purchase < NOW() - INTERVAL ? DAY)")
+		args = append(args, *rules.InactiveDays)
+	}
+	if len(rules.Tiers) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(rules.Tiers)), ", ")
+		conditions = append(conditions, "c.loyalty_tier IN ("+placeholders+")")
+		for _, tier := range rules.Tiers {
+			args = append(args, tier)
+		}
+	}
+	if len(rules.CustomerGroupIDs) > 0 {
+		in, groupArgs := inClause(rules.CustomerGroupIDs)
+		conditions = append(conditions, "c.customer_group_id IN ("+in+")")
+		args = append(args, groupArgs...)
+	}
+	if rules.MarketingConsent {
+		conditions = append(conditions, `(
+			SELECT cc.granted FROM customer_consents cc
+			WHERE cc.customer_id = c.id AND cc.purpose = 'marketing'
+			ORDER BY cc.id DESC LIMIT 1
+		) = TRUE`)
+	}
+
+	return query + " WHERE " + strings.Join(conditions, " AND "), args
+}
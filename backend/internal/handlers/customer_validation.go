@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+
+	"sck-pos-backend/internal/phone"
+	"sck-pos-backend/internal/thaiid"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Column sizes in the customers table
+const (
+	maxCustomerNameLength  = 100
+	maxCustomerEmailLength = 100
+	maxCustomerPhoneLength = 20
+)
+
+// fieldErrors maps a request field to what is wrong with it
+type fieldErrors map[string]string
+
+// respond answers 422 with every invalid field, e.g.
+// {"error": "Validation failed", "fields": {"email": "must be a valid email address"}}
+func (e fieldErrors) respond(c *gin.Context) {
+	c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Validation failed", "fields": e})
+}
+
+// normalizeCustomer tidies a customer's fields and checks them before saving
+// Text is trimmed and blank optional fields become null. The email is
+// lowercased, the phone must be a Thai mobile number (or a foreign number with
+// its country code) and gets its E.164 form, and the tax ID is stored as 13
+// digits once its check digit is verified. Returns nil when every field is valid.
+func normalizeCustomer(customer *Customer) fieldErrors {
+	errs := fieldErrors{}
+
+	customer.Name = strings.TrimSpace(customer.Name)
+	switch {
+	case customer.Name == "":
+		errs["name"] = "is required"
+	case utf8.RuneCountInString(customer.Name) > maxCustomerNameLength:
+		errs["name"] = fmt.Sprintf("must be at most %d characters", maxCustomerNameLength)
+	}
+
+	customer.Email = trimmedOrNil(customer.Email)
+	if customer.Email != nil {
+		email := strings.ToLower(*customer.Email)
+		customer.Email = &email
+		if len(email) > maxCustomerEmailLength {
+			errs["email"] = fmt.Sprintf("must be at most %d characters", maxCustomerEmailLength)
+		} else if !validEmail(email) {
+			errs["email"] = "must be a valid email address"
+		}
+	}
+
+	customer.Phone = trimmedOrNil(customer.Phone)
+	customer.PhoneNormalized = nil
+	if customer.Phone != nil {
+		normalized := phone.Normalize(*customer.Phone)
+		switch {
+		case len(*customer.Phone) > maxCustomerPhoneLength:
+			errs["phone"] = fmt.Sprintf("must be at most %d characters", maxCustomerPhoneLength)
+		case normalized == "":
+			errs["phone"] = "must be a phone number, e.g. 081-234-5678 or +66 81 234 5678"
+		case phone.IsThai(normalized) && !phone.IsThaiMobile(normalized):
+			errs["phone"] = "must be a Thai mobile number starting 06, 08 or 09"
+		default:
+			customer.PhoneNormalized = &normalized
+		}
+	}
+
+	customer.Address = trimmedOrNil(customer.Address)
+
+	customer.TaxID = trimmedOrNil(customer.TaxID)
+	if customer.TaxID != nil {
+		if id := thaiid.Normalize(*customer.TaxID); id != "" {
+			customer.TaxID = &id
+		} else {
+			errs["tax_id"] = "must be a 13-digit Thai national ID or tax ID with a valid check digit"
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// checkPhoneAvailable reports the phone as taken when another active customer
+// already has it
+func checkPhoneAvailable(q queryRower, customer *Customer) (fieldErrors, error) {
+	if customer.PhoneNormalized == nil {
+		return nil, nil
+	}
+	var ownerID int
+	err := q.QueryRow(
+		"SELECT id FROM customers WHERE phone_normalized = ? AND is_active = 1 AND id <> ? LIMIT 1",
+		*customer.PhoneNormalized, customer.ID,
+	).Scan(&ownerID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return fieldErrors{"phone": fmt.Sprintf("is already used by customer #%d", ownerID)}, nil
+}
+
+// changedCustomerFields names the personal fields an update changes
+// The audit trail records these names since it never stores the values.
+func changedCustomerFields(q queryRower, customer *Customer) ([]string, error) {
+	var current Customer
+	err := q.QueryRow(
+		"SELECT name, email, phone, address, tax_id FROM customers WHERE id = ?", customer.ID,
+	).Scan(&current.Name, &current.Email, &current.Phone, &current.Address, &current.TaxID)
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	if current.Name != customer.Name {
+		changed = append(changed, "name")
+	}
+	for _, field := range []struct {
+		name          string
+		before, after *string
+	}{
+		{"email", current.Email, customer.Email},
+		{"phone", current.Phone, customer.Phone},
+		{"address", current.Address, customer.Address},
+		{"tax_id", current.TaxID, customer.TaxID},
+	} {
+		if (field.before == nil) != (field.after == nil) || (field.before != nil && *field.before != *field.after) {
+			changed = append(changed, field.name)
+		}
+	}
+	return changed, nil
+}
+
+// phoneTaken is the field error for a save that lost a race for the phone number
+var phoneTaken = fieldErrors{"phone": "is already used by another customer"}
+
+// validEmail reports whether s is a bare address with a dotted domain
+func validEmail(s string) bool {
+	address, err := mail.ParseAddress(s)
+	if err != nil || address.Address != s || address.Name != "" {
+		return false
+	}
+	domain := s[strings.LastIndex(s, "@")+1:]
+	return strings.Contains(domain, ".") && !strings.HasPrefix(domain, ".") && !strings.HasSuffix(domain, ".")
+}
+
+// trimmedOrNil trims s, returning nil when nothing is left
+func trimmedOrNil(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	trimmed := strings.TrimSpace(*s)
+	if trimmed == "" {
+		return nil
+	}
+	return &trimmed
+}
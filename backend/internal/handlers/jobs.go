@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JobHandler handles background job related requests
+type JobHandler struct {
+	db *sql.DB
+}
+
+// NewJobHandler creates a new job handler
+func NewJobHandler(db *sql.DB) *JobHandler {
+	return &JobHandler{db: db}
+}
+
+// JobRun represents a recorded scheduled job execution
+type JobRun struct {
+	ID           int        `json:"id"`
+	JobName      string     `json:"job_name"`
+	InstanceID   string     `json:"instance_id"`
+	Status       string     `json:"status"`
+	StartedAt    time.Time  `json:"started_at"`
+	FinishedAt   *time.Time `json:"finished_at,omitempty"`
+	ErrorMessage *string    `json:"error_message,omitempty"`
+}
+
+// GetJobRuns retrieves recent scheduled job runs, optionally filtered by job name
+func (h *JobHandler) GetJobRuns(c *gin.Context) {
+	query := `
+		SELECT id, job_name, instance_id, status, started_at, finished_at, error_message
+		FROM scheduled_job_runs
+		WHERE (? = '' OR job_name = ?)
+		ORDER BY started_at DESC
+		LIMIT 100`
+
+	jobName := c.Query("job")
+	rows, err := h.db.Query(query, jobName, jobName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get job runs"})
+		return
+	}
+	defer rows.Close()
+
+	var runs []JobRun
+	for rows.Next() {
+		var run JobRun
+		err := rows.Scan(
+			&run.ID,
+			&run.JobName,
+			&run.InstanceID,
+			&run.Status,
+			&run.StartedAt,
+			&run.FinishedAt,
+			&run.ErrorMessage,
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan job run"})
+			return
+		}
+		runs = append(runs, run)
+	}
+
+	if runs == nil {
+		runs = []JobRun{}
+	}
+
+	c.JSON(http.StatusOK, runs)
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"sck-pos-backend/internal/throttle"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FailedLogin represents a rejected login attempt
+type FailedLogin struct {
+	ID        int64     `json:"id"`
+	Username  string    `json:"username"`
+	UserID    *int      `json:"user_id,omitempty"`
+	IPAddress *string   `json:"ip_address,omitempty"`
+	UserAgent *string   `json:"user_agent,omitempty"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// dummyPasswordHash is compared against when the username does not exist
+// It has the same bcrypt cost as real password hashes.
+const dummyPasswordHash = "$2a$10$EAwaze91IcaKDgTDg8FvzuFIu/TBb/0FRbP/nOrXp30S.K3/AuXYO"
+
+// loginFailed records a failed password check and responds 401
+// The attempt was already counted by the login guard's Begin.
+// The response is the same whether or not the failure locked the account.
+func (h *AuthHandler) loginFailed(c *gin.Context, username string, userID *int, decision throttle.Decision) {
+	if decision.LastAttempt {
+		log.Printf("Login for %s locked after repeated failures from %s", username, c.ClientIP())
+	}
+
+	h.recordFailedLogin(c, username, userID, "invalid_credentials")
+
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+}
+
+// recordFailedLogin writes a rejected login to the failed_logins table
+func (h *AuthHandler) recordFailedLogin(c *gin.Context, username string, userID *int, reason string) {
+	_, err := h.db.Exec(`
+		INSERT INTO failed_logins (username, user_id, ip_address, user_agent, reason)
+		VALUES (?, ?, ?, ?, ?)
+	`, truncate(username, 100), userID, c.ClientIP(), truncate(c.Request.UserAgent(), 255), reason)
+	if err != nil {
+		log.Printf("Failed to record failed login for %s: %v", username, err)
+	}
+}
+
+// GetFailedLogins lists recent failed logins, newest first (admin)
+// Optional filters: username, since (RFC 3339), limit (default 100, max 500).
+func (h *AuthHandler) GetFailedLogins(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 || limit > 500 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 500"})
+		return
+	}
+
+	query := `
+		SELECT id, username, user_id, ip_address, user_agent, reason, created_at
+		FROM failed_logins
+		WHERE 1 = 1
+	`
+	args := []interface{}{}
+
+	if username := c.Query("username"); username != "" {
+		query += " AND username = ?"
+		args = append(args, username)
+	}
+	if since := c.Query("since"); since != "" {
+		sinceTime, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "since must be an RFC 3339 timestamp"})
+			return
+		}
+		query += " AND created_at >= ?"
+		args = append(args, sinceTime)
+	}
+
+	query += " ORDER BY created_at DESC, id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	failures := []FailedLogin{}
+	for rows.Next() {
+		var f FailedLogin
+		if err := rows.Scan(&f.ID, &f.Username, &f.UserID, &f.IPAddress, &f.UserAgent, &f.Reason, &f.CreatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan failed login"})
+			return
+		}
+		failures = append(failures, f)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"failed_logins": failures})
+}
+
+// UnlockUser clears a user's failed login counter, login lockout and PIN lockout (admin)
+func (h *AuthHandler) UnlockUser(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var username string
+	err = h.db.QueryRow("SELECT username FROM users WHERE id = ?", id).Scan(&username)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err := h.loginGuard.Unlock(c.Request.Context(), username); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock user"})
+		return
+	}
+
+	_, err = h.db.Exec("UPDATE users SET pin_failed_attempts = 0, pin_locked_until = NULL WHERE id = ?", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User unlocked successfully"})
+}
@@ -2,10 +2,15 @@ package handlers
 
 import (
 	"database/sql"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"sck-pos-backend/internal/loyalty"
+	"sck-pos-backend/internal/middleware"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -29,6 +34,7 @@ type LoyaltyPointTransaction struct {
 	BahtAmount      *float64  `json:"baht_amount,omitempty"`
 	ExpiryDate      *string   `json:"expiry_date,omitempty"`
 	Notes           *string   `json:"notes,omitempty"`
+	CreatedBy       *int      `json:"created_by,omitempty"`
 	CreatedAt       time.Time `json:"created_at"`
 }
 
@@ -56,6 +62,49 @@ type CustomerLoyaltySummary struct {
 	TotalTransactions   int     `json:"total_transactions"`
 	TotalSpent          float64 `json:"total_spent"`
 	MemberSince         string  `json:"member_since"`
+	Tier                string  `json:"tier"`
+	TierEarnMultiplier  float64 `json:"tier_earn_multiplier"`
+	RollingSpend        float64 `json:"rolling_12_month_spend"`
+}
+
+// LoyaltyTier represents a loyalty membership tier
+type LoyaltyTier struct {
+	ID                  int     `json:"id"`
+	Code                string  `json:"code"`
+	Name                string  `json:"name"`
+	MinAnnualSpend      float64 `json:"min_annual_spend"`
+	EarnMultiplier      float64 `json:"earn_multiplier"`
+	ExpiryExtensionDays int     `json:"expiry_extension_days"`
+}
+
+// LoyaltyTierChange represents a recorded tier upgrade or downgrade
+type LoyaltyTierChange struct {
+	ID           int       `json:"id"`
+	CustomerID   int       `json:"customer_id"`
+	PreviousTier string    `json:"previous_tier"`
+	NewTier      string    `json:"new_tier"`
+	RollingSpend float64   `json:"rolling_spend"`
+	ChangeType   string    `json:"change_type"`
+	Notes        *string   `json:"notes,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// LoyaltyAdjustment represents a manual credit or debit request
+type LoyaltyAdjustment struct {
+	Points int    `json:"points" binding:"required"`
+	Type   string `json:"type" binding:"omitempty,oneof=adjusted bonus"`
+	Reason string `json:"reason" binding:"required,max=500"`
+}
+
+// ExpiringLoyaltyPoints represents points that will expire soon
+type ExpiringLoyaltyPoints struct {
+	CustomerID int     `json:"customer_id"`
+	Name       string  `json:"name"`
+	Email      *string `json:"email,omitempty"`
+	Phone      *string `json:"phone,omitempty"`
+	Points     int     `json:"points"`
+	BahtValue  float64 `json:"baht_value"`
+	ExpiryDate string  `json:"expiry_date"`
 }
 
 // LoyaltyRedemption represents a redemption request
@@ -78,7 +127,8 @@ func (h *LoyaltyHandler) GetCustomerLoyaltySummary(c *gin.Context) {
 	query := `
 		SELECT 
 			id, name, email, phone, total_points, available_points, 
-			available_baht_value, total_transactions, total_spent, member_since
+			available_baht_value, total_transactions, total_spent, member_since,
+			tier, tier_earn_multiplier, rolling_12_month_spend
 		FROM customer_loyalty_summary 
 		WHERE id = ?`
 
@@ -94,6 +144,9 @@ func (h *LoyaltyHandler) GetCustomerLoyaltySummary(c *gin.Context) {
 		&summary.TotalTransactions,
 		&summary.TotalSpent,
 		&summary.MemberSince,
+		&summary.Tier,
+		&summary.TierEarnMultiplier,
+		&summary.RollingSpend,
 	)
 
 	if err != nil {
@@ -120,7 +173,7 @@ func (h *LoyaltyHandler) GetCustomerLoyaltyTransactions(c *gin.Context) {
 	query := `
 		SELECT 
 			id, customer_id, transaction_type, points, sale_id, 
-			baht_amount, expiry_date, notes, created_at
+			baht_amount, expiry_date, notes, created_by, created_at
 		FROM loyalty_point_transactions 
 		WHERE customer_id = ? 
 		ORDER BY created_at DESC
@@ -145,6 +198,7 @@ func (h *LoyaltyHandler) GetCustomerLoyaltyTransactions(c *gin.Context) {
 			&transaction.BahtAmount,
 			&transaction.ExpiryDate,
 			&transaction.Notes,
+			&transaction.CreatedBy,
 			&transaction.CreatedAt,
 		)
 		if err != nil {
@@ -261,6 +315,8 @@ func (h *LoyaltyHandler) RedeemLoyaltyPoints(c *gin.Context) {
 		saleIDParam = *redemption.SaleID
 	}
 
+	before := auditSnapshot(h.db, "customers", redemption.CustomerID)
+
 	_, err := h.db.Exec(
 		"CALL redeem_loyalty_points(?, ?, ?, ?)",
 		redemption.CustomerID,
@@ -270,7 +326,7 @@ func (h *LoyaltyHandler) RedeemLoyaltyPoints(c *gin.Context) {
 	)
 
 	if err != nil {
-		if err.Error() == "Error 1644: Insufficient loyalty points" {
+		if isInsufficientPointsError(err) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient loyalty points"})
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to redeem points"})
@@ -278,6 +334,8 @@ func (h *LoyaltyHandler) RedeemLoyaltyPoints(c *gin.Context) {
 		return
 	}
 
+	middleware.AuditChange(c, "customer", redemption.CustomerID, before, auditSnapshot(h.db, "customers", redemption.CustomerID))
+
 	c.JSON(http.StatusOK, gin.H{
 		"message":         "Points redeemed successfully",
 		"points_redeemed": redemption.PointsToRedeem,
@@ -285,6 +343,105 @@ func (h *LoyaltyHandler) RedeemLoyaltyPoints(c *gin.Context) {
 	})
 }
 
+// AdjustLoyaltyPoints credits or debits a customer's points
+func (h *LoyaltyHandler) AdjustLoyaltyPoints(c *gin.Context) {
+	customerIDStr := c.Param("id")
+	customerID, err := strconv.Atoi(customerIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	var adjustment LoyaltyAdjustment
+	if err := c.ShouldBindJSON(&adjustment); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if adjustment.Type == "" {
+		adjustment.Type = "adjusted"
+	}
+
+	if strings.TrimSpace(adjustment.Reason) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Reason is required"})
+		return
+	}
+
+	if adjustment.Type == "bonus" && adjustment.Points < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Bonus points must be positive"})
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	var exists bool
+	err = h.db.QueryRow("SELECT EXISTS(SELECT 1 FROM customers WHERE id = ? AND is_active = 1)", customerID).Scan(&exists)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check customer"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+		return
+	}
+
+	before := auditSnapshot(h.db, "customers", customerID)
+
+	// The OUT parameter is a session variable, so keep both statements on one connection
+	conn, err := h.db.Conn(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(c.Request.Context(),
+		"CALL adjust_loyalty_points(?, ?, ?, ?, ?, @adjustment_id)",
+		customerID,
+		adjustment.Points,
+		adjustment.Type,
+		strings.TrimSpace(adjustment.Reason),
+		userID,
+	)
+	if err != nil {
+		if isInsufficientPointsError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient loyalty points"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to adjust points"})
+		}
+		return
+	}
+
+	var transactionID int
+	if err := conn.QueryRowContext(c.Request.Context(), "SELECT @adjustment_id").Scan(&transactionID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get adjustment ID"})
+		return
+	}
+
+	var availablePoints int
+	err = conn.QueryRowContext(c.Request.Context(), "SELECT get_available_loyalty_points(?)", customerID).Scan(&availablePoints)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get available points"})
+		return
+	}
+
+	middleware.AuditChange(c, "customer", customerID, before, auditSnapshot(h.db, "customers", customerID))
+	middleware.AuditDetails(c, fmt.Sprintf("%s %+d points (transaction #%d): %s",
+		adjustment.Type, adjustment.Points, transactionID, strings.TrimSpace(adjustment.Reason)))
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":          "Loyalty points adjusted successfully",
+		"transaction_id":   transactionID,
+		"points":           adjustment.Points,
+		"type":             adjustment.Type,
+		"available_points": availablePoints,
+	})
+}
+
 // CalculatePointsEarned calculates how many points would be earned for an amount
 func (h *LoyaltyHandler) CalculatePointsEarned(c *gin.Context) {
 	amountStr := c.Query("amount")
@@ -299,12 +456,33 @@ func (h *LoyaltyHandler) CalculatePointsEarned(c *gin.Context) {
 		return
 	}
 
-	// 1 point per 100 baht
-	points := int(amount / 100)
+	// 1 point per 100 baht, scaled by the customer's tier when one is given
+	multiplier := 1.0
+	if customerIDStr := c.Query("customer_id"); customerIDStr != "" {
+		customerID, err := strconv.Atoi(customerIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+			return
+		}
+
+		query := `
+			SELECT lt.earn_multiplier
+			FROM customers c
+			JOIN loyalty_tiers lt ON lt.code = c.loyalty_tier
+			WHERE c.id = ?`
+		err = h.db.QueryRow(query, customerID).Scan(&multiplier)
+		if err != nil && err != sql.ErrNoRows {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get customer tier"})
+			return
+		}
+	}
+
+	points := int(float64(int(amount/100)) * multiplier)
 
 	c.JSON(http.StatusOK, gin.H{
-		"points":         points,
-		"baht_per_point": 100,
+		"points":          points,
+		"baht_per_point":  100,
+		"earn_multiplier": multiplier,
 	})
 }
 
@@ -345,6 +523,183 @@ func (h *LoyaltyHandler) ExpireLoyaltyPoints(c *gin.Context) {
 	})
 }
 
+// GetExpiringLoyaltyPoints lists customers with points expiring in the next N days
+func (h *LoyaltyHandler) GetExpiringLoyaltyPoints(c *gin.Context) {
+	days := 14
+	if daysStr := c.Query("days"); daysStr != "" {
+		var err error
+		days, err = strconv.Atoi(daysStr)
+		if err != nil || days < 1 || days > 365 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid days"})
+			return
+		}
+	}
+
+	rows, err := h.db.Query("CALL get_expiring_loyalty_points(?)", days)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get expiring points"})
+		return
+	}
+	defer rows.Close()
+
+	var expiring []ExpiringLoyaltyPoints
+	for rows.Next() {
+		var points ExpiringLoyaltyPoints
+		err := rows.Scan(
+			&points.CustomerID,
+			&points.Name,
+			&points.Email,
+			&points.Phone,
+			&points.Points,
+			&points.BahtValue,
+			&points.ExpiryDate,
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan expiring points"})
+			return
+		}
+		expiring = append(expiring, points)
+	}
+
+	if expiring == nil {
+		expiring = []ExpiringLoyaltyPoints{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"days":      days,
+		"customers": expiring,
+	})
+}
+
+// GetLoyaltyTiers lists the loyalty tiers and their benefits
+func (h *LoyaltyHandler) GetLoyaltyTiers(c *gin.Context) {
+	query := `
+		SELECT id, code, name, min_annual_spend, earn_multiplier, expiry_extension_days
+		FROM loyalty_tiers
+		ORDER BY min_annual_spend ASC`
+
+	rows, err := h.db.Query(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get loyalty tiers"})
+		return
+	}
+	defer rows.Close()
+
+	var tiers []LoyaltyTier
+	for rows.Next() {
+		var tier LoyaltyTier
+		err := rows.Scan(
+			&tier.ID,
+			&tier.Code,
+			&tier.Name,
+			&tier.MinAnnualSpend,
+			&tier.EarnMultiplier,
+			&tier.ExpiryExtensionDays,
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan tier"})
+			return
+		}
+		tiers = append(tiers, tier)
+	}
+
+	if tiers == nil {
+		tiers = []LoyaltyTier{}
+	}
+
+	c.JSON(http.StatusOK, tiers)
+}
+
+// GetCustomerTierHistory gets the tier change history for a customer
+func (h *LoyaltyHandler) GetCustomerTierHistory(c *gin.Context) {
+	customerIDStr := c.Param("id")
+	customerID, err := strconv.Atoi(customerIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	query := `
+		SELECT 
+			id, customer_id, previous_tier, new_tier, rolling_spend, 
+			change_type, notes, created_at
+		FROM loyalty_tier_history 
+		WHERE customer_id = ? 
+		ORDER BY created_at DESC
+		LIMIT 100`
+
+	rows, err := h.db.Query(query, customerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get tier history"})
+		return
+	}
+	defer rows.Close()
+
+	var changes []LoyaltyTierChange
+	for rows.Next() {
+		var change LoyaltyTierChange
+		err := rows.Scan(
+			&change.ID,
+			&change.CustomerID,
+			&change.PreviousTier,
+			&change.NewTier,
+			&change.RollingSpend,
+			&change.ChangeType,
+			&change.Notes,
+			&change.CreatedAt,
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan tier change"})
+			return
+		}
+		changes = append(changes, change)
+	}
+
+	if changes == nil {
+		changes = []LoyaltyTierChange{}
+	}
+
+	c.JSON(http.StatusOK, changes)
+}
+
+// EvaluateLoyaltyTiers manually re-evaluates customer tiers (usually run by the scheduler)
+func (h *LoyaltyHandler) EvaluateLoyaltyTiers(c *gin.Context) {
+	_, err := h.db.Exec("CALL evaluate_loyalty_tiers()")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to evaluate tiers"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Loyalty tier evaluation completed",
+	})
+}
+
+// CheckLoyaltyLedger reports customers whose points disagree with the transaction log
+func (h *LoyaltyHandler) CheckLoyaltyLedger(c *gin.Context) {
+	report, err := loyalty.ReconcileLedger(c.Request.Context(), h.db, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check loyalty ledger"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// RepairLoyaltyLedger rebuilds customer points from the transaction log
+// Pass dry_run=true to see what would change without committing
+func (h *LoyaltyHandler) RepairLoyaltyLedger(c *gin.Context) {
+	dryRun := c.Query("dry_run") == "true"
+
+	report, err := loyalty.ReconcileLedger(c.Request.Context(), h.db, dryRun)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to repair loyalty ledger"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
 // Helper function for absolute value
 func abs(x float64) float64 {
 	if x < 0 {
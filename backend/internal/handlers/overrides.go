@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"sck-pos-backend/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Override actions that need a manager's approval when done by a cashier
+const (
+	OverrideVoid          = "void"
+	OverrideRefund        = "refund"
+	OverridePriceOverride = "price_override"
+	OverrideDiscount      = "discount"
+)
+
+// overrideTokenTTL is how long an approval stays usable
+const overrideTokenTTL = 2 * time.Minute
+
+// OverrideRequest represents a manager override approval request body
+// The cashier's till submits it with the manager's PIN or password.
+type OverrideRequest struct {
+	Action           string   `json:"action" binding:"required,oneof=void refund price_override discount"`
+	ApproverUsername string   `json:"approver_username" binding:"required"`
+	ApproverPin      string   `json:"approver_pin"`
+	ApproverPassword string   `json:"approver_password"`
+	Reason           string   `json:"reason" binding:"required,max=255"`
+	SaleID           *int     `json:"sale_id"`    // void, refund
+	ProductID        *int     `json:"product_id"` // price_override
+	Amount           *float64 `json:"amount" binding:"omitempty,min=0"`
+}
+
+// managerOverride is an approval loaded for consumption
+type managerOverride struct {
+	ID        int
+	Action    string
+	SaleID    *int
+	ProductID *int
+	Amount    *float64
+}
+
+// ApproveOverride records a manager's approval and returns a single-use override token
+// Send the token in the X-Override-Token header of the sales request it approves.
+func (h *AuthHandler) ApproveOverride(c *gin.Context) {
+	var req OverrideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	switch {
+	case (req.ApproverPin == "") == (req.ApproverPassword == ""):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide either approver_pin or approver_password"})
+		return
+	case (req.Action == OverrideVoid || req.Action == OverrideRefund) && req.SaleID == nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sale_id is required for " + req.Action})
+		return
+	case req.Action == OverridePriceOverride && (req.ProductID == nil || req.Amount == nil):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "product_id and amount (the approved unit price) are required"})
+		return
+	case req.Action == OverrideDiscount && req.Amount == nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "amount (the maximum discount) is required"})
+		return
+	}
+
+	requesterID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+	terminalID := currentTerminalID(c)
+
+	var approver User
+	var passwordHash string
+	var pinHash *string
+	err := h.db.QueryRow(`
+		SELECT id, username, email, full_name, role, store_id, is_active,
+			password_hash, pin_hash
+		FROM users
+		WHERE username = ? AND is_active = true
+	`, req.ApproverUsername).Scan(
+		&approver.ID, &approver.Username, &approver.Email, &approver.FullName,
+		&approver.Role, &approver.StoreID, &approver.IsActive,
+		&passwordHash, &pinHash,
+	)
+	if err == sql.ErrNoRows {
+		h.denyOverride(c, req, nil, "unknown approver")
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// Verify the approver's credentials with the same lockouts as login
+	method := "pin"
+	if req.ApproverPin != "" {
+		if pinHash == nil {
+			h.denyOverride(c, req, &approver, "approver has no PIN")
+			return
+		}
+		_, err := verifyPin(h.db, approver.ID, *pinHash, req.ApproverPin)
+		switch err {
+		case nil:
+		case errPinLocked:
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Approver PIN locked after too many failed attempts"})
+			return
+		case errPinInvalid:
+			h.denyOverride(c, req, &approver, "wrong PIN")
+			return
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	} else {
+		method = "password"
+		decision, err := h.loginGuard.Begin(c.Request.Context(), approver.Username, c.ClientIP())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if !decision.Allowed {
+			c.Header("Retry-After", strconv.Itoa(int(decision.RetryAfter.Seconds())+1))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed attempts, try again later"})
+			return
+		}
+		if bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.ApproverPassword)) != nil {
+			h.denyOverride(c, req, &approver, "wrong password")
+			return
+		}
+		// A correct password takes back only this attempt's count, so approvals
+		// cannot wipe the approver's failed login history
+		if err := h.loginGuard.Release(c.Request.Context(), approver.Username, c.ClientIP()); err != nil {
+			log.Printf("Failed to release approval attempt for %s: %v", approver.Username, err)
+		}
+	}
+
+	if !middleware.HasPermission(approver.Role, middleware.PermOverridesApprove) {
+		h.denyOverride(c, req, &approver, "approver lacks "+string(middleware.PermOverridesApprove))
+		return
+	}
+	if approver.ID == requesterID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Overrides must be approved by another user"})
+		return
+	}
+
+	// Store-assigned managers can only approve at their own store's tills
+	if approver.StoreID != nil && terminalID != nil {
+		var terminalStoreID int
+		if err := h.db.QueryRow("SELECT store_id FROM terminals WHERE id = ?", *terminalID).Scan(&terminalStoreID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if terminalStoreID != *approver.StoreID {
+			h.denyOverride(c, req, &approver, "approver is assigned to another store")
+			return
+		}
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue override"})
+		return
+	}
+	expiresAt := time.Now().Add(overrideTokenTTL)
+
+	result, err := h.db.Exec(`
+		INSERT INTO manager_overrides (
+			action, requested_by, approved_by, approval_method, terminal_id,
+			sale_id, product_id, amount, reason, token_hash, expires_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, req.Action, requesterID, approver.ID, method, terminalID,
+		req.SaleID, req.ProductID, req.Amount, req.Reason, hashToken(token), expiresAt)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to record override"})
+		return
+	}
+	overrideID, _ := result.LastInsertId()
+
+	auditOverride(c, req, &approver, "approved by "+method)
+	middleware.AuditChange(c, "manager_override", overrideID, nil, auditSnapshot(h.db, "manager_overrides", overrideID))
+
+	middleware.NoReplay(c)
+	c.JSON(http.StatusCreated, gin.H{
+		"override_id":    overrideID,
+		"override_token": token,
+		"action":         req.Action,
+		"approved_by":    approver.Username,
+		"expires_in":     int(overrideTokenTTL.Seconds()),
+	})
+}
+
+// denyOverride records a refused approval and responds 403
+func (h *AuthHandler) denyOverride(c *gin.Context, req OverrideRequest, approver *User, reason string) {
+	auditOverride(c, req, approver, reason)
+	c.JSON(http.StatusForbidden, gin.H{"error": "Override not approved"})
+}
+
+// auditOverride notes the approver on the request's audit entry; the entry
+// itself belongs to the requesting cashier
+func auditOverride(c *gin.Context, req OverrideRequest, approver *User, details string) {
+	name := req.ApproverUsername
+	if approver != nil {
+		name = fmt.Sprintf("%s (#%d)", approver.Username, approver.ID)
+	}
+	middleware.AuditDetails(c, fmt.Sprintf("%s by approver=%s; %s; reason=%s", req.Action, name, details, req.Reason))
+}
+
+// consumeOverride finds an unused override among the request's X-Override-Token
+// headers that matches action and the check, and marks it used
+// Overrides are bound to the cashier who requested them. Returns nil if none matches.
+func consumeOverride(tx *sql.Tx, c *gin.Context, action string, matches func(managerOverride) bool) (*managerOverride, error) {
+	userID, _ := currentUserID(c)
+
+	for _, token := range c.Request.Header.Values("X-Override-Token") {
+		var o managerOverride
+		err := tx.QueryRow(`
+			SELECT id, action, sale_id, product_id, amount
+			FROM manager_overrides
+			WHERE token_hash = ? AND action = ? AND requested_by = ?
+			  AND used_at IS NULL AND expires_at > NOW()
+			FOR UPDATE
+		`, hashToken(token), action, userID).Scan(&o.ID, &o.Action, &o.SaleID, &o.ProductID, &o.Amount)
+		if err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		if !matches(o) {
+			continue
+		}
+
+		if _, err := tx.Exec("UPDATE manager_overrides SET used_at = NOW() WHERE id = ?", o.ID); err != nil {
+			return nil, err
+		}
+		return &o, nil
+	}
+
+	return nil, nil
+}
+
+// linkOverrides records which sale consumed the overrides
+func linkOverrides(tx *sql.Tx, overrides []*managerOverride, saleID int64) error {
+	for _, o := range overrides {
+		if _, err := tx.Exec("UPDATE manager_overrides SET used_on_sale_id = ? WHERE id = ?", saleID, o.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// respondOverrideRequired tells the till which approval is missing
+func respondOverrideRequired(c *gin.Context, action string, details gin.H) {
+	body := gin.H{
+		"error":           "Manager override required",
+		"code":            "override_required",
+		"override_action": action,
+	}
+	for k, v := range details {
+		body[k] = v
+	}
+	c.JSON(http.StatusForbidden, body)
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"sck-pos-backend/internal/password"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// errPasswordReused is returned when a new password matches a recent one
+var errPasswordReused = errors.New("password was used recently")
+
+// ChangePasswordRequest represents self-service password change request body
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// ChangePassword replaces the caller's password after verifying the current one
+// Clears a forced change and signs the user out of their other sessions.
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var passwordHash string
+	err = tx.QueryRow("SELECT password_hash FROM users WHERE id = ? FOR UPDATE", userID).Scan(&passwordHash)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.CurrentPassword)); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+		return
+	}
+
+	if err := setPassword(tx, h.passwords, userID, req.NewPassword, false); err != nil {
+		respondPasswordError(c, h.passwords, err)
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE user_sessions SET revoked_at = NOW(), revoked_reason = 'password_changed'
+		WHERE user_id = ? AND id <> ? AND revoked_at IS NULL
+	`, userID, c.GetString("session_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully"})
+}
+
+// hashNewPassword checks a new account's password against the policy and hashes it
+func hashNewPassword(policy *password.Policy, plain, username string) (string, error) {
+	if err := policy.Validate(plain, username); err != nil {
+		return "", err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(plain), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// setPassword replaces an existing user's password
+// The new password must pass the policy and differ from the current and recent
+// passwords; the old hash is kept in password_history.
+func setPassword(tx *sql.Tx, policy *password.Policy, userID int, plain string, mustChange bool) error {
+	var username, currentHash string
+	err := tx.QueryRow("SELECT username, password_hash FROM users WHERE id = ? FOR UPDATE", userID).Scan(&username, &currentHash)
+	if err != nil {
+		return err
+	}
+
+	if err := policy.Validate(plain, username); err != nil {
+		return err
+	}
+
+	// The current password counts towards the history size
+	previous := []string{currentHash}
+	if policy.HistorySize > 1 {
+		rows, err := tx.Query(`
+			SELECT password_hash FROM password_history
+			WHERE user_id = ?
+			ORDER BY id DESC
+			LIMIT ?
+		`, userID, policy.HistorySize-1)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var hash string
+			if err := rows.Scan(&hash); err != nil {
+				rows.Close()
+				return err
+			}
+			previous = append(previous, hash)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	for _, hash := range previous {
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(plain)) == nil {
+			return errPasswordReused
+		}
+	}
+
+	newHash, err := bcrypt.GenerateFromPassword([]byte(plain), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("INSERT INTO password_history (user_id, password_hash) VALUES (?, ?)", userID, currentHash); err != nil {
+		return err
+	}
+
+	// Keep only what the history check can use
+	_, err = tx.Exec(`
+		DELETE FROM password_history
+		WHERE user_id = ? AND id NOT IN (
+			SELECT id FROM (
+				SELECT id FROM password_history WHERE user_id = ? ORDER BY id DESC LIMIT ?
+			) recent
+		)
+	`, userID, userID, policy.HistorySize)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE users
+		SET password_hash = ?, must_change_password = ?, password_changed_at = NOW(), updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, string(newHash), mustChange, userID)
+	return err
+}
+
+// respondPasswordError writes the response for a failed password change
+func respondPasswordError(c *gin.Context, policy *password.Policy, err error) {
+	var policyErr *password.PolicyError
+	switch {
+	case errors.As(err, &policyErr):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":      "Password does not meet the password policy",
+			"violations": policyErr.Violations,
+		})
+	case errors.Is(err, errPasswordReused):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Password must differ from your last %d passwords", policy.HistorySize),
+		})
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set password"})
+	}
+}
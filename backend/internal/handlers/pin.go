@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PIN lockout policy
+const (
+	maxPinAttempts  = 5
+	pinLockDuration = 15 * time.Minute
+)
+
+// pinPattern accepts 4 to 6 digit PINs
+var pinPattern = regexp.MustCompile(`^[0-9]{4,6}$`)
+
+// PinLoginRequest represents PIN login request body
+type PinLoginRequest struct {
+	Username string `json:"username" binding:"required"`
+	Pin      string `json:"pin" binding:"required"`
+}
+
+// SetPinRequest represents set PIN request body
+type SetPinRequest struct {
+	Pin             string `json:"pin" binding:"required"`
+	CurrentPassword string `json:"current_password" binding:"required"`
+}
+
+// PinLogin signs a user in with their PIN from a registered terminal
+// The terminal authenticates with X-Terminal-ID and X-Terminal-Secret headers.
+// Signing in replaces whoever was signed in on the same terminal.
+func (h *AuthHandler) PinLogin(c *gin.Context) {
+	var req PinLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	terminal, err := authenticateTerminal(h.db, c)
+	if err == errTerminalUnauthorized {
+		c.JSON(http.StatusForbidden, gin.H{"error": "PIN login requires a registered terminal"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	var user User
+	var pinHash *string
+	query := `
+		SELECT id, username, email, full_name, role, store_id, is_active, pin_hash
+		FROM users
+		WHERE username = ? AND is_active = true
+	`
+
+	err = h.db.QueryRow(query, req.Username).Scan(
+		&user.ID, &user.Username, &user.Email, &user.FullName,
+		&user.Role, &user.StoreID, &user.IsActive,
+		&pinHash,
+	)
+	if err == sql.ErrNoRows || (err == nil && pinHash == nil) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if !terminalAllowed(c, &terminal, user) {
+		return
+	}
+
+	lockedUntil, err := verifyPin(h.db, user.ID, *pinHash, req.Pin)
+	switch err {
+	case nil:
+	case errPinLocked:
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":        "PIN locked after too many failed attempts",
+			"locked_until": lockedUntil,
+		})
+		return
+	case errPinInvalid:
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// A PIN is a single factor, so register sessions are never MFA verified
+	response, err := h.startSession(c, user, &terminal.ID, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// PIN check outcomes
+var (
+	errPinLocked  = errors.New("PIN locked")
+	errPinInvalid = errors.New("invalid PIN")
+)
+
+// verifyPin checks a PIN and maintains the user's failure counter and lockout
+// The user's row stays locked while the PIN is compared, so parallel guesses
+// are counted one at a time. Returns errPinLocked with the lockout's end while
+// locked out and errPinInvalid on a wrong PIN.
+func verifyPin(db *sql.DB, userID int, pinHash, pin string) (*time.Time, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var failedAttempts int
+	var lockedUntil *time.Time
+	err = tx.QueryRow(
+		"SELECT pin_failed_attempts, pin_locked_until FROM users WHERE id = ? FOR UPDATE", userID,
+	).Scan(&failedAttempts, &lockedUntil)
+	if err != nil {
+		return nil, err
+	}
+	if lockedUntil != nil && time.Now().Before(*lockedUntil) {
+		return lockedUntil, errPinLocked
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(pinHash), []byte(pin)); err != nil {
+		failedAttempts++
+		if failedAttempts >= maxPinAttempts {
+			_, err = tx.Exec(`
+				UPDATE users SET pin_failed_attempts = 0, pin_locked_until = ?
+				WHERE id = ?
+			`, time.Now().Add(pinLockDuration), userID)
+		} else {
+			_, err = tx.Exec("UPDATE users SET pin_failed_attempts = ? WHERE id = ?", failedAttempts, userID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		return nil, errPinInvalid
+	}
+
+	if failedAttempts > 0 || lockedUntil != nil {
+		if _, err := tx.Exec("UPDATE users SET pin_failed_attempts = 0, pin_locked_until = NULL WHERE id = ?", userID); err != nil {
+			return nil, err
+		}
+	}
+	return nil, tx.Commit()
+}
+
+// SetPin sets the caller's own PIN after confirming their password
+func (h *AuthHandler) SetPin(c *gin.Context) {
+	var req SetPinRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !pinPattern.MatchString(req.Pin) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "PIN must be 4 to 6 digits"})
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	var passwordHash string
+	err := h.db.QueryRow("SELECT password_hash FROM users WHERE id = ?", userID).Scan(&passwordHash)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.CurrentPassword)); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+		return
+	}
+
+	pinHash, err := bcrypt.GenerateFromPassword([]byte(req.Pin), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash PIN"})
+		return
+	}
+
+	_, err = h.db.Exec(`
+		UPDATE users SET pin_hash = ?, pin_failed_attempts = 0, pin_locked_until = NULL
+		WHERE id = ?
+	`, string(pinHash), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set PIN"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "PIN set successfully"})
+}
+
+// ClearPin removes a user's PIN and unlocks it (admin)
+func (h *UserHandler) ClearPin(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	result, err := h.db.Exec(`
+		UPDATE users SET pin_hash = NULL, pin_failed_attempts = 0, pin_locked_until = NULL
+		WHERE id = ?
+	`, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear PIN"})
+		return
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "PIN cleared successfully"})
+}
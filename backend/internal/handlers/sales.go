@@ -2,7 +2,12 @@ package handlers
 
 import (
 	"database/sql"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
+
+	"sck-pos-backend/internal/middleware"
 
 	"github.com/gin-gonic/gin"
 )
@@ -10,11 +15,176 @@ import (
 // SalesHandler handles sales-related requests
 type SalesHandler struct {
 	db *sql.DB
+	// overrideDiscountPercent is the share of the subtotal a cashier can discount
+	// without a manager override
+	overrideDiscountPercent float64
 }
 
 // NewSalesHandler creates a new sales handler
-func NewSalesHandler(db *sql.DB) *SalesHandler {
-	return &SalesHandler{db: db}
+func NewSalesHandler(db *sql.DB, overrideDiscountPercent float64) *SalesHandler {
+	return &SalesHandler{db: db, overrideDiscountPercent: overrideDiscountPercent}
+}
+
+// SaleItem represents a product line in a sale
+type SaleItem struct {
+	ID             int     `json:"id"`
+	SaleID         int     `json:"sale_id"`
+	ProductID      int     `json:"product_id"`
+	ProductName    string  `json:"product_name"`
+	Quantity       int     `json:"quantity"`
+	UnitPrice      float64 `json:"unit_price"`
+	DiscountAmount float64 `json:"discount_amount"`
+	Subtotal       float64 `json:"subtotal"`
+}
+
+// Sale represents a sales transaction
+type Sale struct {
+	ID                    int        `json:"id"`
+	ReceiptNumber         string     `json:"receipt_number"`
+	ClientUUID            *string    `json:"client_uuid,omitempty"`
+	StoreID               int        `json:"store_id"`
+	TerminalID            *int       `json:"terminal_id,omitempty"`
+	UserID                int        `json:"user_id"`
+	ShiftID               *int       `json:"shift_id,omitempty"`
+	CustomerID            *int       `json:"customer_id,omitempty"`
+	Subtotal              float64    `json:"subtotal"`
+	TaxAmount             float64    `json:"tax_amount"`
+	DiscountAmount        float64    `json:"discount_amount"`
+	LoyaltyPointsUsed     int        `json:"loyalty_points_used"`
+	LoyaltyDiscountAmount float64    `json:"loyalty_discount_amount"`
+	TotalAmount           float64    `json:"total_amount"`
+	PaymentMethod         string     `json:"payment_method"`
+	PaymentStatus         string     `json:"payment_status"`
+	Notes                 *string    `json:"notes,omitempty"`
+	CreatedAt             time.Time  `json:"created_at"`
+	SyncedAt              *time.Time `json:"synced_at,omitempty"` // set on sales uploaded by an offline terminal
+	Items                 []SaleItem `json:"items"`
+	Payments              []Payment  `json:"payments"`
+}
+
+const saleColumns = `
+	id, receipt_number, client_uuid, store_id, terminal_id, user_id, shift_id, customer_id, subtotal,
+	tax_amount, discount_amount, loyalty_points_used, loyalty_discount_amount, total_amount,
+	payment_method, payment_status, notes, created_at, synced_at
+`
+
+// scanSale reads a row selected with saleColumns
+func scanSale(row interface{ Scan(...interface{}) error }) (Sale, error) {
+	var s Sale
+	err := row.Scan(
+		&s.ID, &s.ReceiptNumber, &s.ClientUUID, &s.StoreID, &s.TerminalID, &s.UserID, &s.ShiftID,
+		&s.CustomerID, &s.Subtotal, &s.TaxAmount, &s.DiscountAmount, &s.LoyaltyPointsUsed,
+		&s.LoyaltyDiscountAmount, &s.TotalAmount, &s.PaymentMethod, &s.PaymentStatus, &s.Notes,
+		&s.CreatedAt, &s.SyncedAt,
+	)
+	return s, err
+}
+
+// loadSaleLines fills in the items and payments of the given sales
+func loadSaleLines(q interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}, sales []Sale) error {
+	if len(sales) == 0 {
+		return nil
+	}
+
+	ids := make([]int, len(sales))
+	index := make(map[int]int, len(sales))
+	for i := range sales {
+		ids[i] = sales[i].ID
+		index[sales[i].ID] = i
+		sales[i].Items = []SaleItem{}
+		sales[i].Payments = []Payment{}
+	}
+	in, args := inClause(ids)
+
+	rows, err := q.Query(`
+		SELECT si.id, si.sale_id, si.product_id, COALESCE(p.name, ''), si.quantity, si.unit_price,
+			si.discount_amount, si.subtotal
+		FROM sale_items si
+		LEFT JOIN products p ON p.id = si.product_id
+		WHERE si.sale_id IN (`+in+`)
+		ORDER BY si.id
+	`, args...)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var item SaleItem
+		err := rows.Scan(
+			&item.ID, &item.SaleID, &item.ProductID, &item.ProductName, &item.Quantity, &item.UnitPrice,
+			&item.DiscountAmount, &item.Subtotal,
+		)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		sale := &sales[index[item.SaleID]]
+		sale.Items = append(sale.Items, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = q.Query(`
+		SELECT sale_id, payment_method, amount, card_last_four, transaction_id
+		FROM payment_details
+		WHERE sale_id IN (`+in+`)
+		ORDER BY id
+	`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var saleID int
+		var payment Payment
+		if err := rows.Scan(&saleID, &payment.PaymentMethod, &payment.Amount, &payment.CardLastFour, &payment.TransactionID); err != nil {
+			return err
+		}
+		sale := &sales[index[saleID]]
+		sale.Payments = append(sale.Payments, payment)
+	}
+	return rows.Err()
+}
+
+// Payment represents one tender of a sale, stored in payment_details
+type Payment struct {
+	PaymentMethod string  `json:"payment_method" binding:"required,oneof=cash card digital_wallet"`
+	Amount        float64 `json:"amount" binding:"gt=0"`
+	CardLastFour  *string `json:"card_last_four" binding:"omitempty,len=4,numeric"`
+	TransactionID *string `json:"transaction_id" binding:"omitempty,max=100"`
+}
+
+// CreateSaleItemRequest represents a product line in a create sale request
+type CreateSaleItemRequest struct {
+	ProductID      int     `json:"product_id" binding:"required"`
+	ProductName    string  `json:"product_name"`
+	Quantity       int     `json:"quantity" binding:"required,min=1"`
+	UnitPrice      float64 `json:"unit_price" binding:"min=0"`
+	DiscountAmount float64 `json:"discount_amount" binding:"min=0"`
+	Subtotal       float64 `json:"subtotal"`
+}
+
+// CreateSaleRequest represents create sale request body
+type CreateSaleRequest struct {
+	StoreID               int                     `json:"store_id"`
+	CustomerID            *int                    `json:"customer_id"`
+	Subtotal              float64                 `json:"subtotal" binding:"min=0"`
+	TaxAmount             float64                 `json:"tax_amount" binding:"min=0"`
+	DiscountAmount        float64                 `json:"discount_amount" binding:"min=0"`
+	LoyaltyPointsUsed     int                     `json:"loyalty_points_used" binding:"min=0"`
+	LoyaltyDiscountAmount float64                 `json:"loyalty_discount_amount" binding:"min=0"`
+	TotalAmount           float64                 `json:"total_amount" binding:"min=0"`
+	PaymentMethod         string                  `json:"payment_method" binding:"required,oneof=cash card digital_wallet mixed"`
+	PaymentStatus         string                  `json:"payment_status" binding:"omitempty,oneof=pending completed"`
+	Notes                 *string                 `json:"notes"`
+	Items                 []CreateSaleItemRequest `json:"items" binding:"required,min=1,dive"`
+
+	// Payments splits the total across tenders; required for mixed payment.
+	// When omitted the whole total is paid with payment_method.
+	Payments []Payment `json:"payments" binding:"omitempty,dive"`
 }
 
 // GetSales retrieves all sales
@@ -27,14 +197,674 @@ func (h *SalesHandler) GetSale(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Sale retrieval not implemented yet"})
 }
 
-// CreateSale creates a new sale
+// CreateSale creates a new sale, redeeming any loyalty points in the same transaction
 func (h *SalesHandler) CreateSale(c *gin.Context) {
-	c.JSON(http.StatusCreated, gin.H{"message": "Sale creation not implemented yet"})
+	var req CreateSaleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	if req.PaymentStatus == "" {
+		req.PaymentStatus = "completed"
+	}
+
+	loyaltyDiscount, netTotal, saleErr := checkSaleTotals(req)
+	if saleErr != nil {
+		saleErr.respond(c)
+		return
+	}
+
+	payments, saleErr := salePayments(req, netTotal)
+	if saleErr != nil {
+		saleErr.respond(c)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Sales count towards the cashier's open shift; cash at a register needs one
+	shift, err := findOpenShift(tx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	terminalID := currentTerminalID(c)
+	if shift == nil && terminalID != nil && paidInCash(payments) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Open a shift before taking cash", "code": "shift_required"})
+		return
+	}
+	var shiftID *int
+	if shift != nil {
+		if terminalID != nil && *terminalID != shift.TerminalID {
+			c.JSON(http.StatusConflict, gin.H{"error": "Your open shift is on another register", "shift_id": shift.ID})
+			return
+		}
+		shiftID = &shift.ID
+		terminalID = &shift.TerminalID
+	}
+
+	// Sales made at a till always belong to the till's store
+	storeID := req.StoreID
+	if terminalID != nil {
+		var terminalStoreID int
+		if err := tx.QueryRow("SELECT store_id FROM terminals WHERE id = ?", *terminalID).Scan(&terminalStoreID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if storeID != 0 && storeID != terminalStoreID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Sale store does not match the terminal's store"})
+			return
+		}
+		storeID = terminalStoreID
+	}
+	if storeID == 0 {
+		err = tx.QueryRow("SELECT id FROM stores WHERE is_active = true ORDER BY id LIMIT 1").Scan(&storeID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No active store available"})
+			return
+		}
+	}
+
+	// A till may still hold a customer that has since been merged into another
+	if req.CustomerID != nil {
+		customerID, err := survivingCustomerID(tx, *req.CustomerID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		} else if customerID == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Customer not found"})
+			return
+		}
+		req.CustomerID = &customerID
+	}
+
+	// Price overrides and large discounts need a manager's approval
+	overrides, ok := h.requireSaleOverrides(c, tx, req)
+	if !ok {
+		return
+	}
+
+	// Redeem before the sale row exists so points earned by this sale cannot pay for it
+	var redemptionID sql.NullInt64
+	if req.LoyaltyPointsUsed > 0 {
+		redemptionID, err = redeemForSale(tx, *req.CustomerID, req.LoyaltyPointsUsed, loyaltyDiscount)
+		if err != nil {
+			if isInsufficientPointsError(err) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient loyalty points"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to redeem points"})
+			}
+			return
+		}
+	}
+
+	sale := Sale{
+		ReceiptNumber:         newReceiptNumber(),
+		StoreID:               storeID,
+		TerminalID:            terminalID,
+		UserID:                userID,
+		ShiftID:               shiftID,
+		CustomerID:            req.CustomerID,
+		Subtotal:              req.Subtotal,
+		TaxAmount:             req.TaxAmount,
+		DiscountAmount:        req.DiscountAmount,
+		LoyaltyPointsUsed:     req.LoyaltyPointsUsed,
+		LoyaltyDiscountAmount: loyaltyDiscount,
+		TotalAmount:           netTotal,
+		PaymentMethod:         req.PaymentMethod,
+		PaymentStatus:         req.PaymentStatus,
+		Notes:                 req.Notes,
+		CreatedAt:             time.Now(),
+		Payments:              payments,
+	}
+	if saleErr := recordSale(tx, &sale, req.Items, redemptionID); saleErr != nil {
+		saleErr.respond(c)
+		return
+	}
+
+	if err := linkOverrides(tx, overrides, int64(sale.ID)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link overrides to sale"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit sale"})
+		return
+	}
+	middleware.AuditChange(c, "sale", sale.ID, nil, sale)
+
+	c.JSON(http.StatusCreated, sale)
+}
+
+// saleError is a reason a sale cannot be recorded and the response it gets
+type saleError struct {
+	status int
+	body   gin.H
+	err    error // underlying database error, if any
+}
+
+func (e *saleError) Error() string {
+	return fmt.Sprint(e.body["error"])
+}
+
+// respond sends the error to the client
+func (e *saleError) respond(c *gin.Context) {
+	c.JSON(e.status, e.body)
 }
 
-// RefundSale processes a refund
+// invalidSale is a sale the client got wrong
+func invalidSale(body gin.H) *saleError {
+	return &saleError{status: http.StatusBadRequest, body: body}
+}
+
+// failedSale is a sale the database could not store
+func failedSale(message string, err error) *saleError {
+	return &saleError{status: http.StatusInternalServerError, body: gin.H{"error": message}, err: err}
+}
+
+// checkSaleTotals checks the subtotal, loyalty discount and total against the sale lines
+// The subtotal must be the sum of each line's quantity times unit price less its
+// discount. Returns the loyalty discount and the net total points are earned on.
+func checkSaleTotals(req CreateSaleRequest) (float64, float64, *saleError) {
+	if req.LoyaltyPointsUsed > 0 && req.CustomerID == nil {
+		return 0, 0, invalidSale(gin.H{"error": "Customer is required to redeem loyalty points"})
+	}
+
+	subtotal := 0.0
+	for _, item := range req.Items {
+		gross := float64(item.Quantity) * item.UnitPrice
+		if item.DiscountAmount > gross+0.01 {
+			return 0, 0, invalidSale(gin.H{"error": "Item discount exceeds line total", "product_id": item.ProductID})
+		}
+		subtotal += gross - item.DiscountAmount
+	}
+	if abs(req.Subtotal-subtotal) > 0.01 {
+		return 0, 0, invalidSale(gin.H{
+			"error":             "Subtotal does not match sale lines",
+			"expected_subtotal": roundMoney(subtotal),
+		})
+	}
+
+	// Validate that points value matches the loyalty discount (10 points = 1 baht)
+	expectedLoyaltyDiscount := float64(req.LoyaltyPointsUsed) * 0.1
+	if abs(req.LoyaltyDiscountAmount-expectedLoyaltyDiscount) > 0.01 {
+		return 0, 0, invalidSale(gin.H{
+			"error":                     "Loyalty points value does not match loyalty discount",
+			"expected_loyalty_discount": expectedLoyaltyDiscount,
+		})
+	}
+
+	// The points discount cannot exceed what is owed before it
+	grossTotal := req.Subtotal + req.TaxAmount - req.DiscountAmount
+	if expectedLoyaltyDiscount > grossTotal+0.01 {
+		return 0, 0, invalidSale(gin.H{"error": "Loyalty discount exceeds sale total"})
+	}
+
+	// Total is the net amount after the points discount; points are earned on this
+	netTotal := grossTotal - expectedLoyaltyDiscount
+	if abs(req.TotalAmount-netTotal) > 0.01 {
+		return 0, 0, invalidSale(gin.H{
+			"error":                 "Total amount does not match sale lines",
+			"expected_total_amount": netTotal,
+		})
+	}
+	return expectedLoyaltyDiscount, netTotal, nil
+}
+
+// salePayments returns the tenders for a sale, checking they add up to its total
+func salePayments(req CreateSaleRequest, total float64) ([]Payment, *saleError) {
+	if len(req.Payments) == 0 {
+		if req.PaymentMethod == "mixed" {
+			return nil, invalidSale(gin.H{"error": "Mixed payment requires payments"})
+		}
+		if total <= 0 {
+			return []Payment{}, nil
+		}
+		return []Payment{{PaymentMethod: req.PaymentMethod, Amount: total}}, nil
+	}
+
+	paid := 0.0
+	for _, payment := range req.Payments {
+		if req.PaymentMethod != "mixed" && payment.PaymentMethod != req.PaymentMethod {
+			return nil, invalidSale(gin.H{"error": "Payments must use payment_method unless it is mixed"})
+		}
+		paid += payment.Amount
+	}
+
+	if abs(paid-total) > 0.01 {
+		return nil, invalidSale(gin.H{
+			"error":                 "Payments do not add up to the total amount",
+			"expected_total_amount": total,
+		})
+	}
+	return req.Payments, nil
+}
+
+// newReceiptNumber returns a receipt number for a sale recorded now
+func newReceiptNumber() string {
+	now := time.Now()
+	return fmt.Sprintf("RCP-%s-%06d", now.Format("20060102-150405"), now.Nanosecond()/1000)
+}
+
+// redeemForSale spends a customer's points on a sale that is about to be recorded
+// Returns the redemption transaction to link to the sale.
+func redeemForSale(tx *sql.Tx, customerID, points int, discount float64) (sql.NullInt64, error) {
+	var redemptionID sql.NullInt64
+	_, err := tx.Exec("CALL apply_loyalty_redemption(?, ?, NULL, ?, @redemption_id)", customerID, points, discount)
+	if err != nil {
+		return redemptionID, err
+	}
+	err = tx.QueryRow("SELECT @redemption_id").Scan(&redemptionID)
+	return redemptionID, err
+}
+
+// recordSale inserts a sale with its payments and items, deducting stock for each item
+// Fills in the sale's ID and items.
+func recordSale(tx *sql.Tx, sale *Sale, items []CreateSaleItemRequest, redemptionID sql.NullInt64) *saleError {
+	query := `
+		INSERT INTO sales (
+			receipt_number, client_uuid, store_id, terminal_id, user_id, shift_id, customer_id, subtotal, tax_amount, 
+			discount_amount, loyalty_points_used, loyalty_discount_amount, 
+			total_amount, payment_method, payment_status, notes, created_at, synced_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	result, err := tx.Exec(query,
+		sale.ReceiptNumber, sale.ClientUUID, sale.StoreID, sale.TerminalID, sale.UserID, sale.ShiftID, sale.CustomerID,
+		sale.Subtotal, sale.TaxAmount, sale.DiscountAmount, sale.LoyaltyPointsUsed, sale.LoyaltyDiscountAmount,
+		sale.TotalAmount, sale.PaymentMethod, sale.PaymentStatus, sale.Notes, sale.CreatedAt, sale.SyncedAt,
+	)
+	if err != nil {
+		return failedSale("Failed to create sale", err)
+	}
+
+	saleID, err := result.LastInsertId()
+	if err != nil {
+		return failedSale("Failed to get sale ID", err)
+	}
+	sale.ID = int(saleID)
+
+	for _, payment := range sale.Payments {
+		_, err = tx.Exec(`
+			INSERT INTO payment_details (sale_id, payment_method, amount, card_last_four, transaction_id) 
+			VALUES (?, ?, ?, ?, ?)
+		`, saleID, payment.PaymentMethod, payment.Amount, payment.CardLastFour, payment.TransactionID)
+		if err != nil {
+			return failedSale("Failed to record payment", err)
+		}
+	}
+
+	if redemptionID.Valid {
+		_, err = tx.Exec("UPDATE loyalty_point_transactions SET sale_id = ? WHERE id = ?", saleID, redemptionID.Int64)
+		if err != nil {
+			return failedSale("Failed to link redemption to sale", err)
+		}
+	}
+
+	sale.Items = []SaleItem{}
+	for _, item := range items {
+		subtotal := float64(item.Quantity)*item.UnitPrice - item.DiscountAmount
+
+		itemResult, err := tx.Exec(`
+			INSERT INTO sale_items (sale_id, product_id, quantity, unit_price, discount_amount, subtotal) 
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, saleID, item.ProductID, item.Quantity, item.UnitPrice, item.DiscountAmount, subtotal)
+		if err != nil {
+			return &saleError{
+				status: http.StatusBadRequest,
+				body:   gin.H{"error": "Invalid sale item", "product_id": item.ProductID},
+				err:    err,
+			}
+		}
+
+		itemID, _ := itemResult.LastInsertId()
+
+		// Deduct stock and record the movement
+		_, err = tx.Exec("UPDATE products SET stock_quantity = stock_quantity - ? WHERE id = ?", item.Quantity, item.ProductID)
+		if err != nil {
+			return failedSale("Failed to update stock", err)
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO inventory_movements (product_id, movement_type, quantity_change, reference_id, notes) 
+			VALUES (?, 'sale', ?, ?, ?)
+		`, item.ProductID, -item.Quantity, saleID, "Sale #"+sale.ReceiptNumber)
+		if err != nil {
+			return failedSale("Failed to record inventory movement", err)
+		}
+
+		sale.Items = append(sale.Items, SaleItem{
+			ID:             int(itemID),
+			SaleID:         int(saleID),
+			ProductID:      item.ProductID,
+			ProductName:    item.ProductName,
+			Quantity:       item.Quantity,
+			UnitPrice:      item.UnitPrice,
+			DiscountAmount: item.DiscountAmount,
+			Subtotal:       subtotal,
+		})
+	}
+	return nil
+}
+
+// paidInCash reports whether any tender is cash
+func paidInCash(payments []Payment) bool {
+	for _, payment := range payments {
+		if payment.PaymentMethod == "cash" {
+			return true
+		}
+	}
+	return false
+}
+
+// discountOverLimit returns a sale's total discount, order and item discounts
+// together, and whether it is more than percent of the lines' gross, which
+// needs a manager override
+func discountOverLimit(req CreateSaleRequest, percent float64) (float64, bool) {
+	gross := 0.0
+	discount := req.DiscountAmount
+	for _, item := range req.Items {
+		gross += float64(item.Quantity) * item.UnitPrice
+		discount += item.DiscountAmount
+	}
+	return discount, gross > 0 && discount > gross*percent/100+0.005
+}
+
+// requireSaleOverrides consumes the overrides a cashier needs for changed prices and
+// discounts above the threshold; users who can approve overrides need none
+// A customer's group price counts as unchanged. Responds and returns false when
+// an approval is missing.
+func (h *SalesHandler) requireSaleOverrides(c *gin.Context, tx *sql.Tx, req CreateSaleRequest) ([]*managerOverride, bool) {
+	if middleware.HasPermission(currentRole(c), middleware.PermOverridesApprove) {
+		return nil, true
+	}
+
+	group, err := customerGroupOf(tx, req.CustomerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return nil, false
+	}
+
+	var overrides []*managerOverride
+	for _, item := range req.Items {
+		var listPrice float64
+		err := tx.QueryRow("SELECT price FROM products WHERE id = ?", item.ProductID).Scan(&listPrice)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sale item", "product_id": item.ProductID})
+			return nil, false
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return nil, false
+		}
+		if abs(item.UnitPrice-listPrice) < 0.005 {
+			continue
+		}
+		customerPrice, _, err := groupPrice(tx, group, item.ProductID, listPrice)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return nil, false
+		}
+		if abs(item.UnitPrice-customerPrice) < 0.005 {
+			continue
+		}
+
+		productID, unitPrice := item.ProductID, item.UnitPrice
+		override, err := consumeOverride(tx, c, OverridePriceOverride, func(o managerOverride) bool {
+			return o.ProductID != nil && *o.ProductID == productID &&
+				o.Amount != nil && abs(*o.Amount-unitPrice) < 0.005
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return nil, false
+		}
+		if override == nil {
+			respondOverrideRequired(c, OverridePriceOverride, gin.H{
+				"product_id":     productID,
+				"list_price":     listPrice,
+				"customer_price": customerPrice,
+				"unit_price":     unitPrice,
+			})
+			return nil, false
+		}
+		overrides = append(overrides, override)
+	}
+
+	if discount, over := discountOverLimit(req, h.overrideDiscountPercent); over {
+		override, err := consumeOverride(tx, c, OverrideDiscount, func(o managerOverride) bool {
+			return o.Amount != nil && *o.Amount+0.005 >= discount
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return nil, false
+		}
+		if override == nil {
+			respondOverrideRequired(c, OverrideDiscount, gin.H{
+				"discount_amount":  discount,
+				"max_discount_pct": h.overrideDiscountPercent,
+			})
+			return nil, false
+		}
+		overrides = append(overrides, override)
+	}
+
+	return overrides, true
+}
+
+// RefundSale refunds a completed sale, returning its stock and reversing its loyalty points
+// Cashiers need a refund override from a manager.
 func (h *SalesHandler) RefundSale(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"message": "Sale refund not implemented yet"})
+	h.reverseSale(c, OverrideRefund)
+}
+
+// VoidSale cancels a completed sale from the same day, returning its stock and
+// reversing its loyalty points
+// Cashiers need a void override from a manager.
+func (h *SalesHandler) VoidSale(c *gin.Context) {
+	h.reverseSale(c, OverrideVoid)
+}
+
+// ReverseSaleRequest represents a void or refund request body
+type ReverseSaleRequest struct {
+	Reason string `json:"reason" binding:"required,max=255"`
+}
+
+// reverseSale voids or refunds a sale in one transaction
+func (h *SalesHandler) reverseSale(c *gin.Context, action string) {
+	saleID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sale ID"})
+		return
+	}
+
+	var req ReverseSaleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	var receiptNumber, status string
+	var createdAt time.Time
+	err = tx.QueryRow(`
+		SELECT receipt_number, payment_status, created_at FROM sales WHERE id = ? FOR UPDATE
+	`, saleID).Scan(&receiptNumber, &status, &createdAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sale not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if status != "completed" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only completed sales can be reversed", "payment_status": status})
+		return
+	}
+	if action == OverrideVoid && createdAt.Format("2006-01-02") != time.Now().Format("2006-01-02") {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only sales from today can be voided; refund instead"})
+		return
+	}
+
+	var override *managerOverride
+	if !middleware.HasPermission(currentRole(c), middleware.PermSalesRefund) {
+		override, err = consumeOverride(tx, c, action, func(o managerOverride) bool {
+			return o.SaleID != nil && *o.SaleID == saleID
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if override == nil {
+			respondOverrideRequired(c, action, gin.H{"sale_id": saleID})
+			return
+		}
+	}
+
+	before := auditSnapshot(tx, "sales", saleID)
+
+	newStatus, movementNote := "refunded", "Refund of #"+receiptNumber
+	if action == OverrideVoid {
+		newStatus, movementNote = "voided", "Void of #"+receiptNumber
+	}
+
+	_, err = tx.Exec(`
+		UPDATE sales SET payment_status = ?,
+			notes = CONCAT_WS('\n', notes, ?)
+		WHERE id = ?
+	`, newStatus, fmt.Sprintf("%s: %s", movementNote, req.Reason), saleID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update sale"})
+		return
+	}
+
+	// Put the items back on the shelf
+	rows, err := tx.Query("SELECT product_id, quantity FROM sale_items WHERE sale_id = ?", saleID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	var items []SaleItem
+	for rows.Next() {
+		var item SaleItem
+		if err := rows.Scan(&item.ProductID, &item.Quantity); err != nil {
+			rows.Close()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		items = append(items, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	for _, item := range items {
+		_, err = tx.Exec("UPDATE products SET stock_quantity = stock_quantity + ? WHERE id = ?", item.Quantity, item.ProductID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update stock"})
+			return
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO inventory_movements (product_id, movement_type, quantity_change, reference_id, notes) 
+			VALUES (?, 'return', ?, ?, ?)
+		`, item.ProductID, item.Quantity, saleID, movementNote)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record inventory movement"})
+			return
+		}
+	}
+
+	// Take back points earned on the sale and return points redeemed on it
+	if _, err := tx.Exec("CALL reverse_sale_loyalty(?, ?)", saleID, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reverse loyalty points"})
+		return
+	}
+
+	// Cash handed back leaves the drawer of whoever is doing the refund
+	var cashRefunded float64
+	err = tx.QueryRow(`
+		SELECT COALESCE(SUM(amount), 0) FROM payment_details WHERE sale_id = ? AND payment_method = 'cash'
+	`, saleID).Scan(&cashRefunded)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if cashRefunded > 0 {
+		shift, err := findOpenShift(tx, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if shift == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "Open a shift before refunding cash", "code": "shift_required"})
+			return
+		}
+		_, err = tx.Exec(`
+			INSERT INTO shift_cash_movements (shift_id, movement_type, amount, reason, sale_id, created_by) 
+			VALUES (?, 'refund', ?, ?, ?, ?)
+		`, shift.ID, cashRefunded, movementNote, saleID, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record cash refund"})
+			return
+		}
+	}
+
+	if override != nil {
+		if err := linkOverrides(tx, []*managerOverride{override}, int64(saleID)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link override to sale"})
+			return
+		}
+	}
+
+	after := auditSnapshot(tx, "sales", saleID)
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit " + action})
+		return
+	}
+	middleware.AuditChange(c, "sale", saleID, before, after)
+	if override != nil {
+		middleware.AuditDetails(c, fmt.Sprintf("override #%d; %s", override.ID, req.Reason))
+	} else {
+		middleware.AuditDetails(c, req.Reason)
+	}
+
+	response := gin.H{
+		"message":        "Sale " + newStatus + " successfully",
+		"sale_id":        saleID,
+		"payment_status": newStatus,
+		"cash_refunded":  cashRefunded,
+	}
+	if override != nil {
+		response["override_id"] = override.ID
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 // GetDailyReport generates daily sales report
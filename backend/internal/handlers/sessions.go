@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// RefreshRequest represents token refresh request body
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// startSession creates a session for a freshly authenticated user and issues its tokens
+// Sessions started at a till pass the terminal ID and get register-scoped tokens;
+// mfaVerified records that the user also passed a second factor.
+func (h *AuthHandler) startSession(c *gin.Context, user User, terminalID *int, mfaVerified bool) (LoginResponse, error) {
+	sessionID, err := randomToken(16)
+	if err != nil {
+		return LoginResponse{}, err
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return LoginResponse{}, err
+	}
+	defer tx.Rollback()
+
+	// Only one cashier is signed in per till; a new login switches the register over
+	if terminalID != nil {
+		_, err = tx.Exec(`
+			UPDATE user_sessions SET revoked_at = NOW(), revoked_reason = 'cashier_switch'
+			WHERE terminal_id = ? AND revoked_at IS NULL
+		`, *terminalID)
+		if err != nil {
+			return LoginResponse{}, err
+		}
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO user_sessions (id, user_id, terminal_id, mfa_verified, user_agent, ip_address, last_used_at)
+		VALUES (?, ?, ?, ?, ?, ?, NOW())
+	`, sessionID, user.ID, terminalID, mfaVerified, truncate(c.Request.UserAgent(), 255), c.ClientIP())
+	if err != nil {
+		return LoginResponse{}, err
+	}
+
+	response, err := h.issueTokens(tx, user, sessionID, terminalID)
+	if err != nil {
+		return LoginResponse{}, err
+	}
+
+	err = tx.QueryRow("SELECT must_change_password FROM users WHERE id = ?", user.ID).Scan(&response.PasswordChangeRequired)
+	if err != nil {
+		return LoginResponse{}, err
+	}
+
+	return response, tx.Commit()
+}
+
+// issueTokens signs an access token and stores a new refresh token for the session
+func (h *AuthHandler) issueTokens(tx execer, user User, sessionID string, terminalID *int) (LoginResponse, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"user_id":  user.ID,
+		"username": user.Username,
+		"role":     user.Role,
+		"sid":      sessionID,
+		"iat":      now.Unix(),
+		"exp":      now.Add(h.accessTokenTTL).Unix(),
+	}
+	if terminalID != nil {
+		claims["tid"] = *terminalID
+		claims["scope"] = "register"
+	}
+	tokenString, err := h.keys.Sign(claims)
+	if err != nil {
+		return LoginResponse{}, err
+	}
+
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return LoginResponse{}, err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO refresh_tokens (session_id, token_hash, expires_at)
+		VALUES (?, ?, ?)
+	`, sessionID, hashToken(refreshToken), now.Add(h.refreshTokenTTL))
+	if err != nil {
+		return LoginResponse{}, err
+	}
+
+	return LoginResponse{
+		Token:        tokenString,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(h.accessTokenTTL.Seconds()),
+		User:         user,
+	}, nil
+}
+
+// Refresh exchanges a refresh token for a new token pair
+// Refresh tokens are single use; presenting a spent one revokes the whole session.
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var (
+		tokenID    int
+		sessionID  string
+		terminalID *int
+		expiresAt  time.Time
+		usedAt     *time.Time
+		revokedAt  *time.Time
+		user       User
+	)
+	query := `
+		SELECT rt.id, rt.session_id, s.terminal_id, rt.expires_at, rt.used_at, s.revoked_at,
+			u.id, u.username, u.email, u.full_name, u.role, u.store_id, u.is_active
+		FROM refresh_tokens rt
+		JOIN user_sessions s ON s.id = rt.session_id
+		JOIN users u ON u.id = s.user_id
+		WHERE rt.token_hash = ?
+		FOR UPDATE
+	`
+	err = tx.QueryRow(query, hashToken(req.RefreshToken)).Scan(
+		&tokenID, &sessionID, &terminalID, &expiresAt, &usedAt, &revokedAt,
+		&user.ID, &user.Username, &user.Email, &user.FullName,
+		&user.Role, &user.StoreID, &user.IsActive,
+	)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// A spent token being replayed means it leaked; kill the session
+	if usedAt != nil {
+		if err := revokeSession(tx, sessionID, "refresh_token_reuse"); err == nil {
+			tx.Commit()
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token already used; session revoked"})
+		return
+	}
+
+	if revokedAt != nil || !user.IsActive || time.Now().After(expiresAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE refresh_tokens SET used_at = NOW() WHERE id = ?", tokenID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if _, err := tx.Exec("UPDATE user_sessions SET last_used_at = NOW() WHERE id = ?", sessionID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	response, err := h.issueTokens(tx, user, sessionID, terminalID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// Logout revokes the caller's current session
+func (h *AuthHandler) Logout(c *gin.Context) {
+	sessionID := c.GetString("session_id")
+	if sessionID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid session"})
+		return
+	}
+
+	if err := revokeSession(h.db, sessionID, "logout"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// RevokeUserSessions revokes every session belonging to a user
+func (h *AuthHandler) RevokeUserSessions(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	revoked, err := revokeUserSessions(h.db, id, "revoked_by_admin")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "Sessions revoked successfully",
+		"sessions_revoked": revoked,
+	})
+}
+
+// revokeSession marks a single session revoked
+func revokeSession(db execer, sessionID, reason string) error {
+	_, err := db.Exec(`
+		UPDATE user_sessions SET revoked_at = NOW(), revoked_reason = ?
+		WHERE id = ? AND revoked_at IS NULL
+	`, reason, sessionID)
+	return err
+}
+
+// revokeUserSessions marks all of a user's active sessions revoked
+func revokeUserSessions(db execer, userID int, reason string) (int64, error) {
+	result, err := db.Exec(`
+		UPDATE user_sessions SET revoked_at = NOW(), revoked_reason = ?
+		WHERE user_id = ? AND revoked_at IS NULL
+	`, reason, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// randomToken returns n random bytes hex encoded
+func randomToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// hashToken returns the SHA-256 hex digest stored for a bearer secret
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// constantTimeEqual compares two secrets without leaking timing
+func constantTimeEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// truncate shortens s to at most n bytes
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// GetJWKS publishes the public keys that verify access tokens
+// Empty when tokens are signed with a shared HS256 secret.
+func (h *AuthHandler) GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.keys.JWKS())
+}
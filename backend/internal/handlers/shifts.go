@@ -0,0 +1,826 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"sck-pos-backend/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ShiftHandler handles cashier shifts, cash drawer movements and X/Z reports
+type ShiftHandler struct {
+	db *sql.DB
+}
+
+// NewShiftHandler creates a new shift handler
+func NewShiftHandler(db *sql.DB) *ShiftHandler {
+	return &ShiftHandler{db: db}
+}
+
+// Shift represents a cashier's session on a register
+type Shift struct {
+	ID           int        `json:"id"`
+	StoreID      int        `json:"store_id"`
+	TerminalID   int        `json:"terminal_id"`
+	UserID       int        `json:"user_id"`
+	Status       string     `json:"status"`
+	OpeningFloat float64    `json:"opening_float"`
+	OpenedAt     time.Time  `json:"opened_at"`
+	ClosedAt     *time.Time `json:"closed_at,omitempty"`
+	ClosedBy     *int       `json:"closed_by,omitempty"`
+	ExpectedCash *float64   `json:"expected_cash,omitempty"`
+	CountedCash  *float64   `json:"counted_cash,omitempty"`
+	Variance     *float64   `json:"variance,omitempty"`
+	Notes        *string    `json:"notes,omitempty"`
+	ZReportID    *int       `json:"z_report_id,omitempty"`
+}
+
+// ShiftReport is the drawer and sales summary of one or more shifts
+// An X report covers an open shift and changes nothing; a Z report covers a
+// register's closed shifts for the day.
+type ShiftReport struct {
+	ReportType   string             `json:"report_type"` // x, shift or z
+	ShiftIDs     []int              `json:"shift_ids"`
+	OpeningFloat float64            `json:"opening_float"`
+	CashSales    float64            `json:"cash_sales"`
+	CashRefunds  float64            `json:"cash_refunds"`
+	CashDrops    float64            `json:"cash_drops"`
+	PayOuts      float64            `json:"pay_outs"`
+	ExpectedCash float64            `json:"expected_cash"`
+	CountedCash  *float64           `json:"counted_cash,omitempty"`
+	Variance     *float64           `json:"variance,omitempty"` // counted minus expected; negative is short
+	SalesCount   int                `json:"sales_count"`
+	GrossSales   float64            `json:"gross_sales"`
+	Discounts    float64            `json:"discounts"`
+	Tax          float64            `json:"tax"`
+	VoidCount    int                `json:"void_count"`
+	VoidTotal    float64            `json:"void_total"`
+	RefundCount  int                `json:"refund_count"`
+	RefundTotal  float64            `json:"refund_total"`
+	NetSales     float64            `json:"net_sales"`
+	Tenders      map[string]float64 `json:"tenders"` // payments by method
+	GeneratedAt  time.Time          `json:"generated_at"`
+}
+
+// OpenShiftRequest represents open shift request body
+type OpenShiftRequest struct {
+	OpeningFloat float64 `json:"opening_float" binding:"min=0"`
+	// TerminalID is only needed when the session is not bound to a register
+	TerminalID *int    `json:"terminal_id"`
+	Notes      *string `json:"notes"`
+}
+
+// CashMovementRequest represents a cash drop or pay-out request body
+type CashMovementRequest struct {
+	MovementType string  `json:"movement_type" binding:"required,oneof=drop payout"`
+	Amount       float64 `json:"amount" binding:"gt=0"`
+	Reason       string  `json:"reason" binding:"required,max=255"`
+}
+
+// CloseShiftRequest represents close shift request body
+type CloseShiftRequest struct {
+	CountedCash float64 `json:"counted_cash" binding:"min=0"`
+	Notes       *string `json:"notes"`
+}
+
+// CreateZReportRequest represents end-of-day request body
+type CreateZReportRequest struct {
+	TerminalID int `json:"terminal_id" binding:"required"`
+}
+
+const shiftColumns = `
+	id, store_id, terminal_id, user_id, status, opening_float, opened_at, closed_at,
+	closed_by, expected_cash, counted_cash, variance, notes, z_report_id
+`
+
+// scanShift reads a row selected with shiftColumns
+func scanShift(row interface{ Scan(...interface{}) error }) (Shift, error) {
+	var s Shift
+	err := row.Scan(
+		&s.ID, &s.StoreID, &s.TerminalID, &s.UserID, &s.Status, &s.OpeningFloat, &s.OpenedAt, &s.ClosedAt,
+		&s.ClosedBy, &s.ExpectedCash, &s.CountedCash, &s.Variance, &s.Notes, &s.ZReportID,
+	)
+	return s, err
+}
+
+// findOpenShift returns the user's open shift, or nil if they have none
+func findOpenShift(q queryRower, userID int) (*Shift, error) {
+	shift, err := scanShift(q.QueryRow("SELECT "+shiftColumns+" FROM shifts WHERE user_id = ? AND status = 'open'", userID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &shift, nil
+}
+
+// OpenShift starts a shift on the caller's register with an opening float
+func (h *ShiftHandler) OpenShift(c *gin.Context) {
+	var req OpenShiftRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	// A register session can only open a shift on its own register
+	terminalID := currentTerminalID(c)
+	if terminalID == nil {
+		terminalID = req.TerminalID
+	} else if req.TerminalID != nil && *req.TerminalID != *terminalID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Session is bound to another terminal"})
+		return
+	}
+	if terminalID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "terminal_id is required"})
+		return
+	}
+
+	var storeID int
+	var active bool
+	err := h.db.QueryRow("SELECT store_id, is_active FROM terminals WHERE id = ?", *terminalID).Scan(&storeID, &active)
+	if err == sql.ErrNoRows || (err == nil && !active) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Terminal not found or disabled"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	user, err := findUser(h.db, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if user.StoreID != nil && *user.StoreID != storeID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "User is not assigned to this store"})
+		return
+	}
+
+	// The unique open_* columns reject a second open shift for the user or register
+	result, err := h.db.Exec(`
+		INSERT INTO shifts (store_id, terminal_id, user_id, opening_float, notes)
+		VALUES (?, ?, ?, ?, ?)
+	`, storeID, *terminalID, userID, req.OpeningFloat, req.Notes)
+	if isDuplicateKeyError(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "A shift is already open for this user or terminal"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open shift"})
+		return
+	}
+
+	id, _ := result.LastInsertId()
+	shift, err := scanShift(h.db.QueryRow("SELECT "+shiftColumns+" FROM shifts WHERE id = ?", id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	middleware.AuditChange(c, "shift", id, nil, shift)
+
+	c.JSON(http.StatusCreated, shift)
+}
+
+// GetCurrentShift returns the caller's open shift with its X report
+func (h *ShiftHandler) GetCurrentShift(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	shift, err := findOpenShift(h.db, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if shift == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No open shift"})
+		return
+	}
+
+	report, err := buildShiftReport(h.db, "x", []Shift{*shift})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build report"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"shift": shift, "report": report})
+}
+
+// GetShifts lists shifts, newest first (manager)
+// Filters: terminal_id, user_id, status, date (YYYY-MM-DD).
+func (h *ShiftHandler) GetShifts(c *gin.Context) {
+	query := "SELECT " + shiftColumns + " FROM shifts WHERE 1 = 1"
+	args := []interface{}{}
+
+	for _, filter := range []string{"terminal_id", "user_id", "status"} {
+		if value := c.Query(filter); value != "" {
+			query += " AND " + filter + " = ?"
+			args = append(args, value)
+		}
+	}
+	if date := c.Query("date"); date != "" {
+		day, err := time.ParseInLocation("2006-01-02", date, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date must be YYYY-MM-DD"})
+			return
+		}
+		query += " AND opened_at >= ? AND opened_at < ?"
+		args = append(args, day, day.AddDate(0, 0, 1))
+	}
+
+	query += " ORDER BY opened_at DESC LIMIT 200"
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	shifts := []Shift{}
+	for rows.Next() {
+		shift, err := scanShift(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan shift"})
+			return
+		}
+		shifts = append(shifts, shift)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"shifts": shifts})
+}
+
+// GetShift returns a shift with its report; an X report while it is open
+func (h *ShiftHandler) GetShift(c *gin.Context) {
+	shift, ok := h.loadShift(c, h.db, false)
+	if !ok {
+		return
+	}
+
+	reportType := "shift"
+	if shift.Status == "open" {
+		reportType = "x"
+	}
+	report, err := buildShiftReport(h.db, reportType, []Shift{shift})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build report"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"shift": shift, "report": report})
+}
+
+// GetXReport reads the drawer and sales totals of an open shift without closing it
+func (h *ShiftHandler) GetXReport(c *gin.Context) {
+	shift, ok := h.loadShift(c, h.db, false)
+	if !ok {
+		return
+	}
+	if shift.Status != "open" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Shift is closed; view it with GET /shifts/:id"})
+		return
+	}
+
+	report, err := buildShiftReport(h.db, "x", []Shift{shift})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build report"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// AddCashMovement records a cash drop to the safe or a pay-out from the drawer
+func (h *ShiftHandler) AddCashMovement(c *gin.Context) {
+	var req CashMovementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	shift, ok := h.loadShift(c, tx, true)
+	if !ok {
+		return
+	}
+	if shift.Status != "open" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Shift is closed"})
+		return
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO shift_cash_movements (shift_id, movement_type, amount, reason, created_by)
+		VALUES (?, ?, ?, ?, ?)
+	`, shift.ID, req.MovementType, req.Amount, req.Reason, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record cash movement"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record cash movement"})
+		return
+	}
+
+	id, _ := result.LastInsertId()
+	movement := gin.H{
+		"id":            id,
+		"shift_id":      shift.ID,
+		"movement_type": req.MovementType,
+		"amount":        req.Amount,
+		"reason":        req.Reason,
+	}
+	middleware.AuditChange(c, "shift", shift.ID, nil, movement)
+
+	c.JSON(http.StatusCreated, movement)
+}
+
+// CloseShift closes a shift with the counted cash and records the over/short variance
+func (h *ShiftHandler) CloseShift(c *gin.Context) {
+	var req CloseShiftRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	shift, ok := h.loadShift(c, tx, true)
+	if !ok {
+		return
+	}
+	if shift.Status != "open" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Shift is already closed"})
+		return
+	}
+	before := shift
+
+	report, err := buildShiftReport(tx, "shift", []Shift{shift})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build report"})
+		return
+	}
+	counted := roundMoney(req.CountedCash)
+	variance := roundMoney(counted - report.ExpectedCash)
+	report.CountedCash = &counted
+	report.Variance = &variance
+
+	notes := shift.Notes
+	if req.Notes != nil {
+		notes = req.Notes
+	}
+
+	_, err = tx.Exec(`
+		UPDATE shifts
+		SET status = 'closed', closed_at = NOW(), closed_by = ?, expected_cash = ?,
+			counted_cash = ?, variance = ?, notes = ?
+		WHERE id = ?
+	`, userID, report.ExpectedCash, counted, variance, notes, shift.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to close shift"})
+		return
+	}
+
+	shift, err = scanShift(tx.QueryRow("SELECT "+shiftColumns+" FROM shifts WHERE id = ?", shift.ID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to close shift"})
+		return
+	}
+	middleware.AuditChange(c, "shift", shift.ID, before, shift)
+
+	c.JSON(http.StatusOK, gin.H{"shift": shift, "report": report})
+}
+
+// ZReport represents a register's end-of-day report
+type ZReport struct {
+	ID             int         `json:"id"`
+	StoreID        int         `json:"store_id"`
+	TerminalID     int         `json:"terminal_id"`
+	SequenceNumber int         `json:"sequence_number"`
+	BusinessDate   string      `json:"business_date"`
+	ShiftCount     int         `json:"shift_count"`
+	NetSales       float64     `json:"net_sales"`
+	ExpectedCash   float64     `json:"expected_cash"`
+	CountedCash    float64     `json:"counted_cash"`
+	Variance       float64     `json:"variance"`
+	Report         ShiftReport `json:"report"`
+	CreatedBy      int         `json:"created_by"`
+	CreatedAt      time.Time   `json:"created_at"`
+}
+
+// CreateZReport closes the day for a register, totalling every closed shift not
+// yet in a Z report (manager)
+// All shifts on the register must be closed first.
+func (h *ShiftHandler) CreateZReport(c *gin.Context) {
+	var req CreateZReportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock the register's shifts so none open or close while the day is totalled
+	rows, err := tx.Query(
+		"SELECT "+shiftColumns+" FROM shifts WHERE terminal_id = ? AND z_report_id IS NULL ORDER BY id FOR UPDATE",
+		req.TerminalID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	var shifts []Shift
+	for rows.Next() {
+		shift, err := scanShift(rows)
+		if err != nil {
+			rows.Close()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan shift"})
+			return
+		}
+		shifts = append(shifts, shift)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if len(shifts) == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "No closed shifts to report on this terminal"})
+		return
+	}
+
+	counted := 0.0
+	for _, shift := range shifts {
+		if shift.Status == "open" {
+			c.JSON(http.StatusConflict, gin.H{"error": "Close the open shift first", "shift_id": shift.ID})
+			return
+		}
+		counted += *shift.CountedCash
+	}
+
+	report, err := buildShiftReport(tx, "z", shifts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build report"})
+		return
+	}
+	counted = roundMoney(counted)
+	variance := roundMoney(counted - report.ExpectedCash)
+	report.CountedCash = &counted
+	report.Variance = &variance
+
+	var sequence int
+	err = tx.QueryRow(
+		"SELECT COALESCE(MAX(sequence_number), 0) + 1 FROM z_reports WHERE terminal_id = ?", req.TerminalID,
+	).Scan(&sequence)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	reportData, err := json.Marshal(report)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build report"})
+		return
+	}
+
+	businessDate := time.Now().Format("2006-01-02")
+	result, err := tx.Exec(`
+		INSERT INTO z_reports (
+			store_id, terminal_id, sequence_number, business_date, shift_count, net_sales,
+			expected_cash, counted_cash, variance, report_data, created_by
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, shifts[0].StoreID, req.TerminalID, sequence, businessDate, len(shifts), report.NetSales,
+		report.ExpectedCash, counted, variance, string(reportData), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save Z report"})
+		return
+	}
+	zReportID, _ := result.LastInsertId()
+
+	placeholders, args := inClause(report.ShiftIDs)
+	_, err = tx.Exec("UPDATE shifts SET z_report_id = ? WHERE id IN ("+placeholders+")", append([]interface{}{zReportID}, args...)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save Z report"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save Z report"})
+		return
+	}
+
+	zReport := ZReport{
+		ID:             int(zReportID),
+		StoreID:        shifts[0].StoreID,
+		TerminalID:     req.TerminalID,
+		SequenceNumber: sequence,
+		BusinessDate:   businessDate,
+		ShiftCount:     len(shifts),
+		NetSales:       report.NetSales,
+		ExpectedCash:   report.ExpectedCash,
+		CountedCash:    counted,
+		Variance:       variance,
+		Report:         report,
+		CreatedBy:      userID,
+		CreatedAt:      time.Now(),
+	}
+	middleware.AuditChange(c, "z_report", zReportID, nil, zReport)
+
+	c.JSON(http.StatusCreated, zReport)
+}
+
+const zReportColumns = `
+	id, store_id, terminal_id, sequence_number, business_date, shift_count, net_sales,
+	expected_cash, counted_cash, variance, report_data, created_by, created_at
+`
+
+// scanZReport reads a row selected with zReportColumns
+func scanZReport(row interface{ Scan(...interface{}) error }) (ZReport, error) {
+	var z ZReport
+	var businessDate time.Time
+	var reportData string
+	err := row.Scan(
+		&z.ID, &z.StoreID, &z.TerminalID, &z.SequenceNumber, &businessDate, &z.ShiftCount, &z.NetSales,
+		&z.ExpectedCash, &z.CountedCash, &z.Variance, &reportData, &z.CreatedBy, &z.CreatedAt,
+	)
+	if err != nil {
+		return z, err
+	}
+	z.BusinessDate = businessDate.Format("2006-01-02")
+	return z, json.Unmarshal([]byte(reportData), &z.Report)
+}
+
+// GetZReports lists Z reports, newest first (manager)
+// Filters: terminal_id, store_id, date (YYYY-MM-DD).
+func (h *ShiftHandler) GetZReports(c *gin.Context) {
+	query := "SELECT " + zReportColumns + " FROM z_reports WHERE 1 = 1"
+	args := []interface{}{}
+
+	for _, filter := range []string{"terminal_id", "store_id"} {
+		if value := c.Query(filter); value != "" {
+			query += " AND " + filter + " = ?"
+			args = append(args, value)
+		}
+	}
+	if date := c.Query("date"); date != "" {
+		query += " AND business_date = ?"
+		args = append(args, date)
+	}
+
+	query += " ORDER BY id DESC LIMIT 200"
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	reports := []ZReport{}
+	for rows.Next() {
+		z, err := scanZReport(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan Z report"})
+			return
+		}
+		reports = append(reports, z)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"z_reports": reports})
+}
+
+// GetZReport retrieves a single Z report (manager)
+func (h *ShiftHandler) GetZReport(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Z report ID"})
+		return
+	}
+
+	z, err := scanZReport(h.db.QueryRow("SELECT "+zReportColumns+" FROM z_reports WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Z report not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, z)
+}
+
+// loadShift loads the shift named in the route, locking it when forUpdate is set
+// Cashiers can only reach their own shifts. Responds and returns false on failure.
+func (h *ShiftHandler) loadShift(c *gin.Context, q queryRower, forUpdate bool) (Shift, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shift ID"})
+		return Shift{}, false
+	}
+
+	query := "SELECT " + shiftColumns + " FROM shifts WHERE id = ?"
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+	shift, err := scanShift(q.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Shift not found"})
+		return Shift{}, false
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return Shift{}, false
+	}
+
+	userID, _ := currentUserID(c)
+	if shift.UserID != userID && !middleware.HasPermission(currentRole(c), middleware.PermShiftsManage) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Shift belongs to another user"})
+		return Shift{}, false
+	}
+	return shift, true
+}
+
+// buildShiftReport totals the drawer and sales of the given shifts
+func buildShiftReport(q interface {
+	queryRower
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}, reportType string, shifts []Shift) (ShiftReport, error) {
+	report := ShiftReport{
+		ReportType:  reportType,
+		Tenders:     map[string]float64{},
+		GeneratedAt: time.Now(),
+	}
+	for _, shift := range shifts {
+		report.ShiftIDs = append(report.ShiftIDs, shift.ID)
+		report.OpeningFloat += shift.OpeningFloat
+	}
+	placeholders, args := inClause(report.ShiftIDs)
+
+	// Every tender taken during the shifts, including sales later voided or
+	// refunded; cash handed back is counted as a refund movement instead
+	rows, err := q.Query(`
+		SELECT pd.payment_method, COALESCE(SUM(pd.amount), 0)
+		FROM payment_details pd
+		JOIN sales s ON s.id = pd.sale_id
+		WHERE s.shift_id IN (`+placeholders+`)
+		GROUP BY pd.payment_method
+	`, args...)
+	if err != nil {
+		return report, err
+	}
+	for rows.Next() {
+		var method string
+		var amount float64
+		if err := rows.Scan(&method, &amount); err != nil {
+			rows.Close()
+			return report, err
+		}
+		report.Tenders[method] = amount
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return report, err
+	}
+	report.CashSales = report.Tenders["cash"]
+
+	err = q.QueryRow(`
+		SELECT
+			COUNT(*),
+			COALESCE(SUM(subtotal + tax_amount), 0),
+			COALESCE(SUM(discount_amount + loyalty_discount_amount), 0),
+			COALESCE(SUM(tax_amount), 0),
+			COALESCE(SUM(payment_status = 'voided'), 0),
+			COALESCE(SUM(CASE WHEN payment_status = 'voided' THEN total_amount ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN payment_status = 'completed' THEN total_amount ELSE 0 END), 0)
+		FROM sales
+		WHERE shift_id IN (`+placeholders+`)
+	`, args...).Scan(
+		&report.SalesCount, &report.GrossSales, &report.Discounts, &report.Tax,
+		&report.VoidCount, &report.VoidTotal, &report.NetSales,
+	)
+	if err != nil {
+		return report, err
+	}
+
+	// Refunds are counted in the shift that paid them out, whenever the sale was made
+	err = q.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(s.total_amount), 0)
+		FROM sales s
+		WHERE s.payment_status = 'refunded'
+		  AND s.id IN (
+			SELECT sale_id FROM shift_cash_movements
+			WHERE movement_type = 'refund' AND shift_id IN (`+placeholders+`)
+		  )
+	`, args...).Scan(&report.RefundCount, &report.RefundTotal)
+	if err != nil {
+		return report, err
+	}
+
+	rows, err = q.Query(`
+		SELECT movement_type, COALESCE(SUM(amount), 0)
+		FROM shift_cash_movements
+		WHERE shift_id IN (`+placeholders+`)
+		GROUP BY movement_type
+	`, args...)
+	if err != nil {
+		return report, err
+	}
+	for rows.Next() {
+		var movementType string
+		var amount float64
+		if err := rows.Scan(&movementType, &amount); err != nil {
+			rows.Close()
+			return report, err
+		}
+		switch movementType {
+		case "drop":
+			report.CashDrops = amount
+		case "payout":
+			report.PayOuts = amount
+		case "refund":
+			report.CashRefunds = amount
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return report, err
+	}
+
+	report.ExpectedCash = roundMoney(report.OpeningFloat + report.CashSales - report.CashRefunds - report.CashDrops - report.PayOuts)
+	return report, nil
+}
+
+// inClause returns "?, ?, ?" and the matching arguments for ids
+func inClause(ids []int) (string, []interface{}) {
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", "), args
+}
+
+// roundMoney rounds to the satang
+func roundMoney(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -0,0 +1,644 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"sck-pos-backend/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+)
+
+// SyncHandler handles offline terminal synchronisation
+type SyncHandler struct {
+	db *sql.DB
+	// overrideDiscountPercent is the share of the subtotal a cashier can discount
+	// without a manager, as for online sales
+	overrideDiscountPercent float64
+}
+
+// NewSyncHandler creates a new sync handler
+func NewSyncHandler(db *sql.DB, overrideDiscountPercent float64) *SyncHandler {
+	return &SyncHandler{db: db, overrideDiscountPercent: overrideDiscountPercent}
+}
+
+// Outcomes of uploading an offline sale
+const (
+	SyncStatusCreated   = "created"
+	SyncStatusDuplicate = "duplicate"
+	SyncStatusRejected  = "rejected"
+)
+
+// Problems recorded against an offline sale that was accepted anyway
+const (
+	ConflictNegativeStock      = "negative_stock"
+	ConflictPriceMismatch      = "price_mismatch"
+	ConflictInsufficientPoints = "insufficient_points"
+	ConflictCustomerNotFound   = "customer_not_found"
+	ConflictDiscountOverride   = "discount_override"
+)
+
+// offlineClockSkew is how far in the future a terminal's sale time may be
+const offlineClockSkew = 5 * time.Minute
+
+// OfflineSale is a sale rung up while the terminal could not reach the server
+type OfflineSale struct {
+	ClientUUID string    `json:"client_uuid" binding:"required,uuid"`
+	CreatedAt  time.Time `json:"created_at" binding:"required"` // when the sale was rung up
+	CreateSaleRequest
+}
+
+// SyncSalesRequest represents an offline sales upload
+type SyncSalesRequest struct {
+	Sales []OfflineSale `json:"sales" binding:"required,min=1,max=100,dive"`
+}
+
+// SyncConflict is a problem with an offline sale that a manager should review
+type SyncConflict struct {
+	ID              int        `json:"id,omitempty"`
+	SaleID          int        `json:"sale_id,omitempty"`
+	TerminalID      int        `json:"terminal_id,omitempty"`
+	Type            string     `json:"type"`
+	ProductID       *int       `json:"product_id,omitempty"`
+	Details         string     `json:"details"`
+	ResolvedAt      *time.Time `json:"resolved_at,omitempty"`
+	ResolvedBy      *int       `json:"resolved_by,omitempty"`
+	ResolutionNotes *string    `json:"resolution_notes,omitempty"`
+	CreatedAt       *time.Time `json:"created_at,omitempty"`
+}
+
+// SyncSaleResult reports what happened to one uploaded sale
+type SyncSaleResult struct {
+	ClientUUID    string         `json:"client_uuid"`
+	Status        string         `json:"status"`
+	SaleID        int            `json:"sale_id,omitempty"`
+	ReceiptNumber string         `json:"receipt_number,omitempty"`
+	Conflicts     []SyncConflict `json:"conflicts,omitempty"`
+	Error         string         `json:"error,omitempty"`
+}
+
+// ResolveConflictRequest represents a conflict resolution request body
+type ResolveConflictRequest struct {
+	Notes string `json:"notes" binding:"required,max=255"`
+}
+
+// SyncSales records sales a terminal made while offline
+// Each sale is committed on its own and identified by its client_uuid, so a
+// batch can be retried safely: sales already recorded come back as duplicates
+// with their receipt numbers. The goods have already left the shop, so stock,
+// price, discount and loyalty problems do not reject a sale; they are returned
+// as conflicts and kept for a manager to review.
+func (h *SyncHandler) SyncSales(c *gin.Context) {
+	var req SyncSalesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	terminalID := currentTerminalID(c)
+	if terminalID == nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Offline sales can only be synced from a registered terminal"})
+		return
+	}
+
+	var storeID int
+	if err := h.db.QueryRow("SELECT store_id FROM terminals WHERE id = ?", *terminalID).Scan(&storeID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	results := make([]SyncSaleResult, 0, len(req.Sales))
+	counts := map[string]int{}
+	conflicts := 0
+	for _, sale := range req.Sales {
+		result, err := h.syncSale(userID, currentRole(c), *terminalID, storeID, sale)
+		if err != nil {
+			// Sales before this one are committed; the terminal retries the rest
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sync sales", "results": results})
+			return
+		}
+		results = append(results, result)
+		counts[result.Status]++
+		conflicts += len(result.Conflicts)
+	}
+
+	middleware.AuditDetails(c, fmt.Sprintf("terminal #%d: %d created, %d duplicate, %d rejected, %d conflicts",
+		*terminalID, counts[SyncStatusCreated], counts[SyncStatusDuplicate], counts[SyncStatusRejected], conflicts))
+
+	c.JSON(http.StatusOK, gin.H{
+		"results":    results,
+		"created":    counts[SyncStatusCreated],
+		"duplicates": counts[SyncStatusDuplicate],
+		"rejected":   counts[SyncStatusRejected],
+		"conflicts":  conflicts,
+	})
+}
+
+// syncSale records one offline sale in its own transaction
+// Problems with the sale itself are reported in the result; the error is for
+// database failures only.
+func (h *SyncHandler) syncSale(userID int, role string, terminalID, storeID int, offline OfflineSale) (SyncSaleResult, error) {
+	result := SyncSaleResult{ClientUUID: offline.ClientUUID}
+	req := offline.CreateSaleRequest
+
+	if found, err := h.findSyncedSale(&result); err != nil || found {
+		return result, err
+	}
+
+	reject := func(message string) (SyncSaleResult, error) {
+		result.Status = SyncStatusRejected
+		result.Error = message
+		return result, nil
+	}
+
+	if req.StoreID != 0 && req.StoreID != storeID {
+		return reject("Sale store does not match the terminal's store")
+	}
+	if offline.CreatedAt.After(time.Now().Add(offlineClockSkew)) {
+		return reject("created_at is in the future")
+	}
+	if req.PaymentStatus == "" {
+		req.PaymentStatus = "completed"
+	}
+
+	loyaltyDiscount, netTotal, saleErr := checkSaleTotals(req)
+	if saleErr != nil {
+		return reject(saleErr.Error())
+	}
+	payments, saleErr := salePayments(req, netTotal)
+	if saleErr != nil {
+		return reject(saleErr.Error())
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+
+	var conflicts []SyncConflict
+
+	// Customers merged while the terminal was offline buy on the kept customer's account
+	if req.CustomerID != nil {
+		customerID, err := survivingCustomerID(tx, *req.CustomerID)
+		if err != nil {
+			return result, err
+		}
+		if customerID == 0 {
+			conflicts = append(conflicts, SyncConflict{
+				Type:    ConflictCustomerNotFound,
+				Details: fmt.Sprintf("Customer %d no longer exists; sale recorded without a customer", *req.CustomerID),
+			})
+			req.CustomerID = nil
+		} else {
+			req.CustomerID = &customerID
+		}
+	}
+
+	// Prices may have changed while the terminal was offline; no override was
+	// possible. Group members may pay their group's price.
+	group, err := customerGroupOf(tx, req.CustomerID)
+	if err != nil {
+		return result, err
+	}
+	for _, item := range req.Items {
+		var listPrice float64
+		err := tx.QueryRow("SELECT price FROM products WHERE id = ?", item.ProductID).Scan(&listPrice)
+		if err == sql.ErrNoRows {
+			return reject(fmt.Sprintf("Unknown product %d", item.ProductID))
+		} else if err != nil {
+			return result, err
+		}
+		if abs(item.UnitPrice-listPrice) < 0.005 {
+			continue
+		}
+		customerPrice, _, err := groupPrice(tx, group, item.ProductID, listPrice)
+		if err != nil {
+			return result, err
+		}
+		if abs(item.UnitPrice-customerPrice) >= 0.005 {
+			productID := item.ProductID
+			conflicts = append(conflicts, SyncConflict{
+				Type:      ConflictPriceMismatch,
+				ProductID: &productID,
+				Details:   fmt.Sprintf("Sold at %.2f, list price is %.2f, customer price is %.2f", item.UnitPrice, listPrice, customerPrice),
+			})
+		}
+	}
+
+	// No manager could approve a large discount offline, so one is reviewed afterwards
+	if discount, over := discountOverLimit(req, h.overrideDiscountPercent); over &&
+		!middleware.HasPermission(role, middleware.PermOverridesApprove) {
+		conflicts = append(conflicts, SyncConflict{
+			Type:    ConflictDiscountOverride,
+			Details: fmt.Sprintf("Discount of %.2f is over the %.0f%% limit without a manager override", discount, h.overrideDiscountPercent),
+		})
+	}
+
+	// The discount was given at the till; when the points are gone the sale keeps
+	// the discount but no points are taken, and a manager settles the difference
+	pointsUsed := req.LoyaltyPointsUsed
+	var redemptionID sql.NullInt64
+	if pointsUsed > 0 && req.CustomerID == nil {
+		pointsUsed = 0
+	} else if pointsUsed > 0 {
+		redemptionID, err = redeemForSale(tx, *req.CustomerID, pointsUsed, loyaltyDiscount)
+		if isInsufficientPointsError(err) {
+			conflicts = append(conflicts, SyncConflict{
+				Type:    ConflictInsufficientPoints,
+				Details: fmt.Sprintf("Customer %d no longer has %d points; discount of %.2f given without redeeming", *req.CustomerID, pointsUsed, loyaltyDiscount),
+			})
+			pointsUsed = 0
+		} else if err != nil {
+			return result, err
+		}
+	}
+
+	// Count the sale in the cashier's shift if it was open on this till at the time
+	shift, err := findOpenShift(tx, userID)
+	if err != nil {
+		return result, err
+	}
+	var shiftID *int
+	if shift != nil && shift.TerminalID == terminalID && !offline.CreatedAt.Before(shift.OpenedAt) {
+		shiftID = &shift.ID
+	}
+
+	clientUUID := offline.ClientUUID
+	syncedAt := time.Now()
+	sale := Sale{
+		ReceiptNumber:         newReceiptNumber(),
+		ClientUUID:            &clientUUID,
+		StoreID:               storeID,
+		TerminalID:            &terminalID,
+		UserID:                userID,
+		ShiftID:               shiftID,
+		CustomerID:            req.CustomerID,
+		Subtotal:              req.Subtotal,
+		TaxAmount:             req.TaxAmount,
+		DiscountAmount:        req.DiscountAmount,
+		LoyaltyPointsUsed:     pointsUsed,
+		LoyaltyDiscountAmount: loyaltyDiscount,
+		TotalAmount:           netTotal,
+		PaymentMethod:         req.PaymentMethod,
+		PaymentStatus:         req.PaymentStatus,
+		Notes:                 req.Notes,
+		CreatedAt:             offline.CreatedAt,
+		SyncedAt:              &syncedAt,
+		Payments:              payments,
+	}
+	if saleErr := recordSale(tx, &sale, req.Items, redemptionID); saleErr != nil {
+		if isDuplicateKeyError(saleErr.err) {
+			// Another upload of the same sale won the race, unless the receipt
+			// number collided with another till's; then the terminal retries
+			// and the sale gets a new number
+			tx.Rollback()
+			found, err := h.findSyncedSale(&result)
+			if err == nil && !found {
+				err = fmt.Errorf("sale %s: %w", offline.ClientUUID, saleErr.err)
+			}
+			return result, err
+		}
+		if saleErr.status == http.StatusBadRequest {
+			return reject(saleErr.Error())
+		}
+		return result, saleErr
+	}
+
+	// Selling what the server thought was out of stock leaves it negative
+	ids := make([]int, 0, len(req.Items))
+	for _, item := range req.Items {
+		ids = append(ids, item.ProductID)
+	}
+	in, args := inClause(ids)
+	rows, err := tx.Query("SELECT id, stock_quantity FROM products WHERE stock_quantity < 0 AND id IN ("+in+")", args...)
+	if err != nil {
+		return result, err
+	}
+	for rows.Next() {
+		var productID, stock int
+		if err := rows.Scan(&productID, &stock); err != nil {
+			rows.Close()
+			return result, err
+		}
+		conflicts = append(conflicts, SyncConflict{
+			Type:      ConflictNegativeStock,
+			ProductID: &productID,
+			Details:   fmt.Sprintf("Stock is now %d", stock),
+		})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return result, err
+	}
+
+	for i := range conflicts {
+		conflicts[i].SaleID = sale.ID
+		conflicts[i].TerminalID = terminalID
+		res, err := tx.Exec(`
+			INSERT INTO sync_conflicts (sale_id, terminal_id, conflict_type, product_id, details)
+			VALUES (?, ?, ?, ?, ?)
+		`, sale.ID, terminalID, conflicts[i].Type, conflicts[i].ProductID, conflicts[i].Details)
+		if err != nil {
+			return result, err
+		}
+		id, _ := res.LastInsertId()
+		conflicts[i].ID = int(id)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return result, err
+	}
+
+	result.Status = SyncStatusCreated
+	result.SaleID = sale.ID
+	result.ReceiptNumber = sale.ReceiptNumber
+	result.Conflicts = conflicts
+	return result, nil
+}
+
+// findSyncedSale fills in the result when the sale was uploaded before
+func (h *SyncHandler) findSyncedSale(result *SyncSaleResult) (bool, error) {
+	err := h.db.QueryRow(
+		"SELECT id, receipt_number FROM sales WHERE client_uuid = ?", result.ClientUUID,
+	).Scan(&result.SaleID, &result.ReceiptNumber)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	result.Status = SyncStatusDuplicate
+	return true, nil
+}
+
+// isDuplicateKeyError reports whether err is a unique index violation
+func isDuplicateKeyError(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062
+}
+
+// isForeignKeyError reports whether err is a reference to a row that does not exist
+func isForeignKeyError(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1452
+}
+
+// GetSyncConflicts lists offline sync conflicts, oldest first
+// Filters: status (open, resolved or all; default open), terminal_id, type.
+func (h *SyncHandler) GetSyncConflicts(c *gin.Context) {
+	query := `
+		SELECT id, sale_id, terminal_id, conflict_type, product_id, details,
+			resolved_at, resolved_by, resolution_notes, created_at
+		FROM sync_conflicts
+		WHERE 1 = 1
+	`
+	args := []interface{}{}
+
+	switch c.DefaultQuery("status", "open") {
+	case "open":
+		query += " AND resolved_at IS NULL"
+	case "resolved":
+		query += " AND resolved_at IS NOT NULL"
+	case "all":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be open, resolved or all"})
+		return
+	}
+	if terminalID := c.Query("terminal_id"); terminalID != "" {
+		query += " AND terminal_id = ?"
+		args = append(args, terminalID)
+	}
+	if conflictType := c.Query("type"); conflictType != "" {
+		query += " AND conflict_type = ?"
+		args = append(args, conflictType)
+	}
+	query += " ORDER BY created_at, id LIMIT 500"
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	conflicts := []SyncConflict{}
+	for rows.Next() {
+		conflict, err := scanSyncConflict(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan sync conflict"})
+			return
+		}
+		conflicts = append(conflicts, conflict)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"conflicts": conflicts})
+}
+
+// ResolveSyncConflict marks a conflict as dealt with
+func (h *SyncHandler) ResolveSyncConflict(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid conflict ID"})
+		return
+	}
+
+	var req ResolveConflictRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	result, err := h.db.Exec(`
+		UPDATE sync_conflicts SET resolved_at = NOW(), resolved_by = ?, resolution_notes = ?
+		WHERE id = ? AND resolved_at IS NULL
+	`, userID, req.Notes, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve conflict"})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		var exists bool
+		h.db.QueryRow("SELECT EXISTS(SELECT 1 FROM sync_conflicts WHERE id = ?)", id).Scan(&exists)
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Sync conflict not found"})
+		} else {
+			c.JSON(http.StatusConflict, gin.H{"error": "Sync conflict is already resolved"})
+		}
+		return
+	}
+	middleware.AuditDetails(c, req.Notes)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Sync conflict resolved"})
+}
+
+// scanSyncConflict reads a sync_conflicts row
+func scanSyncConflict(row interface{ Scan(...interface{}) error }) (SyncConflict, error) {
+	var s SyncConflict
+	err := row.Scan(
+		&s.ID, &s.SaleID, &s.TerminalID, &s.Type, &s.ProductID, &s.Details,
+		&s.ResolvedAt, &s.ResolvedBy, &s.ResolutionNotes, &s.CreatedAt,
+	)
+	return s, err
+}
+
+// catalogCursor is how far a terminal has read the catalog; clients see it as an opaque string
+type catalogCursor struct {
+	Products   syncPosition `json:"p"`
+	Categories syncPosition `json:"c"`
+	DeletionID int          `json:"d"`
+}
+
+// syncPosition is the last row read in (updated_at, id) order
+type syncPosition struct {
+	UpdatedAt int64 `json:"t"`
+	ID        int   `json:"id"`
+}
+
+// CatalogDeletion is a product or category that was deleted outright
+type CatalogDeletion struct {
+	EntityType string    `json:"entity_type"`
+	EntityID   int       `json:"entity_id"`
+	DeletedAt  time.Time `json:"deleted_at"`
+}
+
+// GetCatalogChanges returns products and categories changed since the cursor
+// An empty cursor returns the whole catalog. Deactivated rows are included so
+// terminals can hide them, and hard deletes are listed separately. Keep calling
+// with next_cursor while has_more is true, then store it for the next sync.
+func (h *SyncHandler) GetCatalogChanges(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "500"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 1000"})
+		return
+	}
+
+	var cursor catalogCursor
+	if value := c.Query("cursor"); value != "" {
+		data, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil || json.Unmarshal(data, &cursor) != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return
+		}
+	}
+
+	// Rows changed in the current second are left for the next call, so a later
+	// change stamped with the same second cannot slip behind the cursor
+	products := []Product{}
+	rows, err := h.db.Query(`
+		SELECT id, sku, name, description, category_id, price, stock_quantity, min_stock_level,
+			barcode, image_url, is_active, updated_at
+		FROM products
+		WHERE updated_at < NOW() AND (updated_at > ? OR (updated_at = ? AND id > ?))
+		ORDER BY updated_at, id
+		LIMIT ?
+	`, cursor.Products.args(limit)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	for rows.Next() {
+		var p Product
+		err := rows.Scan(
+			&p.ID, &p.SKU, &p.Name, &p.Description, &p.CategoryID, &p.Price, &p.StockQuantity,
+			&p.MinStockLevel, &p.Barcode, &p.ImageURL, &p.IsActive, &p.UpdatedAt,
+		)
+		if err != nil {
+			rows.Close()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan product"})
+			return
+		}
+		products = append(products, p)
+		cursor.Products = syncPosition{UpdatedAt: p.UpdatedAt.Unix(), ID: p.ID}
+	}
+	rows.Close()
+
+	categories := []Category{}
+	rows, err = h.db.Query(`
+		SELECT id, name, description, is_active, updated_at
+		FROM categories
+		WHERE updated_at < NOW() AND (updated_at > ? OR (updated_at = ? AND id > ?))
+		ORDER BY updated_at, id
+		LIMIT ?
+	`, cursor.Categories.args(limit)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	for rows.Next() {
+		var cat Category
+		if err := rows.Scan(&cat.ID, &cat.Name, &cat.Description, &cat.IsActive, &cat.UpdatedAt); err != nil {
+			rows.Close()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan category"})
+			return
+		}
+		categories = append(categories, cat)
+		cursor.Categories = syncPosition{UpdatedAt: cat.UpdatedAt.Unix(), ID: cat.ID}
+	}
+	rows.Close()
+
+	deletions := []CatalogDeletion{}
+	rows, err = h.db.Query(`
+		SELECT id, entity_type, entity_id, deleted_at
+		FROM catalog_deletions
+		WHERE id > ?
+		ORDER BY id
+		LIMIT ?
+	`, cursor.DeletionID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	for rows.Next() {
+		var d CatalogDeletion
+		if err := rows.Scan(&cursor.DeletionID, &d.EntityType, &d.EntityID, &d.DeletedAt); err != nil {
+			rows.Close()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan catalog deletion"})
+			return
+		}
+		deletions = append(deletions, d)
+	}
+	rows.Close()
+
+	next, err := json.Marshal(cursor)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode cursor"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"products":    products,
+		"categories":  categories,
+		"deletions":   deletions,
+		"next_cursor": base64.RawURLEncoding.EncodeToString(next),
+		"has_more":    len(products) == limit || len(categories) == limit || len(deletions) == limit,
+	})
+}
+
+// args returns the query arguments for rows after the position
+func (p syncPosition) args(limit int) []interface{} {
+	t := time.Unix(p.UpdatedAt, 0)
+	return []interface{}{t, t, p.ID, limit}
+}
@@ -0,0 +1,394 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"sck-pos-backend/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TerminalHandler handles terminal (till) related requests
+type TerminalHandler struct {
+	db *sql.DB
+}
+
+// NewTerminalHandler creates a new terminal handler
+func NewTerminalHandler(db *sql.DB) *TerminalHandler {
+	return &TerminalHandler{db: db}
+}
+
+// Terminal represents an enrolled till
+type Terminal struct {
+	ID             int        `json:"id"`
+	StoreID        int        `json:"store_id"`
+	Name           string     `json:"name"`
+	IsActive       bool       `json:"is_active"`
+	LastSeenAt     *time.Time `json:"last_seen_at,omitempty"`
+	DisabledAt     *time.Time `json:"disabled_at,omitempty"`
+	DisabledBy     *int       `json:"disabled_by,omitempty"`
+	DisabledReason *string    `json:"disabled_reason,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// CreateTerminalRequest represents terminal enrollment request body
+type CreateTerminalRequest struct {
+	StoreID int    `json:"store_id" binding:"required"`
+	Name    string `json:"name" binding:"required,max=100"`
+}
+
+// CreateTerminal enrolls a new terminal and returns its device secret once
+func (h *TerminalHandler) CreateTerminal(c *gin.Context) {
+	var req CreateTerminalRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	createdBy, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	secret, err := randomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate device secret"})
+		return
+	}
+
+	query := `
+		INSERT INTO terminals (store_id, name, device_secret_hash, created_by) 
+		VALUES (?, ?, ?, ?)
+	`
+
+	result, err := h.db.Exec(query, req.StoreID, req.Name, hashToken(secret), createdBy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to enroll terminal"})
+		return
+	}
+
+	id, _ := result.LastInsertId()
+	middleware.AuditChange(c, "terminal", id, nil, auditSnapshot(h.db, "terminals", id))
+
+	// The device secret is only ever returned here; install it on the till
+	middleware.NoReplay(c)
+	c.JSON(http.StatusCreated, gin.H{
+		"terminal": Terminal{
+			ID:        int(id),
+			StoreID:   req.StoreID,
+			Name:      req.Name,
+			IsActive:  true,
+			CreatedAt: time.Now(),
+		},
+		"device_secret": secret,
+	})
+}
+
+// UpdateTerminalRequest represents update terminal request body
+type UpdateTerminalRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+// DisableTerminalRequest represents disable terminal request body
+type DisableTerminalRequest struct {
+	Reason string `json:"reason" binding:"required,max=255"`
+}
+
+const terminalColumns = `
+	id, store_id, name, is_active, last_seen_at, disabled_at, disabled_by, disabled_reason, created_at
+`
+
+// scanTerminal reads a row selected with terminalColumns
+func scanTerminal(row interface{ Scan(...interface{}) error }) (Terminal, error) {
+	var t Terminal
+	err := row.Scan(
+		&t.ID, &t.StoreID, &t.Name, &t.IsActive, &t.LastSeenAt,
+		&t.DisabledAt, &t.DisabledBy, &t.DisabledReason, &t.CreatedAt,
+	)
+	return t, err
+}
+
+// GetTerminals lists enrolled terminals (optional store_id and is_active filters)
+func (h *TerminalHandler) GetTerminals(c *gin.Context) {
+	query := "SELECT " + terminalColumns + " FROM terminals WHERE 1 = 1"
+	args := []interface{}{}
+
+	if storeID := c.Query("store_id"); storeID != "" {
+		query += " AND store_id = ?"
+		args = append(args, storeID)
+	}
+	if isActive := c.Query("is_active"); isActive != "" {
+		query += " AND is_active = ?"
+		args = append(args, isActive == "true")
+	}
+	query += " ORDER BY store_id, name"
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	terminals := []Terminal{}
+	for rows.Next() {
+		t, err := scanTerminal(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan terminal"})
+			return
+		}
+		terminals = append(terminals, t)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"terminals": terminals})
+}
+
+// GetTerminal retrieves a single terminal
+func (h *TerminalHandler) GetTerminal(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid terminal ID"})
+		return
+	}
+
+	t, err := scanTerminal(h.db.QueryRow("SELECT "+terminalColumns+" FROM terminals WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Terminal not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, t)
+}
+
+// UpdateTerminal renames a terminal
+func (h *TerminalHandler) UpdateTerminal(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid terminal ID"})
+		return
+	}
+
+	var req UpdateTerminalRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	before := auditSnapshot(h.db, "terminals", id)
+	if before == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Terminal not found"})
+		return
+	}
+
+	if _, err := h.db.Exec("UPDATE terminals SET name = ? WHERE id = ?", req.Name, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update terminal"})
+		return
+	}
+	middleware.AuditChange(c, "terminal", id, before, auditSnapshot(h.db, "terminals", id))
+
+	c.JSON(http.StatusOK, gin.H{"message": "Terminal updated successfully"})
+}
+
+// DisableTerminal blocks a lost or stolen terminal and signs out its sessions
+// Shifts left open on it can still be closed from another register.
+func (h *TerminalHandler) DisableTerminal(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid terminal ID"})
+		return
+	}
+
+	var req DisableTerminalRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	before := auditSnapshot(tx, "terminals", id)
+	if before == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Terminal not found"})
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE terminals
+		SET is_active = false, disabled_at = NOW(), disabled_by = ?, disabled_reason = ?
+		WHERE id = ?
+	`, userID, req.Reason, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable terminal"})
+		return
+	}
+
+	// AuthRequired already refuses sessions on a disabled terminal; revoke them so
+	// their refresh tokens die too
+	result, err := tx.Exec(`
+		UPDATE user_sessions SET revoked_at = NOW(), revoked_reason = 'terminal_disabled'
+		WHERE terminal_id = ? AND revoked_at IS NULL
+	`, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+	revoked, _ := result.RowsAffected()
+
+	after := auditSnapshot(tx, "terminals", id)
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable terminal"})
+		return
+	}
+	middleware.AuditChange(c, "terminal", id, before, after)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "Terminal disabled successfully",
+		"revoked_sessions": revoked,
+	})
+}
+
+// EnableTerminal re-enables a disabled terminal and issues it a new device secret
+// The old secret stays invalid in case it went with the lost device.
+func (h *TerminalHandler) EnableTerminal(c *gin.Context) {
+	h.replaceSecret(c, true)
+}
+
+// RotateTerminalSecret issues a terminal a new device secret
+func (h *TerminalHandler) RotateTerminalSecret(c *gin.Context) {
+	h.replaceSecret(c, false)
+}
+
+// replaceSecret stores a new device secret, optionally re-enabling the terminal,
+// and returns the secret once
+func (h *TerminalHandler) replaceSecret(c *gin.Context, enable bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid terminal ID"})
+		return
+	}
+
+	secret, err := randomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate device secret"})
+		return
+	}
+
+	before := auditSnapshot(h.db, "terminals", id)
+	if before == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Terminal not found"})
+		return
+	}
+
+	query := "UPDATE terminals SET device_secret_hash = ? WHERE id = ?"
+	if enable {
+		query = `
+			UPDATE terminals
+			SET device_secret_hash = ?, is_active = true, disabled_at = NULL, disabled_by = NULL, disabled_reason = NULL
+			WHERE id = ?
+		`
+	}
+	if _, err := h.db.Exec(query, hashToken(secret), id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update terminal"})
+		return
+	}
+	middleware.AuditChange(c, "terminal", id, before, auditSnapshot(h.db, "terminals", id))
+
+	middleware.NoReplay(c)
+	c.JSON(http.StatusOK, gin.H{
+		"terminal_id":   id,
+		"device_secret": secret,
+	})
+}
+
+// requestTerminal authenticates the till when the request carries X-Terminal-ID
+// Returns nil for requests from anything else. Responds and returns false when
+// the terminal credentials are wrong.
+func requestTerminal(db *sql.DB, c *gin.Context) (*Terminal, bool) {
+	if c.GetHeader("X-Terminal-ID") == "" {
+		return nil, true
+	}
+
+	terminal, err := authenticateTerminal(db, c)
+	if err == errTerminalUnauthorized {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Terminal not registered or disabled"})
+		return nil, false
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return nil, false
+	}
+	return &terminal, true
+}
+
+// terminalAllowed checks that users assigned to a store only sign in at its tills
+// Responds and returns false when they may not.
+func terminalAllowed(c *gin.Context, terminal *Terminal, user User) bool {
+	if terminal != nil && user.StoreID != nil && *user.StoreID != terminal.StoreID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "User is not assigned to this store"})
+		return false
+	}
+	return true
+}
+
+// terminalIDOf returns the terminal's ID, or nil for no terminal
+func terminalIDOf(terminal *Terminal) *int {
+	if terminal == nil {
+		return nil
+	}
+	return &terminal.ID
+}
+
+// errTerminalUnauthorized is returned when terminal credentials are missing or wrong
+var errTerminalUnauthorized = errors.New("terminal not registered or disabled")
+
+// authenticateTerminal verifies the X-Terminal-ID and X-Terminal-Secret headers
+func authenticateTerminal(db *sql.DB, c *gin.Context) (Terminal, error) {
+	id, err := strconv.Atoi(c.GetHeader("X-Terminal-ID"))
+	secret := c.GetHeader("X-Terminal-Secret")
+	if err != nil || secret == "" {
+		return Terminal{}, errTerminalUnauthorized
+	}
+
+	var terminal Terminal
+	var secretHash string
+	err = db.QueryRow(`
+		SELECT id, store_id, name, is_active, device_secret_hash 
+		FROM terminals 
+		WHERE id = ?
+	`, id).Scan(&terminal.ID, &terminal.StoreID, &terminal.Name, &terminal.IsActive, &secretHash)
+	if err == sql.ErrNoRows {
+		return Terminal{}, errTerminalUnauthorized
+	} else if err != nil {
+		return Terminal{}, err
+	}
+
+	if !terminal.IsActive || !constantTimeEqual(secretHash, hashToken(secret)) {
+		return Terminal{}, errTerminalUnauthorized
+	}
+
+	db.Exec("UPDATE terminals SET last_seen_at = NOW() WHERE id = ?", terminal.ID)
+
+	return terminal, nil
+}
@@ -0,0 +1,580 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"sck-pos-backend/internal/middleware"
+	"sck-pos-backend/internal/totp"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Two-factor settings
+const (
+	totpIssuer             = "SCK POS"
+	mfaChallengeTTL        = 5 * time.Minute
+	maxMFAChallengeTries   = 5
+	recoveryCodeCount      = 10
+	recoveryCodeGroupWidth = 4
+)
+
+// MFAChallengeResponse is returned by Login when a second factor is needed
+type MFAChallengeResponse struct {
+	MFARequired    bool   `json:"mfa_required"`
+	ChallengeToken string `json:"challenge_token"`
+	ExpiresIn      int    `json:"expires_in"` // challenge lifetime in seconds
+}
+
+// MFAVerifyRequest represents the second login step; send either code or recovery_code
+type MFAVerifyRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recovery_code"`
+}
+
+// MFACodeRequest carries a current authenticator code
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// MFADisableRequest represents disable 2FA request body
+type MFADisableRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// startMFAChallenge issues a short-lived challenge after a correct password
+func (h *AuthHandler) startMFAChallenge(c *gin.Context, user User) {
+	token, err := randomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start two-factor challenge"})
+		return
+	}
+
+	_, err = h.db.Exec(`
+		INSERT INTO login_challenges (user_id, token_hash, expires_at)
+		VALUES (?, ?, ?)
+	`, user.ID, hashToken(token), time.Now().Add(mfaChallengeTTL))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start two-factor challenge"})
+		return
+	}
+
+	c.JSON(http.StatusOK, MFAChallengeResponse{
+		MFARequired:    true,
+		ChallengeToken: token,
+		ExpiresIn:      int(mfaChallengeTTL.Seconds()),
+	})
+}
+
+// VerifyMFA completes a login challenge with an authenticator or recovery code
+func (h *AuthHandler) VerifyMFA(c *gin.Context) {
+	var req MFAVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if (req.Code == "") == (req.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide either code or recovery_code"})
+		return
+	}
+
+	terminal, ok := requestTerminal(h.db, c)
+	if !ok {
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var (
+		challengeID int
+		attempts    int
+		expiresAt   time.Time
+		usedAt      *time.Time
+		secret      *string
+		lastStep    int64
+		user        User
+	)
+	query := `
+		SELECT lc.id, lc.attempts, lc.expires_at, lc.used_at, u.totp_secret, u.totp_last_step,
+			u.id, u.username, u.email, u.full_name, u.role, u.store_id, u.is_active
+		FROM login_challenges lc
+		JOIN users u ON u.id = lc.user_id
+		WHERE lc.token_hash = ? AND u.totp_enabled = true
+		FOR UPDATE
+	`
+	err = tx.QueryRow(query, hashToken(req.ChallengeToken)).Scan(
+		&challengeID, &attempts, &expiresAt, &usedAt, &secret, &lastStep,
+		&user.ID, &user.Username, &user.Email, &user.FullName,
+		&user.Role, &user.StoreID, &user.IsActive,
+	)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if usedAt != nil || !user.IsActive || secret == nil || attempts >= maxMFAChallengeTries || time.Now().After(expiresAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+		return
+	}
+
+	if !terminalAllowed(c, terminal, user) {
+		return
+	}
+
+	verified := false
+	if req.Code != "" {
+		if step, ok := totp.Validate(*secret, req.Code, time.Now(), lastStep); ok {
+			if _, err := tx.Exec("UPDATE users SET totp_last_step = ? WHERE id = ?", step, user.ID); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+				return
+			}
+			verified = true
+		}
+	} else {
+		verified, err = useRecoveryCode(tx, user.ID, req.RecoveryCode)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+	}
+
+	if !verified {
+		// The attempt must be counted before answering, or the challenge's
+		// attempt limit stops protecting it
+		if _, err := tx.Exec("UPDATE login_challenges SET attempts = attempts + 1 WHERE id = ?", challengeID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if _, err := h.loginGuard.Failure(c.Request.Context(), user.Username, c.ClientIP()); err != nil {
+			log.Printf("Failed to count failed login for %s: %v", user.Username, err)
+		}
+		h.recordFailedLogin(c, user.Username, &user.ID, "invalid_credentials")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code"})
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE login_challenges SET used_at = NOW() WHERE id = ?", challengeID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err := h.loginGuard.Success(c.Request.Context(), user.Username, c.ClientIP()); err != nil {
+		log.Printf("Failed to reset login counter for %s: %v", user.Username, err)
+	}
+
+	response, err := h.startSession(c, user, terminalIDOf(terminal), true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetMFAStatus returns the caller's two-factor enrollment state
+func (h *AuthHandler) GetMFAStatus(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	var role string
+	var enabled bool
+	var enabledAt *time.Time
+	var remaining int
+	err := h.db.QueryRow(`
+		SELECT u.role, u.totp_enabled, u.totp_enabled_at,
+			(SELECT COUNT(*) FROM user_recovery_codes rc WHERE rc.user_id = u.id AND rc.used_at IS NULL)
+		FROM users u
+		WHERE u.id = ?
+	`, userID).Scan(&role, &enabled, &enabledAt, &remaining)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":                  enabled,
+		"enabled_at":               enabledAt,
+		"required":                 middleware.MFARequired(role),
+		"session_verified":         c.GetBool("mfa_verified"),
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// SetupMFA generates a new authenticator secret for the caller
+// The secret is not active until confirmed with EnableMFA.
+func (h *AuthHandler) SetupMFA(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	var username string
+	var enabled bool
+	err := h.db.QueryRow("SELECT username, totp_enabled FROM users WHERE id = ?", userID).Scan(&username, &enabled)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+
+	if _, err := h.db.Exec("UPDATE users SET totp_secret = ? WHERE id = ?", secret, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save secret"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_uri": totp.ProvisioningURI(totpIssuer, username, secret),
+	})
+}
+
+// EnableMFA confirms enrollment with a first code and returns recovery codes once
+// The current session becomes MFA verified and the user's other sessions are revoked.
+func (h *AuthHandler) EnableMFA(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var secret *string
+	var enabled bool
+	err = tx.QueryRow("SELECT totp_secret, totp_enabled FROM users WHERE id = ? FOR UPDATE", userID).Scan(&secret, &enabled)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if secret == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Start two-factor setup first"})
+		return
+	}
+
+	step, ok := totp.Validate(*secret, req.Code, time.Now(), 0)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code"})
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE users SET totp_enabled = true, totp_enabled_at = NOW(), totp_last_step = ?
+		WHERE id = ?
+	`, step, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+
+	sessionID := c.GetString("session_id")
+	if _, err := tx.Exec("UPDATE user_sessions SET mfa_verified = true WHERE id = ?", sessionID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	_, err = tx.Exec(`
+		UPDATE user_sessions SET revoked_at = NOW(), revoked_reason = 'mfa_enabled'
+		WHERE user_id = ? AND id <> ? AND revoked_at IS NULL
+	`, userID, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableMFA turns off two-factor authentication for the caller
+// Not allowed for roles where it is mandatory.
+func (h *AuthHandler) DisableMFA(c *gin.Context) {
+	var req MFADisableRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	var role, passwordHash string
+	var secret *string
+	var enabled bool
+	var lastStep int64
+	err := h.db.QueryRow(`
+		SELECT role, password_hash, totp_secret, totp_enabled, totp_last_step
+		FROM users WHERE id = ?
+	`, userID).Scan(&role, &passwordHash, &secret, &enabled, &lastStep)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if middleware.MFARequired(role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is mandatory for this role"})
+		return
+	}
+	if !enabled || secret == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.Password)); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+		return
+	}
+	if _, ok := totp.Validate(*secret, req.Code, time.Now(), lastStep); !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code"})
+		return
+	}
+
+	if err := clearMFA(h.db, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces the caller's recovery codes after checking a current code
+func (h *AuthHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var secret *string
+	var enabled bool
+	var lastStep int64
+	err = tx.QueryRow(`
+		SELECT totp_secret, totp_enabled, totp_last_step
+		FROM users WHERE id = ? FOR UPDATE
+	`, userID).Scan(&secret, &enabled, &lastStep)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !enabled || secret == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	step, ok := totp.Validate(*secret, req.Code, time.Now(), lastStep)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code"})
+		return
+	}
+	if _, err := tx.Exec("UPDATE users SET totp_last_step = ? WHERE id = ?", step, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// ResetUserMFA removes a user's authenticator and recovery codes (admin)
+// Used when a device is lost; the user's sessions are revoked and they must enroll again.
+func (h *AuthHandler) ResetUserMFA(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := findUser(tx, id); err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if err := clearMFA(tx, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset two-factor authentication"})
+		return
+	}
+	if _, err := revokeUserSessions(tx, id, "mfa_reset"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication reset"})
+}
+
+// clearMFA removes a user's TOTP secret and recovery codes
+func clearMFA(db execer, userID int) error {
+	_, err := db.Exec(`
+		UPDATE users SET totp_secret = NULL, totp_enabled = false, totp_enabled_at = NULL, totp_last_step = 0
+		WHERE id = ?
+	`, userID)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("DELETE FROM user_recovery_codes WHERE user_id = ?", userID)
+	return err
+}
+
+// replaceRecoveryCodes discards a user's recovery codes and stores a fresh set
+func replaceRecoveryCodes(tx execer, userID int) ([]string, error) {
+	if _, err := tx.Exec("DELETE FROM user_recovery_codes WHERE user_id = ?", userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.Exec(
+			"INSERT INTO user_recovery_codes (user_id, code_hash) VALUES (?, ?)",
+			userID, hashToken(normalizeRecoveryCode(code)),
+		)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// useRecoveryCode marks a matching unused recovery code as spent
+func useRecoveryCode(tx execer, userID int, code string) (bool, error) {
+	result, err := tx.Exec(`
+		UPDATE user_recovery_codes SET used_at = NOW()
+		WHERE user_id = ? AND code_hash = ? AND used_at IS NULL
+	`, userID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows == 1, err
+}
+
+// newRecoveryCode returns an 80-bit code formatted as XXXX-XXXX-XXXX-XXXX
+func newRecoveryCode() (string, error) {
+	buf := make([]byte, 10)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	raw := base32.StdEncoding.EncodeToString(buf)
+
+	groups := make([]string, 0, len(raw)/recoveryCodeGroupWidth)
+	for i := 0; i < len(raw); i += recoveryCodeGroupWidth {
+		groups = append(groups, raw[i:i+recoveryCodeGroupWidth])
+	}
+	return strings.Join(groups, "-"), nil
+}
+
+// normalizeRecoveryCode strips separators and case so typed codes still match
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
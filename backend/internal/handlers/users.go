@@ -2,26 +2,32 @@ package handlers
 
 import (
 	"database/sql"
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
+
+	"sck-pos-backend/internal/middleware"
+	"sck-pos-backend/internal/password"
 
 	"github.com/gin-gonic/gin"
 )
 
 // UserHandler handles user-related requests
 type UserHandler struct {
-	db *sql.DB
+	db        *sql.DB
+	passwords *password.Policy
 }
 
 // NewUserHandler creates a new user handler
-func NewUserHandler(db *sql.DB) *UserHandler {
-	return &UserHandler{db: db}
+func NewUserHandler(db *sql.DB, passwords *password.Policy) *UserHandler {
+	return &UserHandler{db: db, passwords: passwords}
 }
 
 // GetUsers retrieves all users
 func (h *UserHandler) GetUsers(c *gin.Context) {
 	query := `
-		SELECT id, username, email, full_name, role, is_active, created_at 
+		SELECT id, username, email, full_name, role, store_id, is_active 
 		FROM users 
 		ORDER BY created_at DESC
 	`
@@ -33,12 +39,11 @@ func (h *UserHandler) GetUsers(c *gin.Context) {
 	}
 	defer rows.Close()
 
-	var users []User
+	users := []User{}
 	for rows.Next() {
 		var user User
-		var createdAt string
 		err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.FullName, 
-			&user.Role, &user.IsActive, &createdAt)
+			&user.Role, &user.StoreID, &user.IsActive)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Scan error"})
 			return
@@ -46,6 +51,11 @@ func (h *UserHandler) GetUsers(c *gin.Context) {
 		users = append(users, user)
 	}
 
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
 	c.JSON(http.StatusOK, users)
 }
 
@@ -57,18 +67,7 @@ func (h *UserHandler) GetUser(c *gin.Context) {
 		return
 	}
 
-	var user User
-	query := `
-		SELECT id, username, email, full_name, role, is_active 
-		FROM users 
-		WHERE id = ?
-	`
-	
-	err = h.db.QueryRow(query, id).Scan(
-		&user.ID, &user.Username, &user.Email, &user.FullName, 
-		&user.Role, &user.IsActive,
-	)
-	
+	user, err := findUser(h.db, id)
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
@@ -80,23 +79,446 @@ func (h *UserHandler) GetUser(c *gin.Context) {
 	c.JSON(http.StatusOK, user)
 }
 
+// CreateUserRequest represents create user request body
+type CreateUserRequest struct {
+	Username string `json:"username" binding:"required"`
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+	FullName string `json:"full_name" binding:"required"`
+	Role     string `json:"role" binding:"required,oneof=admin manager cashier"`
+	StoreID  *int   `json:"store_id"`
+
+	// MustChangePassword defaults to true: the initial password is temporary
+	MustChangePassword *bool `json:"must_change_password"`
+}
+
 // CreateUser creates a new user
 func (h *UserHandler) CreateUser(c *gin.Context) {
-	var req RegisterRequest
+	var req CreateUserRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"message": "User creation not implemented yet"})
+	hashedPassword, err := hashNewPassword(h.passwords, req.Password, req.Username)
+	if err != nil {
+		respondPasswordError(c, h.passwords, err)
+		return
+	}
+
+	mustChange := req.MustChangePassword == nil || *req.MustChangePassword
+
+	query := `
+		INSERT INTO users (username, email, password_hash, must_change_password, full_name, role, store_id) 
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+
+	result, err := h.db.Exec(query, req.Username, req.Email, hashedPassword, mustChange, req.FullName, req.Role, req.StoreID)
+	if isDuplicateKeyError(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Username or email already exists"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+
+	id, _ := result.LastInsertId()
+	middleware.AuditChange(c, "user", id, nil, auditSnapshot(h.db, "users", id))
+
+	c.JSON(http.StatusCreated, User{
+		ID:       int(id),
+		Username: req.Username,
+		Email:    req.Email,
+		FullName: req.FullName,
+		Role:     req.Role,
+		StoreID:  req.StoreID,
+		IsActive: true,
+	})
 }
 
-// UpdateUser updates an existing user
+// UpdateUserRequest represents update user request body
+// Omitted fields are left unchanged
+type UpdateUserRequest struct {
+	Email    *string `json:"email" binding:"omitempty,email"`
+	FullName *string `json:"full_name" binding:"omitempty,min=1"`
+	Role     *string `json:"role" binding:"omitempty,oneof=admin manager cashier"`
+	StoreID  *int    `json:"store_id"`
+	IsActive *bool   `json:"is_active"`
+}
+
+// UpdateUser updates a user's profile, role, store or active flag
 func (h *UserHandler) UpdateUser(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"message": "User update not implemented yet"})
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	before := auditSnapshot(tx, "users", id)
+	user, err := findUser(tx, id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// Demoting or deactivating an active admin must leave another active admin
+	losesAdmin := (req.Role != nil && *req.Role != "admin") || (req.IsActive != nil && !*req.IsActive)
+	if user.Role == "admin" && user.IsActive && losesAdmin {
+		if err := ensureAnotherActiveAdmin(tx, id); err != nil {
+			respondLastAdmin(c, err)
+			return
+		}
+	}
+
+	if req.Email != nil {
+		user.Email = *req.Email
+	}
+	if req.FullName != nil {
+		user.FullName = *req.FullName
+	}
+	if req.Role != nil {
+		user.Role = *req.Role
+	}
+	if req.StoreID != nil {
+		user.StoreID = req.StoreID
+	}
+	if req.IsActive != nil {
+		user.IsActive = *req.IsActive
+	}
+
+	query := `
+		UPDATE users 
+		SET email = ?, full_name = ?, role = ?, store_id = ?, is_active = ?, updated_at = CURRENT_TIMESTAMP 
+		WHERE id = ?
+	`
+
+	_, err = tx.Exec(query, user.Email, user.FullName, user.Role, user.StoreID, user.IsActive, id)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already exists"})
+		return
+	}
+
+	// Role changes and deactivation take effect immediately
+	if !user.IsActive || req.Role != nil {
+		if _, err := revokeUserSessions(tx, id, "user_updated"); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+			return
+		}
+	}
+	middleware.AuditChange(c, "user", id, before, auditSnapshot(tx, "users", id))
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
 }
 
-// DeleteUser deletes a user
+// DeleteUser deactivates a user (soft delete)
 func (h *UserHandler) DeleteUser(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"message": "User deletion not implemented yet"})
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	before := auditSnapshot(tx, "users", id)
+	user, err := findUser(tx, id)
+	if err == sql.ErrNoRows || (err == nil && !user.IsActive) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if user.Role == "admin" {
+		if err := ensureAnotherActiveAdmin(tx, id); err != nil {
+			respondLastAdmin(c, err)
+			return
+		}
+	}
+
+	_, err = tx.Exec("UPDATE users SET is_active = false, updated_at = CURRENT_TIMESTAMP WHERE id = ?", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to deactivate user"})
+		return
+	}
+
+	if _, err := revokeUserSessions(tx, id, "user_deactivated"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+	middleware.AuditChange(c, "user", id, before, auditSnapshot(tx, "users", id))
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to deactivate user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User deactivated successfully"})
+}
+
+// ResetPasswordRequest represents admin password reset request body
+type ResetPasswordRequest struct {
+	NewPassword string `json:"new_password" binding:"required"`
+
+	// MustChangePassword defaults to true: a reset password is temporary
+	MustChangePassword *bool `json:"must_change_password"`
+}
+
+// ResetPassword sets a new password for a user
+func (h *UserHandler) ResetPassword(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	before := auditSnapshot(tx, "users", id)
+	mustChange := req.MustChangePassword == nil || *req.MustChangePassword
+	if err := setPassword(tx, h.passwords, id, req.NewPassword, mustChange); err != nil {
+		respondPasswordError(c, h.passwords, err)
+		return
+	}
+
+	// Sign the user out everywhere so the old password cannot keep a session alive
+	if _, err := revokeUserSessions(tx, id, "password_reset"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+	// Hashes are left out of snapshots; the change shows in password_changed_at
+	middleware.AuditChange(c, "user", id, before, auditSnapshot(tx, "users", id))
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
+}
+
+// queryRower is satisfied by both *sql.DB and *sql.Tx
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// findUser loads a user by ID
+func findUser(q queryRower, id int) (User, error) {
+	var user User
+	query := `
+		SELECT id, username, email, full_name, role, store_id, is_active 
+		FROM users 
+		WHERE id = ?
+	`
+
+	err := q.QueryRow(query, id).Scan(
+		&user.ID, &user.Username, &user.Email, &user.FullName,
+		&user.Role, &user.StoreID, &user.IsActive,
+	)
+	return user, err
+}
+
+// errLastAdmin is returned when a change would leave no active admin
+var errLastAdmin = errors.New("cannot remove the last active admin")
+
+// ensureAnotherActiveAdmin locks the admin rows and checks one remains besides userID
+func ensureAnotherActiveAdmin(tx *sql.Tx, userID int) error {
+	var others int
+	err := tx.QueryRow(`
+		SELECT COUNT(*) FROM users 
+		WHERE role = 'admin' AND is_active = true AND id <> ? 
+		FOR UPDATE
+	`, userID).Scan(&others)
+	if err != nil {
+		return err
+	}
+	if others == 0 {
+		return errLastAdmin
+	}
+	return nil
+}
+
+// respondLastAdmin writes the response for a failed last-admin check
+func respondLastAdmin(c *gin.Context, err error) {
+	if err == errLastAdmin {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot remove the last active admin"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+}
+
+// UserInvite represents a one-time registration invite
+type UserInvite struct {
+	ID        int        `json:"id"`
+	Role      string     `json:"role"`
+	StoreID   *int       `json:"store_id,omitempty"`
+	Email     *string    `json:"email,omitempty"`
+	CreatedBy int        `json:"created_by"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	UsedBy    *int       `json:"used_by,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// CreateInviteRequest represents create invite request body
+type CreateInviteRequest struct {
+	Role           string  `json:"role" binding:"required,oneof=admin manager cashier"`
+	StoreID        *int    `json:"store_id"`
+	Email          *string `json:"email" binding:"omitempty,email"`
+	ExpiresInHours int     `json:"expires_in_hours" binding:"omitempty,min=1,max=720"`
+}
+
+// CreateInvite creates a one-time invite code with a preset role and store
+func (h *UserHandler) CreateInvite(c *gin.Context) {
+	var req CreateInviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	createdBy, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user context"})
+		return
+	}
+
+	if req.ExpiresInHours == 0 {
+		req.ExpiresInHours = 72
+	}
+
+	code, err := randomToken(16)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate invite code"})
+		return
+	}
+
+	invite := UserInvite{
+		Role:      req.Role,
+		StoreID:   req.StoreID,
+		Email:     req.Email,
+		CreatedBy: createdBy,
+		ExpiresAt: time.Now().Add(time.Duration(req.ExpiresInHours) * time.Hour),
+		CreatedAt: time.Now(),
+	}
+
+	query := `
+		INSERT INTO user_invites (code_hash, role, store_id, email, created_by, expires_at) 
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+
+	result, err := h.db.Exec(query, hashToken(code), invite.Role, invite.StoreID, invite.Email, invite.CreatedBy, invite.ExpiresAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invite"})
+		return
+	}
+
+	id, _ := result.LastInsertId()
+	invite.ID = int(id)
+
+	// The code is only ever returned here; the database keeps its hash
+	middleware.NoReplay(c)
+	c.JSON(http.StatusCreated, gin.H{
+		"invite": invite,
+		"code":   code,
+	})
+}
+
+// GetInvites retrieves recent invites
+func (h *UserHandler) GetInvites(c *gin.Context) {
+	query := `
+		SELECT id, role, store_id, email, created_by, expires_at, used_at, used_by, revoked_at, created_at 
+		FROM user_invites 
+		ORDER BY created_at DESC
+		LIMIT 100
+	`
+
+	rows, err := h.db.Query(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	invites := []UserInvite{}
+	for rows.Next() {
+		var invite UserInvite
+		err := rows.Scan(&invite.ID, &invite.Role, &invite.StoreID, &invite.Email, &invite.CreatedBy,
+			&invite.ExpiresAt, &invite.UsedAt, &invite.UsedBy, &invite.RevokedAt, &invite.CreatedAt)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Scan error"})
+			return
+		}
+		invites = append(invites, invite)
+	}
+
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, invites)
+}
+
+// RevokeInvite revokes an unused invite
+func (h *UserHandler) RevokeInvite(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("inviteId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invite ID"})
+		return
+	}
+
+	result, err := h.db.Exec(`
+		UPDATE user_invites SET revoked_at = NOW() 
+		WHERE id = ? AND used_at IS NULL AND revoked_at IS NULL
+	`, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invite not found or already used"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invite revoked successfully"})
 }
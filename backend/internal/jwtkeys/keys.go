@@ -0,0 +1,159 @@
+// Package jwtkeys signs and verifies access tokens.
+//
+// Tokens are signed with one active key and carry its ID in the "kid" header.
+// Older keys stay in the set for verification only, so keys can be rotated
+// without signing everyone out. Public keys are published as a JWKS document.
+package jwtkeys
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// HMACKeyID is the kid used when falling back to a shared secret
+const HMACKeyID = "hs256"
+
+// key is one signing or verification key
+type key struct {
+	id      string
+	method  jwt.SigningMethod
+	signKey interface{} // nil for verification-only keys
+	public  interface{} // verification key; the secret itself for HMAC
+}
+
+// KeySet holds the active signing key and every key accepted for verification
+type KeySet struct {
+	signing *key
+	keys    map[string]*key
+}
+
+// Options configures a key set
+type Options struct {
+	SigningKeyFile   string // PEM private key (RSA or Ed25519); empty falls back to HMACSecret
+	SigningKeyID     string
+	VerificationKeys string // previous keys as "kid=path,kid=path"; PEM public or private keys
+	HMACSecret       string
+}
+
+// Load builds a key set from PEM files, or an HS256 set from the shared secret
+// when no signing key is configured
+func Load(opts Options) (*KeySet, error) {
+	ks := &KeySet{keys: make(map[string]*key)}
+
+	if opts.SigningKeyFile == "" {
+		if opts.HMACSecret == "" {
+			return nil, errors.New("no JWT signing key or secret configured")
+		}
+		ks.signing = &key{
+			id:      HMACKeyID,
+			method:  jwt.SigningMethodHS256,
+			signKey: []byte(opts.HMACSecret),
+			public:  []byte(opts.HMACSecret),
+		}
+		ks.keys[HMACKeyID] = ks.signing
+		return ks, nil
+	}
+
+	if opts.SigningKeyID == "" {
+		return nil, errors.New("JWT_SIGNING_KEY_ID is required with a signing key file")
+	}
+	signing, err := loadKeyFile(opts.SigningKeyID, opts.SigningKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if signing.signKey == nil {
+		return nil, fmt.Errorf("signing key %q must be a private key", opts.SigningKeyID)
+	}
+	ks.signing = signing
+	ks.keys[signing.id] = signing
+
+	for _, entry := range strings.Split(opts.VerificationKeys, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, path, ok := strings.Cut(entry, "=")
+		if !ok || id == "" || path == "" {
+			return nil, fmt.Errorf("invalid verification key %q, want kid=path", entry)
+		}
+		if _, exists := ks.keys[id]; exists {
+			return nil, fmt.Errorf("duplicate key ID %q", id)
+		}
+		k, err := loadKeyFile(id, path)
+		if err != nil {
+			return nil, err
+		}
+		k.signKey = nil // retired keys never sign
+		ks.keys[id] = k
+	}
+
+	return ks, nil
+}
+
+// loadKeyFile reads a PEM RSA or Ed25519 key, private or public
+func loadKeyFile(id, path string) (*key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read key %q: %w", id, err)
+	}
+
+	if private, err := jwt.ParseRSAPrivateKeyFromPEM(data); err == nil {
+		return &key{id: id, method: jwt.SigningMethodRS256, signKey: private, public: &private.PublicKey}, nil
+	}
+	if private, err := jwt.ParseEdPrivateKeyFromPEM(data); err == nil {
+		if edKey, ok := private.(ed25519.PrivateKey); ok {
+			return &key{id: id, method: jwt.SigningMethodEdDSA, signKey: edKey, public: edKey.Public()}, nil
+		}
+	}
+	if public, err := jwt.ParseRSAPublicKeyFromPEM(data); err == nil {
+		return &key{id: id, method: jwt.SigningMethodRS256, public: public}, nil
+	}
+	if public, err := jwt.ParseEdPublicKeyFromPEM(data); err == nil {
+		return &key{id: id, method: jwt.SigningMethodEdDSA, public: public}, nil
+	}
+
+	return nil, fmt.Errorf("key %q in %s is not an RSA or Ed25519 PEM key", id, path)
+}
+
+// Algorithm returns the signing algorithm in use
+func (ks *KeySet) Algorithm() string {
+	return ks.signing.method.Alg()
+}
+
+// Sign signs claims with the active key and sets the kid header
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.signing.method, claims)
+	token.Header["kid"] = ks.signing.id
+	return token.SignedString(ks.signing.signKey)
+}
+
+// Parse verifies a token and returns its claims
+// The kid must name a known key and the alg must be exactly that key's algorithm,
+// so a token cannot pick a weaker algorithm or use a public key as an HMAC secret.
+func (ks *KeySet) Parse(tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		k, ok := ks.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key ID %q", kid)
+		}
+		if token.Method.Alg() != k.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %v for key %q", token.Header["alg"], kid)
+		}
+		return k.public, nil
+	})
+	if err != nil || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid token claims")
+	}
+	return claims, nil
+}
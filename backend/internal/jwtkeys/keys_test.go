@@ -0,0 +1,239 @@
+package jwtkeys
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// writeKey writes key as PEM to a temporary file and returns the path
+// Private keys are written as PKCS #8 and public keys as PKIX.
+func writeKey(t *testing.T, name string, key interface{}) string {
+	t.Helper()
+	var block *pem.Block
+	switch key.(type) {
+	case ed25519.PrivateKey, *rsa.PrivateKey:
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatalf("MarshalPKCS8PrivateKey: %v", err)
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	default:
+		der, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			t.Fatalf("MarshalPKIXPublicKey: %v", err)
+		}
+		block = &pem.Block{Type: "PUBLIC KEY", Bytes: der}
+	}
+
+	path := filepath.Join(t.TempDir(), name+".pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return path
+}
+
+func newEdKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	return private
+}
+
+func load(t *testing.T, opts Options) *KeySet {
+	t.Helper()
+	ks, err := Load(opts)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	return ks
+}
+
+func testClaims() jwt.MapClaims {
+	return jwt.MapClaims{"sub": "42", "exp": time.Now().Add(time.Hour).Unix()}
+}
+
+// signWith signs claims with any method and key, setting kid when it is not empty
+func signWith(t *testing.T, method jwt.SigningMethod, kid string, signKey interface{}) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, testClaims())
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(signKey)
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+	return signed
+}
+
+func TestSignAndParse(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		opts    Options
+		wantAlg string
+		wantKid string
+	}{
+		{"hmac fallback", Options{HMACSecret: "test-secret"}, "HS256", HMACKeyID},
+		{"ed25519", Options{SigningKeyFile: writeKey(t, "ed", newEdKey(t)), SigningKeyID: "ed-1"}, "EdDSA", "ed-1"},
+		{"rsa", Options{SigningKeyFile: writeKey(t, "rsa", rsaKey), SigningKeyID: "rsa-1"}, "RS256", "rsa-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ks := load(t, tt.opts)
+			if got := ks.Algorithm(); got != tt.wantAlg {
+				t.Fatalf("Algorithm() = %q, want %q", got, tt.wantAlg)
+			}
+
+			signed, err := ks.Sign(testClaims())
+			if err != nil {
+				t.Fatalf("Sign: %v", err)
+			}
+			token, _, err := new(jwt.Parser).ParseUnverified(signed, jwt.MapClaims{})
+			if err != nil {
+				t.Fatalf("ParseUnverified: %v", err)
+			}
+			if token.Header["kid"] != tt.wantKid || token.Header["alg"] != tt.wantAlg {
+				t.Fatalf("header = %v, want kid %q and alg %q", token.Header, tt.wantKid, tt.wantAlg)
+			}
+
+			claims, err := ks.Parse(signed)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if claims["sub"] != "42" {
+				t.Fatalf("sub = %v, want 42", claims["sub"])
+			}
+		})
+	}
+}
+
+func TestParseAcceptsRetiredKeys(t *testing.T) {
+	oldKey, newKey := newEdKey(t), newEdKey(t)
+	oldSet := load(t, Options{SigningKeyFile: writeKey(t, "old", oldKey), SigningKeyID: "old"})
+	oldToken, err := oldSet.Sign(testClaims())
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	// The retired key is given as a private key but must only verify
+	rotated := load(t, Options{
+		SigningKeyFile:   writeKey(t, "new", newKey),
+		SigningKeyID:     "new",
+		VerificationKeys: "old=" + writeKey(t, "old", oldKey),
+	})
+	if _, err := rotated.Parse(oldToken); err != nil {
+		t.Fatalf("token signed with the retired key rejected: %v", err)
+	}
+	if rotated.keys["old"].signKey != nil {
+		t.Fatal("retired key kept its private key")
+	}
+
+	newToken, err := rotated.Sign(testClaims())
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	token, _, _ := new(jwt.Parser).ParseUnverified(newToken, jwt.MapClaims{})
+	if token.Header["kid"] != "new" {
+		t.Fatalf("signed with kid %v, want the active key", token.Header["kid"])
+	}
+	if _, err := oldSet.Parse(newToken); err == nil {
+		t.Fatal("old key set accepted a token from a key it does not know")
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	edKey := newEdKey(t)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	ks := load(t, Options{
+		SigningKeyFile:   writeKey(t, "ed", edKey),
+		SigningKeyID:     "ed-1",
+		VerificationKeys: "rsa-1=" + writeKey(t, "rsa", rsaKey.Public()),
+	})
+	edPublic := []byte(edKey.Public().(ed25519.PublicKey))
+	rsaPublicPEM, err := os.ReadFile(writeKey(t, "rsa-public", rsaKey.Public()))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+
+	expired, err := ks.Sign(jwt.MapClaims{"sub": "42", "exp": time.Now().Add(-time.Minute).Unix()})
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	valid, err := ks.Sign(testClaims())
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"missing kid", signWith(t, jwt.SigningMethodEdDSA, "", edKey)},
+		{"unknown kid", signWith(t, jwt.SigningMethodEdDSA, "ed-2", edKey)},
+		{"EdDSA under an RS256 kid", signWith(t, jwt.SigningMethodEdDSA, "rsa-1", edKey)},
+		{"HS256 with an Ed25519 public key as secret", signWith(t, jwt.SigningMethodHS256, "ed-1", edPublic)},
+		{"HS256 with an RSA public key as secret", signWith(t, jwt.SigningMethodHS256, "rsa-1", rsaPublicPEM)},
+		{"RS256 under an Ed25519 kid", signWith(t, jwt.SigningMethodRS256, "ed-1", rsaKey)},
+		{"PS256 under an RS256 kid", signWith(t, jwt.SigningMethodPS256, "rsa-1", rsaKey)},
+		{"alg none", signWith(t, jwt.SigningMethodNone, "ed-1", jwt.UnsafeAllowNoneSignatureType)},
+		{"expired", expired},
+		{"tampered signature", valid[:len(valid)-2] + "AA"},
+		{"not a token", "not-a-token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if claims, err := ks.Parse(tt.token); err == nil {
+				t.Fatalf("Parse accepted the token with claims %v", claims)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	edKey := newEdKey(t)
+	private := writeKey(t, "ed", edKey)
+	public := writeKey(t, "ed-public", edKey.Public())
+	notAKey := filepath.Join(t.TempDir(), "not-a-key.pem")
+	if err := os.WriteFile(notAKey, []byte("hello"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"no key or secret", Options{}},
+		{"signing key without an ID", Options{SigningKeyFile: private}},
+		{"public signing key", Options{SigningKeyFile: public, SigningKeyID: "ed-1"}},
+		{"missing key file", Options{SigningKeyFile: filepath.Join(t.TempDir(), "missing.pem"), SigningKeyID: "ed-1"}},
+		{"not a PEM key", Options{SigningKeyFile: notAKey, SigningKeyID: "ed-1"}},
+		{"verification key without a kid", Options{SigningKeyFile: private, SigningKeyID: "ed-1", VerificationKeys: public}},
+		{"duplicate kid", Options{SigningKeyFile: private, SigningKeyID: "ed-1", VerificationKeys: "ed-1=" + public}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Load(tt.opts); err == nil {
+				t.Fatal("Load succeeded")
+			}
+		})
+	}
+}
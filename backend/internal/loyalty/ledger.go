@@ -0,0 +1,176 @@
+package loyalty
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// LedgerMismatch describes a customer whose stored balances disagree with the transaction log
+type LedgerMismatch struct {
+	CustomerID     int    `json:"customer_id"`
+	Name           string `json:"name"`
+	LedgerPoints   int    `json:"ledger_points"`   // SUM(loyalty_point_transactions.points)
+	CustomerPoints int    `json:"customer_points"` // customers.loyalty_points
+	BalancePoints  int    `json:"balance_points"`  // SUM of unexpired loyalty_point_balances.points
+}
+
+// LedgerReport summarises a consistency check
+type LedgerReport struct {
+	CustomersChecked int              `json:"customers_checked"`
+	Mismatches       []LedgerMismatch `json:"mismatches"`
+	DryRun           bool             `json:"dry_run"`
+	Repaired         bool             `json:"repaired"`
+}
+
+// ledgerQuery loads customers' stored points alongside the ledger total
+const ledgerQuery = `
+	SELECT
+		c.id,
+		c.name,
+		c.loyalty_points,
+		COALESCE((
+			SELECT SUM(t.points)
+			FROM loyalty_point_transactions t
+			WHERE t.customer_id = c.id
+		), 0),
+		COALESCE((
+			SELECT SUM(b.points)
+			FROM loyalty_point_balances b
+			WHERE b.customer_id = c.id AND b.is_expired = FALSE
+		), 0)
+	FROM customers c`
+
+// ReconcileLedger recomputes every customer's points from loyalty_point_transactions
+// and repairs customers.loyalty_points and loyalty_point_balances to match.
+// The check is a plain read, so it never blocks checkout. Repairs happen in one
+// transaction that locks only the mismatched customers and re-reads them first;
+// with dryRun nothing is repaired.
+func ReconcileLedger(ctx context.Context, db *sql.DB, dryRun bool) (*LedgerReport, error) {
+	rows, err := db.QueryContext(ctx, ledgerQuery+" ORDER BY c.id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ledger: %w", err)
+	}
+
+	report := &LedgerReport{DryRun: dryRun, Mismatches: []LedgerMismatch{}}
+	for rows.Next() {
+		var m LedgerMismatch
+		if err := rows.Scan(&m.CustomerID, &m.Name, &m.CustomerPoints, &m.LedgerPoints, &m.BalancePoints); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan ledger: %w", err)
+		}
+		report.CustomersChecked++
+		if m.CustomerPoints != m.LedgerPoints || m.BalancePoints != m.LedgerPoints {
+			report.Mismatches = append(report.Mismatches, m)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return nil, fmt.Errorf("failed to read ledger: %w", err)
+	}
+	rows.Close()
+
+	if dryRun || len(report.Mismatches) == 0 {
+		return report, nil
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for i := range report.Mismatches {
+		// A sale may have moved the customer's points since the check
+		m := &report.Mismatches[i]
+		err := tx.QueryRowContext(ctx, ledgerQuery+" WHERE c.id = ? FOR UPDATE", m.CustomerID).Scan(
+			&m.CustomerID, &m.Name, &m.CustomerPoints, &m.LedgerPoints, &m.BalancePoints,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to lock customer %d: %w", m.CustomerID, err)
+		}
+		if err := repairCustomer(ctx, tx, *m); err != nil {
+			return nil, fmt.Errorf("failed to repair customer %d: %w", m.CustomerID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit repairs: %w", err)
+	}
+	report.Repaired = true
+
+	return report, nil
+}
+
+// repairCustomer brings one customer's derived balances back in line with the ledger
+func repairCustomer(ctx context.Context, tx *sql.Tx, m LedgerMismatch) error {
+	if m.CustomerPoints != m.LedgerPoints {
+		_, err := tx.ExecContext(ctx, `
+			UPDATE customers
+			SET loyalty_points = ?, updated_at = CURRENT_TIMESTAMP
+			WHERE id = ?`, m.LedgerPoints, m.CustomerID)
+		if err != nil {
+			return err
+		}
+	}
+
+	diff := m.LedgerPoints - m.BalancePoints
+	switch {
+	case diff > 0:
+		// Missing balance: credit it today on the standard 180 day expiry
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO loyalty_point_balances (customer_id, points, earned_date, expiry_date)
+			VALUES (?, ?, CURDATE(), DATE_ADD(CURDATE(), INTERVAL 180 DAY))
+			ON DUPLICATE KEY UPDATE
+				points = points + VALUES(points),
+				updated_at = CURRENT_TIMESTAMP`, m.CustomerID, diff)
+		return err
+	case diff < 0:
+		return deductBalances(ctx, tx, m.CustomerID, -diff)
+	}
+	return nil
+}
+
+// deductBalances removes surplus points from unexpired balances, oldest first
+func deductBalances(ctx context.Context, tx *sql.Tx, customerID, points int) error {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, points
+		FROM loyalty_point_balances
+		WHERE customer_id = ? AND points > 0 AND is_expired = FALSE
+		ORDER BY earned_date ASC`, customerID)
+	if err != nil {
+		return err
+	}
+
+	type balance struct{ id, points int }
+	var balances []balance
+	for rows.Next() {
+		var b balance
+		if err := rows.Scan(&b.id, &b.points); err != nil {
+			rows.Close()
+			return err
+		}
+		balances = append(balances, b)
+	}
+	rows.Close()
+
+	for _, b := range balances {
+		if points <= 0 {
+			break
+		}
+		deduct := b.points
+		if deduct > points {
+			deduct = points
+		}
+		_, err := tx.ExecContext(ctx, `
+			UPDATE loyalty_point_balances
+			SET points = points - ?, updated_at = CURRENT_TIMESTAMP
+			WHERE id = ?`, deduct, b.id)
+		if err != nil {
+			return err
+		}
+		points -= deduct
+	}
+
+	return nil
+}
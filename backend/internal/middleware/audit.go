@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"sck-pos-backend/internal/audit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Context keys handlers use to describe what a request changed
+const (
+	auditRecordedKey = "audit_recorded"
+	auditEntityKey   = "audit_entity"
+	auditDetailsKey  = "audit_details"
+)
+
+// auditChange is the entity and data a handler reported for the audit trail
+type auditChange struct {
+	entityType string
+	entityID   string
+	before     interface{}
+	after      interface{}
+}
+
+// AuditChange records the entity a request changed and its state before and after
+// Pass nil for before on creates and for after on hard deletes.
+func AuditChange(c *gin.Context, entityType string, entityID interface{}, before, after interface{}) {
+	c.Set(auditEntityKey, auditChange{
+		entityType: entityType,
+		entityID:   fmt.Sprint(entityID),
+		before:     before,
+		after:      after,
+	})
+}
+
+// AuditDetails adds a free-text note to the request's audit entry
+func AuditDetails(c *gin.Context, details string) {
+	c.Set(auditDetailsKey, details)
+}
+
+// markAudited stops AuditTrail from writing a second entry for the request
+func markAudited(c *gin.Context) {
+	c.Set(auditRecordedKey, true)
+}
+
+// AuditTrail writes every mutating request to the audit log after it is handled
+// Use it after AuthRequired so the entry carries the user and role.
+func AuditTrail(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return
+		}
+		if c.GetBool(auditRecordedKey) {
+			return
+		}
+
+		status := c.Writer.Status()
+		entry := audit.Entry{
+			Username:   c.GetString("username"),
+			Role:       c.GetString("role"),
+			Action:     auditAction(c),
+			Resource:   c.Request.Method + " " + c.FullPath(),
+			EntityType: routeEntity(c.FullPath()),
+			EntityID:   c.Param("id"),
+			Outcome:    auditOutcome(status),
+			StatusCode: status,
+			IPAddress:  c.ClientIP(),
+			Details:    c.GetString(auditDetailsKey),
+		}
+		if userID, ok := c.Get("user_id"); ok {
+			if id, ok := userID.(float64); ok {
+				uid := int(id)
+				entry.UserID = &uid
+			}
+		}
+		if value, ok := c.Get(auditEntityKey); ok {
+			change := value.(auditChange)
+			entry.EntityType = change.entityType
+			entry.EntityID = change.entityID
+			entry.Before = change.before
+			entry.After = change.after
+		}
+
+		// The request has been answered, so a failed write can only be logged
+		if err := audit.Log(c.Request.Context(), db, entry); err != nil {
+			log.Printf("Failed to audit %s: %v", entry.Resource, err)
+		}
+	}
+}
+
+// auditOutcome maps a response status to an audit outcome
+func auditOutcome(status int) string {
+	switch {
+	case status < http.StatusBadRequest:
+		return audit.OutcomeSuccess
+	case status == http.StatusUnauthorized, status == http.StatusForbidden, status == http.StatusTooManyRequests:
+		return audit.OutcomeDenied
+	default:
+		return audit.OutcomeFailure
+	}
+}
+
+// routeEntity is the resource a route belongs to, e.g. "customers" for
+// /api/v1/customers/:id/loyalty/adjustments
+func routeEntity(route string) string {
+	segments := strings.Split(strings.TrimPrefix(route, "/api/v1/"), "/")
+	return segments[0]
+}
+
+// auditAction names the operation from the route's fixed segments, e.g.
+// "customers.update", "sales.void" or "users.invites.delete"
+func auditAction(c *gin.Context) string {
+	var parts []string
+	endsWithParam := false
+	for _, segment := range strings.Split(strings.TrimPrefix(c.FullPath(), "/api/v1/"), "/") {
+		endsWithParam = strings.HasPrefix(segment, ":")
+		if !endsWithParam && segment != "" {
+			parts = append(parts, segment)
+		}
+	}
+
+	switch {
+	case c.Request.Method == http.MethodDelete:
+		parts = append(parts, "delete")
+	case len(parts) > 1 && !endsWithParam:
+		// Sub-resources and verbs such as /sales/:id/refund name themselves
+	case c.Request.Method == http.MethodPost:
+		parts = append(parts, "create")
+	default:
+		parts = append(parts, "update")
+	}
+	return strings.Join(parts, ".")
+}
@@ -1,11 +1,14 @@
 package middleware
 
 import (
+	"database/sql"
 	"net/http"
+	"strconv"
 	"strings"
 
+	"sck-pos-backend/internal/jwtkeys"
+
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v4"
 )
 
 // CORS middleware for handling Cross-Origin Resource Sharing
@@ -27,7 +30,7 @@ func CORS(allowedOrigins []string) gin.HandlerFunc {
 		}
 
 		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization")
+		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization, X-Terminal-ID, X-Terminal-Secret, X-Override-Token, Idempotency-Key")
 		c.Header("Access-Control-Allow-Credentials", "true")
 
 		if c.Request.Method == "OPTIONS" {
@@ -40,7 +43,8 @@ func CORS(allowedOrigins []string) gin.HandlerFunc {
 }
 
 // AuthRequired middleware for JWT authentication
-func AuthRequired(jwtSecret string) gin.HandlerFunc {
+// Tokens must belong to an unrevoked session of an active user.
+func AuthRequired(db *sql.DB, keys *jwtkeys.KeySet) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -58,23 +62,54 @@ func AuthRequired(jwtSecret string) gin.HandlerFunc {
 		}
 
 		// Parse and validate token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return []byte(jwtSecret), nil
-		})
-
-		if err != nil || !token.Valid {
+		claims, err := keys.Parse(tokenString)
+		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
 
-		// Extract claims
-		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-			c.Set("user_id", claims["user_id"])
-			c.Set("username", claims["username"])
-			c.Set("role", claims["role"])
+		// Check the session has not been revoked, the user is still active
+		// and, for register sessions, the terminal is still enabled
+		sessionID, _ := claims["sid"].(string)
+		var active, mfaVerified, mustChangePassword bool
+		var terminalID *int
+		err = db.QueryRowContext(c.Request.Context(), `
+			SELECT u.is_active AND (s.terminal_id IS NULL OR t.is_active), s.terminal_id, s.mfa_verified,
+				u.must_change_password
+			FROM user_sessions s
+			JOIN users u ON u.id = s.user_id
+			LEFT JOIN terminals t ON t.id = s.terminal_id
+			WHERE s.id = ? AND s.user_id = ? AND s.revoked_at IS NULL
+		`, sessionID, claims["user_id"]).Scan(&active, &terminalID, &mfaVerified, &mustChangePassword)
+		if err == sql.ErrNoRows || (err == nil && !active) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+			c.Abort()
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			c.Abort()
+			return
+		}
+
+		// Register tokens are only valid from the terminal they were issued to
+		if terminalID != nil {
+			if c.GetHeader("X-Terminal-ID") != strconv.Itoa(*terminalID) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Token is bound to another terminal"})
+				c.Abort()
+				return
+			}
+			c.Set("terminal_id", *terminalID)
 		}
 
+		// Extract claims
+		c.Set("user_id", claims["user_id"])
+		c.Set("username", claims["username"])
+		c.Set("role", claims["role"])
+		c.Set("session_id", sessionID)
+		c.Set("mfa_verified", mfaVerified)
+		c.Set("password_change_required", mustChangePassword)
+
 		c.Next()
 	}
 }
@@ -0,0 +1,236 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+)
+
+// IdempotencyKeyHeader is the request header clients set to make a POST safe to retry
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// idempotencyStaleAfter is how long a request may hold its key before a retry
+// assumes it died and takes the key over
+const idempotencyStaleAfter = time.Minute
+
+// maxIdempotencyKeyLength matches the idempotency_keys.idempotency_key column
+const maxIdempotencyKeyLength = 255
+
+// idempotencyNoReplayKey marks a response that must not be stored
+const idempotencyNoReplayKey = "idempotency_no_replay"
+
+// NoReplay stops Idempotency from storing the response, for responses carrying
+// a secret that is shown once. A retry with the same key gets 409 instead.
+func NoReplay(c *gin.Context) {
+	c.Set(idempotencyNoReplayKey, true)
+}
+
+// storedResponse is a response kept for replay
+type storedResponse struct {
+	requestHash string
+	status      string
+	createdAt   time.Time
+	statusCode  sql.NullInt64
+	contentType sql.NullString
+	body        sql.NullString
+}
+
+// Idempotency replays the stored response when a POST is retried with the same
+// Idempotency-Key header, so a double-tapped or retried request runs once.
+// Keys are scoped to the user and kept for window. Reusing a key for a
+// different request is rejected, as is a retry while the first attempt is
+// still running. Only successful responses are stored, and not those of
+// handlers that call NoReplay; after an error the client can fix the request
+// and try again with the same key. Requests without the header are not
+// affected. Use it after AuthRequired.
+func Idempotency(db *sql.DB, window time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if c.Request.Method != http.MethodPost || key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key must be at most 255 characters"})
+			c.Abort()
+			return
+		}
+
+		userID, ok := c.Get("user_id")
+		if !ok {
+			c.Next()
+			return
+		}
+		uid := int(userID.(float64))
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		requestHash := fingerprint(c.Request.Method, c.Request.URL.RequestURI(), body)
+
+		claimed, stored, err := claimIdempotencyKey(db, uid, key, requestHash, window)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			c.Abort()
+			return
+		}
+		if !claimed {
+			replayResponse(c, stored, requestHash)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		// Release the key after a failure so the client can retry
+		status := c.Writer.Status()
+		if status < http.StatusOK || status >= http.StatusMultipleChoices {
+			if _, err := db.Exec("DELETE FROM idempotency_keys WHERE user_id = ? AND idempotency_key = ?", uid, key); err != nil {
+				log.Printf("Failed to release idempotency key: %v", err)
+			}
+			return
+		}
+
+		// Only the status is kept for responses that must not be replayed
+		var contentType, responseBody sql.NullString
+		if !c.GetBool(idempotencyNoReplayKey) {
+			contentType = sql.NullString{String: c.Writer.Header().Get("Content-Type"), Valid: true}
+			responseBody = sql.NullString{String: recorder.body.String(), Valid: true}
+		}
+		_, err = db.Exec(`
+			UPDATE idempotency_keys
+			SET status = 'completed', response_status = ?, response_content_type = ?, response_body = ?
+			WHERE user_id = ? AND idempotency_key = ?
+		`, status, contentType, responseBody, uid, key)
+		if err != nil {
+			log.Printf("Failed to store idempotent response: %v", err)
+		}
+	}
+}
+
+// claimIdempotencyKey reserves the key for this request
+// When the key is already taken it returns false and the stored row instead.
+func claimIdempotencyKey(db *sql.DB, userID int, key, requestHash string, window time.Duration) (bool, *storedResponse, error) {
+	insert := func() error {
+		_, err := db.Exec(`
+			INSERT INTO idempotency_keys (user_id, idempotency_key, request_hash, status, expires_at)
+			VALUES (?, ?, ?, 'processing', ?)
+		`, userID, key, requestHash, time.Now().Add(window))
+		return err
+	}
+
+	err := insert()
+	if err == nil {
+		return true, nil, nil
+	}
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) || mysqlErr.Number != 1062 {
+		return false, nil, err
+	}
+
+	var stored storedResponse
+	var expiresAt time.Time
+	err = db.QueryRow(`
+		SELECT request_hash, status, created_at, expires_at, response_status, response_content_type, response_body
+		FROM idempotency_keys
+		WHERE user_id = ? AND idempotency_key = ?
+	`, userID, key).Scan(
+		&stored.requestHash, &stored.status, &stored.createdAt, &expiresAt,
+		&stored.statusCode, &stored.contentType, &stored.body,
+	)
+	if err == sql.ErrNoRows {
+		// Released by a failed attempt in the meantime; if another retry claims it
+		// first, report it as in use
+		if err := insert(); err != nil {
+			return false, &storedResponse{requestHash: requestHash, status: "processing"}, nil
+		}
+		return true, nil, nil
+	} else if err != nil {
+		return false, nil, err
+	}
+
+	// An expired key, or one whose request died before finishing, can be taken over
+	abandoned := stored.status == "processing" && stored.requestHash == requestHash &&
+		time.Since(stored.createdAt) > idempotencyStaleAfter
+	if time.Now().After(expiresAt) || abandoned {
+		result, err := db.Exec(`
+			UPDATE idempotency_keys
+			SET request_hash = ?, status = 'processing', response_status = NULL,
+				response_content_type = NULL, response_body = NULL, created_at = NOW(), expires_at = ?
+			WHERE user_id = ? AND idempotency_key = ? AND created_at = ?
+		`, requestHash, time.Now().Add(window), userID, key, stored.createdAt)
+		if err != nil {
+			return false, nil, err
+		}
+		if affected, _ := result.RowsAffected(); affected == 1 {
+			return true, nil, nil
+		}
+		// Another retry took it over first
+		stored.status = "processing"
+	}
+	return false, &stored, nil
+}
+
+// replayResponse answers a retried request from the stored row
+func replayResponse(c *gin.Context, stored *storedResponse, requestHash string) {
+	switch {
+	case stored.requestHash != "" && stored.requestHash != requestHash:
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error": "Idempotency-Key was already used for a different request",
+			"code":  "idempotency_key_reused",
+		})
+	case stored.status != "completed":
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "A request with this Idempotency-Key is still being processed",
+			"code":  "idempotency_key_in_use",
+		})
+	case !stored.body.Valid:
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "A request with this Idempotency-Key already succeeded and its response cannot be shown again",
+			"code":  "idempotency_no_replay",
+		})
+	default:
+		AuditDetails(c, "idempotent replay")
+		c.Header("Idempotent-Replayed", "true")
+		c.Data(int(stored.statusCode.Int64), stored.contentType.String, []byte(stored.body.String))
+	}
+	c.Abort()
+}
+
+// fingerprint identifies a request by its method, path with query string and body
+func fingerprint(method, uri string, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(method + " " + uri + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// responseRecorder copies the response body as it is written
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,187 @@
+package middleware
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+
+	"sck-pos-backend/internal/audit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Permission names an action that can be granted to a role
+type Permission string
+
+// Permissions used across the API
+const (
+	PermUsersRead        Permission = "users:read"
+	PermUsersManage      Permission = "users:manage"
+	PermProductsRead     Permission = "products:read"
+	PermProductsWrite    Permission = "products:write"
+	PermCategoriesRead   Permission = "categories:read"
+	PermCategoriesWrite  Permission = "categories:write"
+	PermCustomersRead    Permission = "customers:read"
+	PermCustomersWrite   Permission = "customers:write"
+	PermCustomersDelete  Permission = "customers:delete"
+	PermSalesRead        Permission = "sales:read"
+	PermSalesCreate      Permission = "sales:create"
+	PermSalesRefund      Permission = "sales:refund"
+	PermReportsRead      Permission = "reports:read"
+	PermLoyaltyRead      Permission = "loyalty:read"
+	PermLoyaltyRedeem    Permission = "loyalty:redeem"
+	PermLoyaltyAdjust    Permission = "loyalty:adjust"
+	PermLoyaltyManage    Permission = "loyalty:manage"
+	PermLoyaltyLedger    Permission = "loyalty:ledger"
+	PermStoresRead       Permission = "stores:read"
+	PermStoresManage     Permission = "stores:manage"
+	PermJobsRead         Permission = "jobs:read"
+	PermTerminalsManage  Permission = "terminals:manage"
+	PermOverridesApprove Permission = "overrides:approve"
+	PermAuditRead        Permission = "audit:read"
+	PermShiftsOperate    Permission = "shifts:operate"
+	PermShiftsManage     Permission = "shifts:manage"
+	PermSyncConflicts    Permission = "sync:conflicts"
+	PermCustomersMerge   Permission = "customers:merge"
+	PermCustomersPrivacy Permission = "customers:privacy"
+	PermCustomerGroups   Permission = "customers:groups"
+)
+
+// cashierPermissions are granted to every role
+var cashierPermissions = []Permission{
+	PermProductsRead,
+	PermCategoriesRead,
+	PermCustomersRead,
+	PermCustomersWrite,
+	PermSalesRead,
+	PermSalesCreate,
+	PermLoyaltyRead,
+	PermLoyaltyRedeem,
+	PermStoresRead,
+	PermShiftsOperate,
+}
+
+// managerPermissions are granted to managers on top of cashier permissions
+var managerPermissions = []Permission{
+	PermUsersRead,
+	PermProductsWrite,
+	PermCategoriesWrite,
+	PermCustomersDelete,
+	PermSalesRefund,
+	PermReportsRead,
+	PermLoyaltyAdjust,
+	PermLoyaltyManage,
+	PermJobsRead,
+	PermOverridesApprove,
+	PermShiftsManage,
+	PermSyncConflicts,
+	PermCustomersMerge,
+	PermCustomersPrivacy,
+	PermCustomerGroups,
+}
+
+// rolePermissions is the permission matrix; admin is granted everything
+var rolePermissions = map[string]map[Permission]bool{
+	"cashier": grant(cashierPermissions),
+	"manager": grant(cashierPermissions, managerPermissions),
+}
+
+// grant builds a permission set from one or more permission lists
+func grant(lists ...[]Permission) map[Permission]bool {
+	set := make(map[Permission]bool)
+	for _, list := range lists {
+		for _, perm := range list {
+			set[perm] = true
+		}
+	}
+	return set
+}
+
+// mfaRequiredRoles must sign in with a second factor before using any
+// permission-protected route
+var mfaRequiredRoles = map[string]bool{
+	"admin": true,
+}
+
+// MFARequired reports whether a role must use two-factor authentication
+func MFARequired(role string) bool {
+	return mfaRequiredRoles[role]
+}
+
+// HasPermission reports whether a role is granted a permission
+func HasPermission(role string, perm Permission) bool {
+	if role == "admin" {
+		return true
+	}
+	return rolePermissions[role][perm]
+}
+
+// RequirePermission middleware rejects requests whose role lacks perm
+// Must run after AuthRequired. Roles that require two-factor authentication are
+// refused until the session is MFA verified, and users with a forced password
+// change are refused until they change it. Denials are written to the audit log.
+func RequirePermission(db *sql.DB, perm Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, _ := c.Get("role")
+		roleStr, _ := role.(string)
+
+		if MFARequired(roleStr) && !c.GetBool("mfa_verified") {
+			recordDenial(c, db, "mfa:"+string(perm))
+
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Two-factor authentication required",
+				"code":  "mfa_required",
+			})
+			c.Abort()
+			return
+		}
+
+		if c.GetBool("password_change_required") {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Password change required",
+				"code":  "password_change_required",
+			})
+			c.Abort()
+			return
+		}
+
+		if HasPermission(roleStr, perm) {
+			c.Next()
+			return
+		}
+
+		recordDenial(c, db, string(perm))
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		c.Abort()
+	}
+}
+
+// recordDenial writes a denied access attempt to the audit log
+func recordDenial(c *gin.Context, db *sql.DB, action string) {
+	entry := audit.Entry{
+		Role:       c.GetString("role"),
+		Action:     action,
+		Resource:   c.Request.Method + " " + c.FullPath(),
+		EntityType: routeEntity(c.FullPath()),
+		EntityID:   c.Param("id"),
+		Outcome:    audit.OutcomeDenied,
+		StatusCode: http.StatusForbidden,
+		IPAddress:  c.ClientIP(),
+	}
+
+	if userID, ok := c.Get("user_id"); ok {
+		if id, ok := userID.(float64); ok {
+			uid := int(id)
+			entry.UserID = &uid
+		}
+	}
+	if username, ok := c.Get("username"); ok {
+		entry.Username, _ = username.(string)
+	}
+
+	if err := audit.Log(c.Request.Context(), db, entry); err != nil {
+		log.Printf("Failed to audit denied request: %v", err)
+	}
+	markAudited(c)
+}
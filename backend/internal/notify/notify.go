@@ -0,0 +1,83 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// ExpiringPoints describes a customer's points that are about to expire
+type ExpiringPoints struct {
+	CustomerID int     `json:"customer_id"`
+	Name       string  `json:"name"`
+	Email      *string `json:"email,omitempty"`
+	Phone      *string `json:"phone,omitempty"`
+	Points     int     `json:"points"`
+	BahtValue  float64 `json:"baht_value"`
+	ExpiryDate string  `json:"expiry_date"`
+}
+
+// Notifier delivers customer notifications to an outbound channel
+type Notifier interface {
+	NotifyPointsExpiring(ctx context.Context, notices []ExpiringPoints) error
+}
+
+// New returns a webhook notifier when a URL is configured, otherwise a log notifier
+func New(webhookURL string) Notifier {
+	if webhookURL == "" {
+		return LogNotifier{}
+	}
+	return &WebhookNotifier{
+		URL:    webhookURL,
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// WebhookNotifier posts notifications as JSON to an external URL
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+// NotifyPointsExpiring posts the expiring points notices to the webhook
+func (w *WebhookNotifier) NotifyPointsExpiring(ctx context.Context, notices []ExpiringPoints) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"event":     "loyalty.points_expiring",
+		"customers": notices,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build notification request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("notification webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// LogNotifier writes notifications to the application log
+type LogNotifier struct{}
+
+// NotifyPointsExpiring logs each expiring points notice
+func (LogNotifier) NotifyPointsExpiring(ctx context.Context, notices []ExpiringPoints) error {
+	for _, notice := range notices {
+		log.Printf("Customer %d has %d loyalty points expiring on %s", notice.CustomerID, notice.Points, notice.ExpiryDate)
+	}
+	return nil
+}
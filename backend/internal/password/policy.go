@@ -0,0 +1,133 @@
+// Package password enforces the password policy for user accounts.
+package password
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+//go:embed common_passwords.txt
+var commonPasswords string
+
+// MaxBytes is the longest password bcrypt can hash
+const MaxBytes = 72
+
+// Policy describes what a new password must satisfy
+type Policy struct {
+	MinLength   int
+	MinClasses  int // of lowercase, uppercase, digits and symbols
+	HistorySize int // previous passwords that cannot be reused
+	breached    map[string]bool
+}
+
+// NewPolicy builds a policy with the bundled breached-password list plus the
+// entries in breachedListPath, if given
+func NewPolicy(minLength, minClasses, historySize int, breachedListPath string) (*Policy, error) {
+	p := &Policy{
+		MinLength:   minLength,
+		MinClasses:  minClasses,
+		HistorySize: historySize,
+		breached:    make(map[string]bool),
+	}
+
+	p.addList(strings.NewReader(commonPasswords))
+
+	if breachedListPath != "" {
+		f, err := os.Open(breachedListPath)
+		if err != nil {
+			return nil, fmt.Errorf("open breached password list: %w", err)
+		}
+		defer f.Close()
+
+		if err := p.addList(f); err != nil {
+			return nil, fmt.Errorf("read breached password list: %w", err)
+		}
+	}
+
+	return p, nil
+}
+
+// addList loads one password per line; blank lines and # comments are skipped
+func (p *Policy) addList(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p.breached[strings.ToLower(line)] = true
+	}
+	return scanner.Err()
+}
+
+// PolicyError lists every rule a password failed
+type PolicyError struct {
+	Violations []string
+}
+
+func (e *PolicyError) Error() string {
+	return "password does not meet policy: " + strings.Join(e.Violations, "; ")
+}
+
+// Validate checks a candidate password for the given user
+// It returns a *PolicyError describing all violations, or nil.
+func (p *Policy) Validate(password, username string) error {
+	var violations []string
+
+	if len([]rune(password)) < p.MinLength {
+		violations = append(violations, fmt.Sprintf("must be at least %d characters", p.MinLength))
+	}
+	if len(password) > MaxBytes {
+		violations = append(violations, fmt.Sprintf("must be at most %d bytes", MaxBytes))
+	}
+
+	if classes := characterClasses(password); classes < p.MinClasses {
+		violations = append(violations, fmt.Sprintf(
+			"must use at least %d of: lowercase letters, uppercase letters, digits, symbols", p.MinClasses,
+		))
+	}
+
+	lower := strings.ToLower(password)
+	if username != "" && strings.Contains(lower, strings.ToLower(username)) {
+		violations = append(violations, "must not contain the username")
+	}
+
+	if p.breached[lower] {
+		violations = append(violations, "is a commonly used or breached password")
+	}
+
+	if len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// characterClasses counts the kinds of characters used
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	count := 0
+	for _, present := range []bool{lower, upper, digit, symbol} {
+		if present {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,98 @@
+package password
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	tooShort    = "must be at least 10 characters"
+	tooLong     = "must be at most 72 bytes"
+	fewClasses  = "must use at least 3 of: lowercase letters, uppercase letters, digits, symbols"
+	hasUsername = "must not contain the username"
+	breached    = "is a commonly used or breached password"
+)
+
+func newTestPolicy(t *testing.T, breachedListPath string) *Policy {
+	t.Helper()
+	p, err := NewPolicy(10, 3, 5, breachedListPath)
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+	return p
+}
+
+// violations returns the rules Validate reports broken, or nil when it passes
+func violations(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var policyErr *PolicyError
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("Validate returned %T, want *PolicyError", err)
+	}
+	return policyErr.Violations
+}
+
+func TestPolicyValidate(t *testing.T) {
+	p := newTestPolicy(t, "")
+	thai := strings.Repeat("ก", 24) // 3 bytes a character
+
+	tests := []struct {
+		name     string
+		password string
+		username string
+		want     []string
+	}{
+		{"meets every rule", "Tropical-Mango7", "alice", nil},
+		{"exactly the minimum length", "Abcdefgh1!", "alice", nil},
+		{"length counts characters not bytes", "ก" + "Abcdefg1!", "alice", nil},
+		{"too short", "Ab1!", "alice", []string{tooShort}},
+		{"exactly the bcrypt limit", strings.Repeat("a", 70) + "A1", "alice", nil},
+		{"over the bcrypt limit", strings.Repeat("a", 71) + "A1", "alice", []string{tooLong}},
+		{"multibyte over the bcrypt limit", thai + "A1", "alice", []string{tooLong}},
+		{"too few character classes", "onlylowercaseletters", "alice", []string{fewClasses}},
+		{"contains the username", "xALICEsmith-1", "alice", []string{hasUsername}},
+		{"no username to compare", "xALICEsmith-1", "", nil},
+		{"breached in any case", "Password123", "alice", []string{breached}},
+		{"every violation listed", "zq", "zq", []string{tooShort, fewClasses, hasUsername}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := violations(t, p.Validate(tt.password, tt.username))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Validate(%q, %q) violations = %q, want %q", tt.password, tt.username, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewPolicyAddsBreachedList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	list := "# local additions\n\n  Sawasdee-Krub9  \n"
+	if err := os.WriteFile(path, []byte(list), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	p := newTestPolicy(t, path)
+
+	if got := violations(t, p.Validate("sawasdee-KRUB9", "alice")); !reflect.DeepEqual(got, []string{breached}) {
+		t.Fatalf("violations = %q, want the listed password rejected", got)
+	}
+	if got := violations(t, p.Validate("Password123", "alice")); !reflect.DeepEqual(got, []string{breached}) {
+		t.Fatalf("violations = %q, want the bundled list still used", got)
+	}
+	if p.breached["# local additions"] {
+		t.Fatal("comment line loaded as a password")
+	}
+}
+
+func TestNewPolicyMissingList(t *testing.T) {
+	if _, err := NewPolicy(10, 3, 5, filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Fatal("NewPolicy succeeded with a missing breached password list")
+	}
+}
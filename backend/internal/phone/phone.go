@@ -0,0 +1,88 @@
+// Package phone normalizes phone numbers to E.164, reading numbers without a
+// country code as Thai.
+package phone
+
+import "strings"
+
+// thaiCountryCode is the E.164 prefix for Thailand
+const thaiCountryCode = "66"
+
+// Normalize returns raw in E.164 form, e.g. "081-234-5678", "+66 81 234 5678"
+// and "0066812345678" all become "+66812345678". Thai numbers must be a 9-digit
+// mobile number (starting 6, 8 or 9) or an 8-digit landline number. Numbers
+// given with another country code are kept as they are. Returns "" when raw is
+// not a phone number.
+func Normalize(raw string) string {
+	s := strings.TrimSpace(raw)
+	international := strings.HasPrefix(s, "+")
+	digits := Digits(s)
+
+	switch {
+	case international:
+	case strings.HasPrefix(digits, "00"):
+		international = true
+		digits = digits[2:]
+	case strings.HasPrefix(digits, "0"):
+		return thaiNumber(digits[1:])
+	case strings.HasPrefix(digits, thaiCountryCode) && (len(digits) == 10 || len(digits) == 11):
+		international = true
+	default:
+		return ""
+	}
+
+	if strings.HasPrefix(digits, thaiCountryCode) {
+		// Some people keep the trunk 0 after the country code: +66 081 ...
+		return thaiNumber(strings.TrimPrefix(digits[len(thaiCountryCode):], "0"))
+	}
+	if international && len(digits) >= 8 && len(digits) <= 15 && digits[0] != '0' {
+		return "+" + digits
+	}
+	return ""
+}
+
+// IsThai reports whether an E.164 number is a Thai number
+func IsThai(e164 string) bool {
+	return strings.HasPrefix(e164, "+"+thaiCountryCode)
+}
+
+// IsThaiMobile reports whether an E.164 number is a Thai mobile number
+func IsThaiMobile(e164 string) bool {
+	national := strings.TrimPrefix(e164, "+"+thaiCountryCode)
+	return IsThai(e164) && len(national) == 9 && strings.ContainsRune("689", rune(national[0]))
+}
+
+// thaiNumber returns the E.164 form of a Thai number without its trunk 0
+func thaiNumber(national string) string {
+	if national == "" {
+		return ""
+	}
+	switch national[0] {
+	case '6', '8', '9':
+		if len(national) != 9 {
+			return ""
+		}
+	case '2', '3', '4', '5', '7':
+		if len(national) != 8 {
+			return ""
+		}
+	default:
+		return ""
+	}
+	return "+" + thaiCountryCode + national
+}
+
+// Digits returns the digits in s, dropping spaces, dashes, dots, brackets and
+// a leading plus. Returns "" if s contains anything else.
+func Digits(s string) string {
+	var b strings.Builder
+	for i, r := range strings.TrimSpace(s) {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == '+' && i == 0, r == ' ', r == '-', r == '.', r == '(', r == ')':
+		default:
+			return ""
+		}
+	}
+	return b.String()
+}
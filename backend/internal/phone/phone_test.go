@@ -0,0 +1,80 @@
+package phone
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"081-234-5678", "+66812345678"},
+		{"+66 81 234 5678", "+66812345678"},
+		{"0066812345678", "+66812345678"},
+		{"66812345678", "+66812345678"},
+		{"+66 081 234 5678", "+66812345678"},
+		{" 081.234.5678 ", "+66812345678"},
+		{"02-123-4567", "+6621234567"},
+		{"(02) 123 4567", "+6621234567"},
+		{"6621234567", "+6621234567"},
+		{"+1 415 555 0100", "+14155550100"},
+		{"001 415 555 0100", "+14155550100"},
+
+		// Not phone numbers
+		{"", ""},
+		{"12345", ""},
+		{"0812345", ""},     // too short for a mobile
+		{"08123456789", ""}, // too long for a mobile
+		{"0212345678", ""},  // landline with a mobile's length
+		{"0112345678", ""},  // no Thai numbers start with 1
+		{"+0812345678", ""}, // country codes never start with 0
+		{"0081234", ""},     // too short for an international number
+		{"081 234 5678 ext", ""},
+		{"081-234-567a", ""},
+	}
+	for _, tt := range tests {
+		if got := Normalize(tt.raw); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestIsThai(t *testing.T) {
+	tests := []struct {
+		e164       string
+		thai       bool
+		thaiMobile bool
+	}{
+		{"+66812345678", true, true},
+		{"+66612345678", true, true},
+		{"+66912345678", true, true},
+		{"+6621234567", true, false},
+		{"+14155550100", false, false},
+		{"", false, false},
+	}
+	for _, tt := range tests {
+		if got := IsThai(tt.e164); got != tt.thai {
+			t.Errorf("IsThai(%q) = %v, want %v", tt.e164, got, tt.thai)
+		}
+		if got := IsThaiMobile(tt.e164); got != tt.thaiMobile {
+			t.Errorf("IsThaiMobile(%q) = %v, want %v", tt.e164, got, tt.thaiMobile)
+		}
+	}
+}
+
+func TestDigits(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{"+66 (81) 234-5678", "66812345678"},
+		{"081.234.5678", "0812345678"},
+		{"66+81", ""},
+		{"081/234", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Digits(tt.s); got != tt.want {
+			t.Errorf("Digits(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
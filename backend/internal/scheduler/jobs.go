@@ -0,0 +1,124 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"sck-pos-backend/internal/notify"
+)
+
+// LoyaltyTierJob re-evaluates customer loyalty tiers every night
+func LoyaltyTierJob(db *sql.DB) Job {
+	return Job{
+		Name:     "evaluate_loyalty_tiers",
+		Schedule: DailyAt{Hour: 3, Minute: 0},
+		Run: func(ctx context.Context) error {
+			_, err := db.ExecContext(ctx, "CALL evaluate_loyalty_tiers()")
+			return err
+		},
+	}
+}
+
+// CustomerRFMJob rescores every customer's recency, frequency and monetary
+// value every night, after the tier evaluation
+func CustomerRFMJob(db *sql.DB) Job {
+	return Job{
+		Name:     "score_customer_rfm",
+		Schedule: DailyAt{Hour: 3, Minute: 30},
+		Run: func(ctx context.Context) error {
+			_, err := db.ExecContext(ctx, "CALL score_customer_rfm()")
+			return err
+		},
+	}
+}
+
+// LoyaltyExpiryJob expires old points every night and warns customers
+// whose points expire within noticeDays
+func LoyaltyExpiryJob(db *sql.DB, notifier notify.Notifier, noticeDays int) Job {
+	return Job{
+		Name:     "expire_loyalty_points",
+		Schedule: DailyAt{Hour: 2, Minute: 0},
+		Run: func(ctx context.Context) error {
+			if _, err := db.ExecContext(ctx, "CALL expire_loyalty_points()"); err != nil {
+				return fmt.Errorf("failed to expire points: %w", err)
+			}
+			return notifyExpiringPoints(ctx, db, notifier, noticeDays)
+		},
+	}
+}
+
+// IdempotencyKeyPurgeJob deletes idempotency keys whose replay window has passed
+func IdempotencyKeyPurgeJob(db *sql.DB) Job {
+	return Job{
+		Name:     "purge_idempotency_keys",
+		Schedule: Every(time.Hour),
+		Run: func(ctx context.Context) error {
+			_, err := db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE expires_at < NOW()")
+			return err
+		},
+	}
+}
+
+// notifyExpiringPoints sends one notice per expiring balance that has not been announced yet
+// A balance counts as announced once the notifier accepts it.
+func notifyExpiringPoints(ctx context.Context, db *sql.DB, notifier notify.Notifier, noticeDays int) error {
+	rows, err := db.QueryContext(ctx, "CALL get_expiring_loyalty_points(?)", noticeDays)
+	if err != nil {
+		return fmt.Errorf("failed to list expiring points: %w", err)
+	}
+
+	var expiring []notify.ExpiringPoints
+	for rows.Next() {
+		var notice notify.ExpiringPoints
+		err := rows.Scan(
+			&notice.CustomerID,
+			&notice.Name,
+			&notice.Email,
+			&notice.Phone,
+			&notice.Points,
+			&notice.BahtValue,
+			&notice.ExpiryDate,
+		)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan expiring points: %w", err)
+		}
+		expiring = append(expiring, notice)
+	}
+	rows.Close()
+
+	var pending []notify.ExpiringPoints
+	for _, notice := range expiring {
+		var sent bool
+		err := db.QueryRowContext(ctx, `
+			SELECT EXISTS(SELECT 1 FROM loyalty_expiry_notifications WHERE customer_id = ? AND expiry_date = ?)
+		`, notice.CustomerID, notice.ExpiryDate).Scan(&sent)
+		if err != nil {
+			return fmt.Errorf("failed to check notification: %w", err)
+		}
+		if !sent {
+			pending = append(pending, notice)
+		}
+	}
+
+	if len(pending) == 0 {
+		return nil
+	}
+	if err := notifier.NotifyPointsExpiring(ctx, pending); err != nil {
+		return err
+	}
+
+	// Only notices that went out are recorded, so a failed send is retried on the next run
+	for _, notice := range pending {
+		_, err := db.ExecContext(ctx, `
+			INSERT IGNORE INTO loyalty_expiry_notifications (customer_id, expiry_date, points)
+			VALUES (?, ?, ?)
+		`, notice.CustomerID, notice.ExpiryDate, notice.Points)
+		if err != nil {
+			return fmt.Errorf("failed to record notification: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Schedule decides when a job should next run
+type Schedule interface {
+	Next(now time.Time) time.Time
+}
+
+// Every runs a job at a fixed interval
+type Every time.Duration
+
+// Next returns the next run time
+func (e Every) Next(now time.Time) time.Time {
+	return now.Add(time.Duration(e))
+}
+
+// DailyAt runs a job once a day at the given local time
+type DailyAt struct {
+	Hour   int
+	Minute int
+}
+
+// Next returns the next run time
+func (d DailyAt) Next(now time.Time) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), d.Hour, d.Minute, 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// Job represents a recurring background task
+type Job struct {
+	Name     string
+	Schedule Schedule
+	Run      func(ctx context.Context) error
+}
+
+// Scheduler runs registered jobs on their schedules
+// A MySQL named lock ensures each run happens on only one replica
+type Scheduler struct {
+	db         *sql.DB
+	instanceID string
+	jobs       []Job
+	wg         sync.WaitGroup
+}
+
+// New creates a new scheduler
+func New(db *sql.DB) *Scheduler {
+	hostname, _ := os.Hostname()
+	return &Scheduler{
+		db:         db,
+		instanceID: fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+	}
+}
+
+// Register adds a job to the scheduler
+func (s *Scheduler) Register(job Job) {
+	s.jobs = append(s.jobs, job)
+}
+
+// Start launches every registered job in its own goroutine until ctx is cancelled
+func (s *Scheduler) Start(ctx context.Context) {
+	for _, job := range s.jobs {
+		s.wg.Add(1)
+		go s.loop(ctx, job)
+	}
+}
+
+// Wait blocks until all job goroutines have stopped
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
+
+// loop waits for each scheduled time and runs the job
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	defer s.wg.Done()
+
+	for {
+		now := time.Now()
+		timer := time.NewTimer(job.Schedule.Next(now).Sub(now))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			if err := s.runOnce(ctx, job); err != nil {
+				log.Printf("Scheduled job %s failed: %v", job.Name, err)
+			}
+		}
+	}
+}
+
+// runOnce runs the job if this instance wins the leader lock and no
+// other replica has already completed the current run
+func (s *Scheduler) runOnce(ctx context.Context, job Job) error {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	lockName := "sck_pos_job_" + job.Name
+	var acquired sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 0)", lockName).Scan(&acquired); err != nil {
+		return fmt.Errorf("failed to acquire leader lock: %w", err)
+	}
+	if acquired.Int64 != 1 {
+		log.Printf("Scheduled job %s skipped: another instance holds the lock", job.Name)
+		return nil
+	}
+	defer conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", lockName)
+
+	// Replicas fire at roughly the same time; skip if a peer already finished this run
+	now := time.Now()
+	window := job.Schedule.Next(now).Sub(now) / 2
+	var recentRuns int
+	err = conn.QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM scheduled_job_runs
+		WHERE job_name = ? AND status = 'succeeded' AND started_at >= ?
+	`, job.Name, now.Add(-window)).Scan(&recentRuns)
+	if err != nil {
+		return fmt.Errorf("failed to check run history: %w", err)
+	}
+	if recentRuns > 0 {
+		log.Printf("Scheduled job %s skipped: already completed by another instance", job.Name)
+		return nil
+	}
+
+	result, err := conn.ExecContext(ctx, `
+		INSERT INTO scheduled_job_runs (job_name, instance_id, status, started_at)
+		VALUES (?, ?, 'running', ?)
+	`, job.Name, s.instanceID, now)
+	if err != nil {
+		return fmt.Errorf("failed to record job run: %w", err)
+	}
+	runID, _ := result.LastInsertId()
+
+	runErr := job.Run(ctx)
+
+	status := "succeeded"
+	var errorMessage *string
+	if runErr != nil {
+		status = "failed"
+		message := runErr.Error()
+		errorMessage = &message
+	}
+
+	_, err = conn.ExecContext(context.Background(), `
+		UPDATE scheduled_job_runs
+		SET status = ?, finished_at = ?, error_message = ?
+		WHERE id = ?
+	`, status, time.Now(), errorMessage, runID)
+	if err != nil {
+		log.Printf("Failed to record result of job %s: %v", job.Name, err)
+	}
+
+	if runErr != nil {
+		return runErr
+	}
+
+	log.Printf("Scheduled job %s completed in %s", job.Name, time.Since(now))
+	return nil
+}
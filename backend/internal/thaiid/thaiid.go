@@ -0,0 +1,48 @@
+// Package thaiid checks Thai national ID numbers and tax IDs. Both are 13 digits
+// with the same check digit, so one check covers people and companies.
+package thaiid
+
+import "strings"
+
+// Length is the number of digits in a national ID or tax ID
+const Length = 13
+
+// Normalize returns the 13 digits of raw, accepting the usual grouping
+// "1-2345-67890-12-1" or spaces. Returns "" when raw is not 13 digits or the
+// check digit is wrong.
+func Normalize(raw string) string {
+	var b strings.Builder
+	for _, r := range strings.TrimSpace(raw) {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == '-', r == ' ':
+		default:
+			return ""
+		}
+	}
+	id := b.String()
+	if !Valid(id) {
+		return ""
+	}
+	return id
+}
+
+// Valid reports whether id is 13 digits with a correct check digit
+// The first 12 digits are weighted 13 down to 2; the check digit is
+// (11 - sum mod 11) mod 10. Company tax IDs start with 0.
+func Valid(id string) bool {
+	if len(id) != Length {
+		return false
+	}
+	sum := 0
+	for i := 0; i < Length; i++ {
+		if id[i] < '0' || id[i] > '9' {
+			return false
+		}
+		if i < Length-1 {
+			sum += int(id[i]-'0') * (Length - i)
+		}
+	}
+	return int(id[Length-1]-'0') == (11-sum%11)%10
+}
@@ -0,0 +1,50 @@
+package thaiid
+
+import "testing"
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+		want bool
+	}{
+		{"person", "1101700207030", true},
+		{"company", "0107537000254", true},
+		{"company in the provinces", "0105536092641", true},
+		{"government body", "0994000165510", true},
+		{"person with wrong check digit", "1101700207031", false},
+		{"company with wrong check digit", "0107537000253", false},
+		{"too short", "110170020703", false},
+		{"too long", "11017002070300", false},
+		{"letters", "110170020703X", false},
+		{"dashes", "1-1017-00207-03-0", false},
+		{"empty", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Valid(tt.id); got != tt.want {
+				t.Errorf("Valid(%q) = %v, want %v", tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"1101700207030", "1101700207030"},
+		{"1-1017-00207-03-0", "1101700207030"},
+		{" 0 1075 37000 25 4 ", "0107537000254"},
+		{"0107537000253", ""},
+		{"1101700207030.", ""},
+		{"1/1017/00207/03/0", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Normalize(tt.raw); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
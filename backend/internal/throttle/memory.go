@@ -0,0 +1,74 @@
+package throttle
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps counters in process memory
+// Useful for tests and single-instance development; counters are lost on restart.
+type MemoryStore struct {
+	mu       sync.Mutex
+	counters map[string]Counter
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{counters: make(map[string]Counter)}
+}
+
+// Get returns the counter for key
+func (s *MemoryStore) Get(ctx context.Context, key string) (Counter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counters[key], nil
+}
+
+// Increment records a failure for key
+func (s *MemoryStore) Increment(ctx context.Context, key string, now time.Time, window time.Duration) (Counter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counter := s.counters[key]
+	if now.Sub(counter.LastFailure) > window {
+		counter.Failures = 0
+	}
+	counter.Failures++
+	counter.LastFailure = now
+	s.counters[key] = counter
+	return counter, nil
+}
+
+// Release takes back one failure for key
+func (s *MemoryStore) Release(ctx context.Context, key string) (Counter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counter, ok := s.counters[key]
+	if !ok || counter.Failures == 0 {
+		return counter, nil
+	}
+	counter.Failures--
+	s.counters[key] = counter
+	return counter, nil
+}
+
+// Lock blocks key until the given time
+func (s *MemoryStore) Lock(ctx context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counter := s.counters[key]
+	counter.LockedUntil = &until
+	s.counters[key] = counter
+	return nil
+}
+
+// Reset clears key
+func (s *MemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.counters, key)
+	return nil
+}
@@ -0,0 +1,69 @@
+package throttle
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// MySQLStore keeps counters in the login_attempts table so every replica
+// sees the same failures
+type MySQLStore struct {
+	db *sql.DB
+}
+
+// NewMySQLStore creates a database-backed store
+func NewMySQLStore(db *sql.DB) *MySQLStore {
+	return &MySQLStore{db: db}
+}
+
+// Get returns the counter for key
+func (s *MySQLStore) Get(ctx context.Context, key string) (Counter, error) {
+	var counter Counter
+	err := s.db.QueryRowContext(ctx, `
+		SELECT failures, last_failure_at, locked_until
+		FROM login_attempts
+		WHERE attempt_key = ?
+	`, key).Scan(&counter.Failures, &counter.LastFailure, &counter.LockedUntil)
+	if err == sql.ErrNoRows {
+		return Counter{}, nil
+	}
+	return counter, err
+}
+
+// Increment records a failure for key
+func (s *MySQLStore) Increment(ctx context.Context, key string, now time.Time, window time.Duration) (Counter, error) {
+	// failures is assigned before last_failure_at so it sees the previous failure time
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO login_attempts (attempt_key, failures, last_failure_at)
+		VALUES (?, 1, ?)
+		ON DUPLICATE KEY UPDATE
+			failures = IF(last_failure_at < ?, 1, failures + 1),
+			last_failure_at = VALUES(last_failure_at)
+	`, key, now, now.Add(-window))
+	if err != nil {
+		return Counter{}, err
+	}
+	return s.Get(ctx, key)
+}
+
+// Release takes back one failure for key
+func (s *MySQLStore) Release(ctx context.Context, key string) (Counter, error) {
+	_, err := s.db.ExecContext(ctx, "UPDATE login_attempts SET failures = GREATEST(failures - 1, 0) WHERE attempt_key = ?", key)
+	if err != nil {
+		return Counter{}, err
+	}
+	return s.Get(ctx, key)
+}
+
+// Lock blocks key until the given time
+func (s *MySQLStore) Lock(ctx context.Context, key string, until time.Time) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE login_attempts SET locked_until = ? WHERE attempt_key = ?", until, key)
+	return err
+}
+
+// Reset clears key
+func (s *MySQLStore) Reset(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM login_attempts WHERE attempt_key = ?", key)
+	return err
+}
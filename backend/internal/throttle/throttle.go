@@ -0,0 +1,256 @@
+// Package throttle tracks failed login attempts and decides when to slow down
+// or lock out further attempts.
+package throttle
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Counter is the failure history stored for one key (a username or an IP)
+type Counter struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil *time.Time
+}
+
+// Store persists failure counters
+// Implementations must make Increment atomic so concurrent logins are counted.
+type Store interface {
+	// Get returns the counter for key, or a zero Counter when there is none
+	Get(ctx context.Context, key string) (Counter, error)
+	// Increment records a failure at now; failures older than window start a new count
+	Increment(ctx context.Context, key string, now time.Time, window time.Duration) (Counter, error)
+	// Release takes back one counted failure, never going below zero
+	Release(ctx context.Context, key string) (Counter, error)
+	// Lock blocks key until the given time
+	Lock(ctx context.Context, key string, until time.Time) error
+	// Reset clears the counter and any lock for key
+	Reset(ctx context.Context, key string) error
+}
+
+// Policy controls backoff and lockout for one kind of key
+type Policy struct {
+	FreeAttempts int           // failures allowed before backoff starts
+	BaseDelay    time.Duration // delay after the first throttled failure, doubled each time
+	MaxDelay     time.Duration
+	Window       time.Duration // failures older than this are forgotten
+	LockAfter    int           // failures that lock the key; 0 never locks
+	LockDuration time.Duration
+}
+
+// Default policies: usernames lock after 10 failures, IPs are only slowed down
+// so a shared store network cannot lock every cashier out.
+var (
+	UsernamePolicy = Policy{
+		FreeAttempts: 3,
+		BaseDelay:    time.Second,
+		MaxDelay:     5 * time.Minute,
+		Window:       30 * time.Minute,
+		LockAfter:    10,
+		LockDuration: 30 * time.Minute,
+	}
+	IPPolicy = Policy{
+		FreeAttempts: 20,
+		BaseDelay:    time.Second,
+		MaxDelay:     15 * time.Minute,
+		Window:       time.Hour,
+	}
+)
+
+// delay returns how long to wait after the given number of failures
+func (p Policy) delay(failures int) time.Duration {
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+	d := p.BaseDelay
+	for i := p.FreeAttempts + 1; i < failures; i++ {
+		d *= 2
+		if d >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	return d
+}
+
+// Decision is the outcome of checking whether an attempt may proceed
+type Decision struct {
+	Allowed     bool
+	Locked      bool // the account is locked rather than just throttled
+	RetryAfter  time.Duration
+	LastAttempt bool // set by Begin: the account stays locked unless this attempt succeeds
+}
+
+// Guard applies username and IP policies on top of a Store
+type Guard struct {
+	store    Store
+	username Policy
+	ip       Policy
+	now      func() time.Time
+}
+
+// NewGuard creates a guard using the default policies
+func NewGuard(store Store) *Guard {
+	return &Guard{
+		store:    store,
+		username: UsernamePolicy,
+		ip:       IPPolicy,
+		now:      time.Now,
+	}
+}
+
+// Check reports whether a login for username from ip may be attempted now
+// Check does not count the attempt, so a burst of concurrent attempts can all
+// pass it before Failure counts any of them. Use Begin where each attempt must
+// be counted before the secret is checked.
+func (g *Guard) Check(ctx context.Context, username, ip string) (Decision, error) {
+	now := g.now()
+	decision := Decision{Allowed: true}
+
+	for _, k := range g.keys(username, ip) {
+		counter, err := g.store.Get(ctx, k.key)
+		if err != nil {
+			return Decision{}, err
+		}
+
+		if counter.LockedUntil != nil && now.Before(*counter.LockedUntil) {
+			decision.Allowed = false
+			decision.Locked = true
+			decision.RetryAfter = maxDuration(decision.RetryAfter, counter.LockedUntil.Sub(now))
+			continue
+		}
+
+		if now.Sub(counter.LastFailure) > k.policy.Window {
+			continue
+		}
+		retryAt := counter.LastFailure.Add(k.policy.delay(counter.Failures))
+		if now.Before(retryAt) {
+			decision.Allowed = false
+			decision.RetryAfter = maxDuration(decision.RetryAfter, retryAt.Sub(now))
+		}
+	}
+
+	return decision, nil
+}
+
+// Begin checks an attempt like Check and, when it is allowed, counts it as a
+// failure before the caller checks the secret
+// Counting comes from the store's atomic Increment, so however many attempts
+// run at once, no more than LockAfter per username get past Begin. The
+// LockAfter-th attempt locks the username up front; the caller clears the lock
+// with Success if the secret is right, or releases the count with Release when
+// the attempt should not count. A failed attempt needs no further call.
+func (g *Guard) Begin(ctx context.Context, username, ip string) (Decision, error) {
+	decision, err := g.Check(ctx, username, ip)
+	if err != nil || !decision.Allowed {
+		return decision, err
+	}
+
+	now := g.now()
+	for _, k := range g.keys(username, ip) {
+		counter, err := g.store.Increment(ctx, k.key, now, k.policy.Window)
+		if err != nil {
+			return Decision{}, err
+		}
+		if k.policy.LockAfter == 0 || counter.Failures < k.policy.LockAfter {
+			continue
+		}
+		if err := g.store.Lock(ctx, k.key, now.Add(k.policy.LockDuration)); err != nil {
+			return Decision{}, err
+		}
+		if counter.Failures > k.policy.LockAfter {
+			// Another attempt took the last slot while this one was being checked;
+			// a refused attempt is not counted
+			if _, err := g.store.Release(ctx, k.key); err != nil {
+				return Decision{}, err
+			}
+			return Decision{Locked: true, RetryAfter: k.policy.LockDuration}, nil
+		}
+		decision.LastAttempt = true
+	}
+
+	return decision, nil
+}
+
+// Failure records a failed login and locks the username once it hits the limit
+// It returns true when this failure locked the account.
+func (g *Guard) Failure(ctx context.Context, username, ip string) (bool, error) {
+	now := g.now()
+	locked := false
+
+	for _, k := range g.keys(username, ip) {
+		counter, err := g.store.Increment(ctx, k.key, now, k.policy.Window)
+		if err != nil {
+			return false, err
+		}
+		if k.policy.LockAfter > 0 && counter.Failures >= k.policy.LockAfter {
+			if err := g.store.Lock(ctx, k.key, now.Add(k.policy.LockDuration)); err != nil {
+				return false, err
+			}
+			locked = true
+		}
+	}
+
+	return locked, nil
+}
+
+// Success clears the username counter after a successful login and takes back
+// the IP count Begin added for it
+// The rest of the IP counter is left to decay so one valid account cannot reset it.
+func (g *Guard) Success(ctx context.Context, username, ip string) error {
+	if err := g.store.Reset(ctx, UsernameKey(username)); err != nil {
+		return err
+	}
+	_, err := g.store.Release(ctx, "ip:"+ip)
+	return err
+}
+
+// Release takes back the counts Begin added for an attempt that succeeded
+// without ending the username's failure history, e.g. a correct password that
+// still needs a second factor; it lifts the lock Begin set for a last attempt
+func (g *Guard) Release(ctx context.Context, username, ip string) error {
+	now := g.now()
+	for _, k := range g.keys(username, ip) {
+		counter, err := g.store.Release(ctx, k.key)
+		if err != nil {
+			return err
+		}
+		if k.policy.LockAfter > 0 && counter.Failures < k.policy.LockAfter && counter.LockedUntil != nil && now.Before(*counter.LockedUntil) {
+			if err := g.store.Lock(ctx, k.key, now); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Unlock clears the username counter and lock
+func (g *Guard) Unlock(ctx context.Context, username string) error {
+	return g.store.Reset(ctx, UsernameKey(username))
+}
+
+type policyKey struct {
+	key    string
+	policy Policy
+}
+
+func (g *Guard) keys(username, ip string) []policyKey {
+	return []policyKey{
+		{UsernameKey(username), g.username},
+		{"ip:" + ip, g.ip},
+	}
+}
+
+// UsernameKey returns the store key for a username
+// Usernames compare case-insensitively in the database, so keys do too.
+func UsernameKey(username string) string {
+	return "user:" + strings.ToLower(username)
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
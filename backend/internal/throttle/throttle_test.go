@@ -0,0 +1,280 @@
+package throttle
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestGuard returns a guard on an in-memory store and a clock the test moves by hand
+func newTestGuard() (*Guard, *time.Time) {
+	now := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	g := NewGuard(NewMemoryStore())
+	g.now = func() time.Time { return now }
+	return g, &now
+}
+
+func fail(t *testing.T, g *Guard, username, ip string, times int) bool {
+	t.Helper()
+	locked := false
+	for i := 0; i < times; i++ {
+		var err error
+		if locked, err = g.Failure(context.Background(), username, ip); err != nil {
+			t.Fatalf("Failure: %v", err)
+		}
+	}
+	return locked
+}
+
+func check(t *testing.T, g *Guard, username, ip string) Decision {
+	t.Helper()
+	decision, err := g.Check(context.Background(), username, ip)
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	return decision
+}
+
+func TestPolicyDelayDoublesAfterFreeAttempts(t *testing.T) {
+	p := Policy{FreeAttempts: 3, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{3, 0},
+		{4, time.Second},
+		{5, 2 * time.Second},
+		{6, 4 * time.Second},
+		{7, 8 * time.Second},
+		{8, 10 * time.Second},
+		{50, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := p.delay(tt.failures); got != tt.want {
+			t.Errorf("delay(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestGuardBacksOffUsername(t *testing.T) {
+	g, now := newTestGuard()
+
+	fail(t, g, "alice", "10.0.0.1", UsernamePolicy.FreeAttempts)
+	if d := check(t, g, "alice", "10.0.0.1"); !d.Allowed {
+		t.Fatalf("blocked after %d failures: %+v", UsernamePolicy.FreeAttempts, d)
+	}
+
+	fail(t, g, "alice", "10.0.0.1", 2)
+	d := check(t, g, "Alice", "10.0.0.2")
+	if d.Allowed || d.Locked || d.RetryAfter != 2*time.Second {
+		t.Fatalf("after %d failures got %+v, want throttled for 2s", UsernamePolicy.FreeAttempts+2, d)
+	}
+
+	*now = now.Add(2 * time.Second)
+	if d := check(t, g, "alice", "10.0.0.1"); !d.Allowed {
+		t.Fatalf("still blocked once the delay passed: %+v", d)
+	}
+}
+
+func TestGuardForgetsFailuresOutsideWindow(t *testing.T) {
+	g, now := newTestGuard()
+
+	fail(t, g, "alice", "10.0.0.1", UsernamePolicy.LockAfter-1)
+	*now = now.Add(UsernamePolicy.Window + time.Second)
+
+	if locked := fail(t, g, "alice", "10.0.0.1", 1); locked {
+		t.Fatal("locked by failures older than the window")
+	}
+	if d := check(t, g, "alice", "10.0.0.1"); !d.Allowed {
+		t.Fatalf("blocked after a single recent failure: %+v", d)
+	}
+}
+
+func TestGuardLocksUsername(t *testing.T) {
+	g, now := newTestGuard()
+
+	if locked := fail(t, g, "alice", "10.0.0.1", UsernamePolicy.LockAfter-1); locked {
+		t.Fatalf("locked before %d failures", UsernamePolicy.LockAfter)
+	}
+	if locked := fail(t, g, "alice", "10.0.0.1", 1); !locked {
+		t.Fatalf("not locked after %d failures", UsernamePolicy.LockAfter)
+	}
+
+	// The lock follows the username to any IP
+	d := check(t, g, "alice", "192.168.1.9")
+	if d.Allowed || !d.Locked || d.RetryAfter != UsernamePolicy.LockDuration {
+		t.Fatalf("got %+v, want locked for %v", d, UsernamePolicy.LockDuration)
+	}
+	if d := check(t, g, "bob", "192.168.1.9"); !d.Allowed {
+		t.Fatalf("other user blocked by alice's lock: %+v", d)
+	}
+
+	*now = now.Add(UsernamePolicy.LockDuration)
+	if d := check(t, g, "alice", "192.168.1.9"); d.Locked {
+		t.Fatalf("still locked once the lock expired: %+v", d)
+	}
+}
+
+func TestGuardThrottlesIPWithoutLocking(t *testing.T) {
+	g, _ := newTestGuard()
+
+	// Spread over many usernames so only the IP counter builds up
+	for i := 0; i <= IPPolicy.FreeAttempts; i++ {
+		if locked := fail(t, g, fmt.Sprintf("user%d", i), "10.0.0.1", 1); locked {
+			t.Fatalf("IP failures locked user%d", i)
+		}
+	}
+
+	d := check(t, g, "carol", "10.0.0.1")
+	if d.Allowed || d.Locked || d.RetryAfter != IPPolicy.BaseDelay {
+		t.Fatalf("got %+v, want the IP throttled for %v", d, IPPolicy.BaseDelay)
+	}
+	if d := check(t, g, "carol", "10.0.0.2"); !d.Allowed {
+		t.Fatalf("another IP blocked: %+v", d)
+	}
+}
+
+func TestGuardSuccessResetsUsernameOnly(t *testing.T) {
+	g, _ := newTestGuard()
+	ctx := context.Background()
+
+	fail(t, g, "alice", "10.0.0.1", UsernamePolicy.FreeAttempts+2)
+	if err := g.Success(ctx, "ALICE", "10.0.0.2"); err != nil {
+		t.Fatalf("Success: %v", err)
+	}
+	if d := check(t, g, "alice", "10.0.0.2"); !d.Allowed {
+		t.Fatalf("username still throttled after a success: %+v", d)
+	}
+
+	counter, err := g.store.Get(ctx, "ip:10.0.0.1")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if counter.Failures != UsernamePolicy.FreeAttempts+2 {
+		t.Fatalf("IP counter = %d failures, want it left alone", counter.Failures)
+	}
+}
+
+func TestGuardUnlock(t *testing.T) {
+	g, _ := newTestGuard()
+
+	fail(t, g, "alice", "10.0.0.1", UsernamePolicy.LockAfter)
+	if d := check(t, g, "alice", "10.0.0.2"); !d.Locked {
+		t.Fatalf("not locked: %+v", d)
+	}
+
+	if err := g.Unlock(context.Background(), "alice"); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if d := check(t, g, "alice", "10.0.0.2"); !d.Allowed {
+		t.Fatalf("still blocked after Unlock: %+v", d)
+	}
+}
+
+func TestGuardBeginCapsConcurrentAttempts(t *testing.T) {
+	g, _ := newTestGuard()
+	g.username.BaseDelay = 0 // only the lock limits this burst
+
+	const attempts = 50
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	allowed, lastAttempts := 0, 0
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d, err := g.Begin(context.Background(), "alice", "10.0.0.1")
+			if err != nil {
+				t.Errorf("Begin: %v", err)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if d.Allowed {
+				allowed++
+			}
+			if d.LastAttempt {
+				lastAttempts++
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != UsernamePolicy.LockAfter || lastAttempts != 1 {
+		t.Fatalf("%d of %d attempts allowed with %d last attempts, want %d and 1",
+			allowed, attempts, lastAttempts, UsernamePolicy.LockAfter)
+	}
+	counter, err := g.store.Get(context.Background(), UsernameKey("alice"))
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if counter.Failures != UsernamePolicy.LockAfter {
+		t.Fatalf("username counter = %d failures, want refused attempts left out", counter.Failures)
+	}
+	if d := check(t, g, "alice", "10.0.0.2"); !d.Locked {
+		t.Fatalf("not locked after the burst: %+v", d)
+	}
+}
+
+func TestGuardBeginLastAttempt(t *testing.T) {
+	tests := []struct {
+		name       string
+		finish     func(g *Guard) error
+		wantLocked bool
+	}{
+		{"failure keeps the lock", func(g *Guard) error { return nil }, true},
+		{"success lifts the lock", func(g *Guard) error {
+			return g.Success(context.Background(), "alice", "10.0.0.1")
+		}, false},
+		{"release lifts the lock", func(g *Guard) error {
+			return g.Release(context.Background(), "alice", "10.0.0.1")
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, now := newTestGuard()
+			fail(t, g, "alice", "10.0.0.1", UsernamePolicy.LockAfter-1)
+			*now = now.Add(UsernamePolicy.MaxDelay)
+
+			d, err := g.Begin(context.Background(), "alice", "10.0.0.1")
+			if err != nil {
+				t.Fatalf("Begin: %v", err)
+			}
+			if !d.Allowed || !d.LastAttempt {
+				t.Fatalf("got %+v, want the last attempt allowed", d)
+			}
+			if err := tt.finish(g); err != nil {
+				t.Fatalf("finish: %v", err)
+			}
+			if d := check(t, g, "alice", "10.0.0.1"); d.Locked != tt.wantLocked {
+				t.Fatalf("got %+v, want locked = %v", d, tt.wantLocked)
+			}
+		})
+	}
+}
+
+func TestGuardReleaseTakesBackOneAttempt(t *testing.T) {
+	g, _ := newTestGuard()
+	ctx := context.Background()
+
+	fail(t, g, "alice", "10.0.0.1", 2)
+	if _, err := g.Begin(ctx, "alice", "10.0.0.1"); err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	if err := g.Release(ctx, "alice", "10.0.0.1"); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+
+	for _, key := range []string{UsernameKey("alice"), "ip:10.0.0.1"} {
+		counter, err := g.store.Get(ctx, key)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if counter.Failures != 2 {
+			t.Errorf("%s = %d failures, want the earlier 2 kept", key, counter.Failures)
+		}
+	}
+}
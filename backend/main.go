@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 
 	"sck-pos-backend/internal/api"
 	"sck-pos-backend/internal/config"
 	"sck-pos-backend/internal/database"
+	"sck-pos-backend/internal/notify"
+	"sck-pos-backend/internal/scheduler"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -20,6 +23,9 @@ func main() {
 
 	// Load configuration
 	cfg := config.Load()
+	if err := cfg.Validate(); err != nil {
+		log.Fatal("Invalid configuration: ", err)
+	}
 
 	// Initialize database
 	db, err := database.Connect(cfg.DatabaseURL)
@@ -38,6 +44,24 @@ func main() {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
+	// Run a maintenance command instead of the server when one is given
+	if len(os.Args) > 1 {
+		if err := runCommand(db, os.Args[1], os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Start background jobs
+	if cfg.SchedulerEnabled {
+		jobs := scheduler.New(db)
+		jobs.Register(scheduler.LoyaltyTierJob(db))
+		jobs.Register(scheduler.CustomerRFMJob(db))
+		jobs.Register(scheduler.LoyaltyExpiryJob(db, notify.New(cfg.NotificationWebhookURL), cfg.LoyaltyExpiryNoticeDays))
+		jobs.Register(scheduler.IdempotencyKeyPurgeJob(db))
+		jobs.Start(context.Background())
+	}
+
 	// Initialize router
 	router := api.SetupRouter(db, cfg)
 
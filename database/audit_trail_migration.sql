@@ -0,0 +1,52 @@
+-- Audit Trail Migration
+-- Run this after manager_override_migration.sql
+-- Requirements:
+-- 1. Every mutating API request is recorded with user, role, IP, route and entity
+-- 2. Changes to customers, products, users, loyalty points and sales keep before/after JSON
+-- 3. The log is append-only and tamper-evident through a hash chain
+
+USE sck_pos;
+
+-- Audit Logs table additions
+-- before_data/after_data are TEXT rather than JSON so the hashed bytes are kept exactly
+ALTER TABLE audit_logs
+    ADD COLUMN role VARCHAR(20) NULL AFTER username,
+    ADD COLUMN entity_type VARCHAR(50) NULL AFTER resource,
+    ADD COLUMN entity_id VARCHAR(64) NULL AFTER entity_type,
+    ADD COLUMN status_code SMALLINT NULL AFTER outcome,
+    ADD COLUMN before_data MEDIUMTEXT NULL AFTER details,
+    ADD COLUMN after_data MEDIUMTEXT NULL AFTER before_data,
+    ADD COLUMN prev_hash CHAR(64) NULL AFTER after_data,
+    ADD COLUMN hash CHAR(64) NULL AFTER prev_hash,
+    ADD INDEX idx_entity (entity_type, entity_id, created_at),
+    ADD INDEX idx_date (created_at);
+
+-- Audit Chain table
+-- Single row holding the newest hash; locking it serializes writers so the chain never forks
+CREATE TABLE audit_chain (
+    id TINYINT PRIMARY KEY,
+    last_log_id BIGINT NULL,
+    last_hash CHAR(64) NOT NULL
+);
+
+-- The chain starts from 64 zeros; rows logged before this migration are not hashed
+INSERT INTO audit_chain (id, last_log_id, last_hash) VALUES (1, NULL, REPEAT('0', 64));
+
+-- Audit logs can only be appended to
+DELIMITER //
+
+CREATE TRIGGER audit_logs_no_update
+BEFORE UPDATE ON audit_logs
+FOR EACH ROW
+BEGIN
+    SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_logs is append-only';
+END //
+
+CREATE TRIGGER audit_logs_no_delete
+BEFORE DELETE ON audit_logs
+FOR EACH ROW
+BEGIN
+    SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_logs is append-only';
+END //
+
+DELIMITER ;
@@ -0,0 +1,25 @@
+-- Role-Based Authorization Migration
+-- Run this after loyalty_adjustments_migration.sql
+-- Requirements:
+-- 1. Routes are guarded by a role permission matrix in the backend
+-- 2. Denied requests are recorded for review
+
+USE sck_pos;
+
+-- Audit Logs table
+-- Records security relevant actions and their outcome
+CREATE TABLE audit_logs (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    user_id INT, -- NULL for unauthenticated requests
+    username VARCHAR(50),
+    action VARCHAR(100) NOT NULL, -- e.g. permission name or event type
+    resource VARCHAR(255), -- e.g. request method and path
+    outcome ENUM('success', 'denied', 'failure') NOT NULL,
+    ip_address VARCHAR(45),
+    details TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL,
+    INDEX idx_user_date (user_id, created_at),
+    INDEX idx_action_date (action, created_at),
+    INDEX idx_outcome_date (outcome, created_at)
+);
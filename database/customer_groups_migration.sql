@@ -0,0 +1,79 @@
+-- Customer Groups Migration
+-- Run this after customer_validation_migration.sql
+-- Requirements:
+-- 1. Customers can belong to a group such as wholesale, staff or VIP
+-- 2. Each group has a percentage discount and/or a price list that checkout applies
+-- 3. Segments select customers by rules (spend, tier, group, ...) and keep snapshots for campaigns
+
+USE sck_pos;
+
+-- Customer Groups table
+-- discount_percent applies to products missing from the group's price list
+CREATE TABLE customer_groups (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    code VARCHAR(30) UNIQUE NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    discount_percent DECIMAL(5, 2) NOT NULL DEFAULT 0.00,
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    CHECK (discount_percent >= 0 AND discount_percent <= 100)
+);
+
+INSERT INTO customer_groups (code, name, discount_percent) VALUES
+('wholesale', 'Wholesale', 0.00),
+('staff', 'Staff', 10.00),
+('vip', 'VIP', 5.00);
+
+-- Customer Group Prices table
+-- A group's own price for a product, used instead of the percentage discount
+CREATE TABLE customer_group_prices (
+    customer_group_id INT NOT NULL,
+    product_id INT NOT NULL,
+    price DECIMAL(10, 2) NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (customer_group_id, product_id),
+    FOREIGN KEY (customer_group_id) REFERENCES customer_groups(id) ON DELETE CASCADE,
+    FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE
+);
+
+ALTER TABLE customers
+    ADD COLUMN customer_group_id INT NULL AFTER tax_id,
+    ADD CONSTRAINT fk_customers_group FOREIGN KEY (customer_group_id) REFERENCES customer_groups(id),
+    ADD INDEX idx_customer_group (customer_group_id);
+
+-- Customer Segments table
+-- rules is the JSON rule set, e.g. {"min_spend": 10000, "spend_days": 365, "tiers": ["gold"]}
+CREATE TABLE customer_segments (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    name VARCHAR(100) NOT NULL,
+    description TEXT,
+    rules JSON NOT NULL,
+    created_by INT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- Customer Segment Snapshots table
+-- The members of a segment at one moment; rules are copied so later edits do
+-- not change what a campaign was sent to
+CREATE TABLE customer_segment_snapshots (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    segment_id INT NOT NULL,
+    rules JSON NOT NULL,
+    customer_count INT NOT NULL,
+    created_by INT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (segment_id) REFERENCES customer_segments(id) ON DELETE CASCADE,
+    FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL,
+    INDEX idx_segment_date (segment_id, created_at)
+);
+
+CREATE TABLE customer_segment_snapshot_members (
+    snapshot_id INT NOT NULL,
+    customer_id INT NOT NULL,
+    PRIMARY KEY (snapshot_id, customer_id),
+    FOREIGN KEY (snapshot_id) REFERENCES customer_segment_snapshots(id) ON DELETE CASCADE,
+    FOREIGN KEY (customer_id) REFERENCES customers(id)
+);
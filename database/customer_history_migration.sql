@@ -0,0 +1,66 @@
+-- Customer History Migration
+-- Run this after customer_search_migration.sql
+-- Requirements:
+-- 1. A customer's purchase history pages quickly, newest first
+-- 2. Lifetime value and RFM metrics are computed from completed sales
+-- 3. RFM scores are worked out nightly rather than on every page view
+
+USE sck_pos;
+
+-- Covers the per-customer aggregates over completed sales
+ALTER TABLE sales ADD INDEX idx_customer_status_date (customer_id, payment_status, created_at);
+
+-- Covers the history listing, which shows sales of every status newest first
+ALTER TABLE sales ADD INDEX idx_customer_date (customer_id, created_at);
+
+-- Customer RFM Scores table
+-- Recency, frequency and monetary scores from 1 to 5, ranked against every
+-- customer with a completed sale when the scores were last worked out
+CREATE TABLE customer_rfm_scores (
+    customer_id INT PRIMARY KEY,
+    recency TINYINT NOT NULL,
+    frequency TINYINT NOT NULL,
+    monetary TINYINT NOT NULL,
+    scored_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (customer_id) REFERENCES customers(id) ON DELETE CASCADE
+);
+
+-- Create stored procedure to rescore every customer
+-- Percentile ranks give equal values the same score
+DELIMITER //
+
+CREATE PROCEDURE score_customer_rfm()
+BEGIN
+    DECLARE EXIT HANDLER FOR SQLEXCEPTION
+    BEGIN
+        ROLLBACK;
+        RESIGNAL;
+    END;
+
+    START TRANSACTION;
+
+    DELETE FROM customer_rfm_scores;
+
+    INSERT INTO customer_rfm_scores (customer_id, recency, frequency, monetary)
+    WITH stats AS (
+        SELECT customer_id,
+            DATEDIFF(CURDATE(), MAX(created_at)) AS recency,
+            COUNT(*) AS frequency,
+            SUM(total_amount) AS monetary
+        FROM sales
+        WHERE customer_id IS NOT NULL AND payment_status = 'completed'
+        GROUP BY customer_id
+    )
+    SELECT customer_id,
+        LEAST(5, 1 + FLOOR(5 * PERCENT_RANK() OVER (ORDER BY recency DESC))),
+        LEAST(5, 1 + FLOOR(5 * PERCENT_RANK() OVER (ORDER BY frequency))),
+        LEAST(5, 1 + FLOOR(5 * PERCENT_RANK() OVER (ORDER BY monetary)))
+    FROM stats;
+
+    COMMIT;
+END//
+
+DELIMITER ;
+
+-- Score existing customers now instead of waiting for the first nightly run
+CALL score_customer_rfm();
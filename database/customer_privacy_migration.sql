@@ -0,0 +1,30 @@
+-- Customer Privacy Migration
+-- Run this after customer_history_migration.sql
+-- Requirements:
+-- 1. Record each customer's consent per purpose, with when and how it was given or withdrawn (PDPA)
+-- 2. Export everything held on a customer
+-- 3. Erase a customer's personal data while keeping sales and loyalty ledgers for accounting
+
+USE sck_pos;
+
+-- erased_at is set once a customer's personal data has been anonymized
+ALTER TABLE customers
+    ADD COLUMN erased_at TIMESTAMP NULL AFTER merged_into_id,
+    ADD COLUMN erased_by INT NULL AFTER erased_at,
+    ADD CONSTRAINT fk_customers_erased_by FOREIGN KEY (erased_by) REFERENCES users(id) ON DELETE SET NULL;
+
+-- Customer Consents table
+-- Append-only: each grant or withdrawal is a new row, and the newest row per
+-- purpose is the customer's current choice
+CREATE TABLE customer_consents (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    customer_id INT NOT NULL,
+    purpose ENUM('marketing', 'loyalty', 'email_receipts') NOT NULL,
+    granted BOOLEAN NOT NULL,
+    source VARCHAR(50) NOT NULL DEFAULT 'pos', -- where the customer gave the answer, e.g. pos, paper_form, web
+    recorded_by INT NULL,
+    created_at TIMESTAMP(3) DEFAULT CURRENT_TIMESTAMP(3),
+    FOREIGN KEY (customer_id) REFERENCES customers(id),
+    FOREIGN KEY (recorded_by) REFERENCES users(id) ON DELETE SET NULL,
+    INDEX idx_customer_purpose (customer_id, purpose, id)
+);
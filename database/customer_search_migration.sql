@@ -0,0 +1,34 @@
+-- Customer Search Migration
+-- Run this after idempotency_keys_migration.sql
+-- Requirements:
+-- 1. Find customers by phone however the number was typed (081-234-5678, +66 81 234 5678)
+-- 2. Page through customers instead of loading them all
+-- 3. Merge duplicate customers, keeping their loyalty points and sales history
+
+USE sck_pos;
+
+-- phone_normalized is the E.164 form of phone, set by the API; fill it for
+-- existing customers with: go run . customer-phones
+-- merged_into_id points at the customer a merged duplicate now lives on
+ALTER TABLE customers
+    ADD COLUMN phone_normalized VARCHAR(16) NULL AFTER phone,
+    ADD COLUMN merged_into_id INT NULL AFTER is_active,
+    ADD CONSTRAINT fk_customers_merged_into FOREIGN KEY (merged_into_id) REFERENCES customers(id),
+    ADD INDEX idx_phone_normalized (phone_normalized),
+    ADD INDEX idx_name (name);
+
+-- Customer Merges table
+-- One row per duplicate folded into another customer
+CREATE TABLE customer_merges (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    customer_id INT NOT NULL, -- the customer that was kept
+    merged_customer_id INT NOT NULL, -- the duplicate, now inactive
+    points_moved INT NOT NULL,
+    sales_moved INT NOT NULL,
+    merged_by INT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (customer_id) REFERENCES customers(id),
+    FOREIGN KEY (merged_customer_id) REFERENCES customers(id),
+    FOREIGN KEY (merged_by) REFERENCES users(id) ON DELETE SET NULL,
+    INDEX idx_customer (customer_id)
+);
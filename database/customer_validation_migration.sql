@@ -0,0 +1,19 @@
+-- Customer Validation Migration
+-- Run this after customer_privacy_migration.sql
+-- Requirements:
+-- 1. Optional Thai national ID or tax ID on customers
+-- 2. No two active customers share a phone number
+
+USE sck_pos;
+
+-- Before running, fill phone_normalized (go run . customer-phones) and merge the
+-- customers listed by GET /api/v1/customers/duplicates that share a phone; the
+-- unique key cannot be added while active customers share one.
+-- tax_id holds the 13 digits of a national ID or company tax ID, without dashes
+-- active_phone is phone_normalized for active customers only, so inactive,
+-- merged and erased customers do not block the number
+ALTER TABLE customers
+    ADD COLUMN tax_id CHAR(13) NULL AFTER address,
+    ADD COLUMN active_phone VARCHAR(16) AS (IF(is_active, phone_normalized, NULL)) STORED,
+    ADD UNIQUE KEY unique_active_phone (active_phone),
+    ADD INDEX idx_tax_id (tax_id);
@@ -0,0 +1,26 @@
+-- Idempotency Keys Migration
+-- Run this after offline_sync_migration.sql
+-- Requirements:
+-- 1. A POST retried with the same Idempotency-Key header runs only once
+-- 2. Retries get the original response back
+-- 3. Keys are kept for a configurable window, then purged
+
+USE sck_pos;
+
+-- One row per key a user has sent; the response is kept once the request succeeds,
+-- except responses carrying a one-time secret, which keep only their status
+CREATE TABLE idempotency_keys (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    user_id INT NOT NULL,
+    idempotency_key VARCHAR(255) NOT NULL,
+    request_hash CHAR(64) NOT NULL, -- SHA-256 of method, path, query string and body
+    status ENUM('processing', 'completed') NOT NULL,
+    response_status INT NULL,
+    response_content_type VARCHAR(100) NULL,
+    response_body MEDIUMTEXT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    UNIQUE KEY uk_user_key (user_id, idempotency_key),
+    INDEX idx_expires (expires_at)
+);
@@ -0,0 +1,32 @@
+-- Login Brute-Force Protection Migration
+-- Run this after pin_login_migration.sql
+-- Requirements:
+-- 1. Failed logins are counted per username and per IP address
+-- 2. Repeated failures slow down further attempts and lock the account
+-- 3. Every failed login is recorded for review
+
+USE sck_pos;
+
+-- Login Attempts table
+-- Failure counters shared by all backend replicas
+CREATE TABLE login_attempts (
+    attempt_key VARCHAR(191) PRIMARY KEY, -- 'user:<username>' or 'ip:<address>'
+    failures INT NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP NULL
+);
+
+-- Failed Logins table
+-- Log of rejected login attempts
+CREATE TABLE failed_logins (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    username VARCHAR(100) NOT NULL,
+    user_id INT NULL, -- NULL when the username does not exist
+    ip_address VARCHAR(45),
+    user_agent VARCHAR(255),
+    reason ENUM('invalid_credentials', 'throttled', 'locked') NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL,
+    INDEX idx_username_created (username, created_at),
+    INDEX idx_created (created_at)
+);
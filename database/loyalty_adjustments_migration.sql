@@ -0,0 +1,171 @@
+-- Loyalty Manual Adjustments Migration
+-- Run this after loyalty_expiry_scheduler_migration.sql
+-- Requirements:
+-- 1. Managers can credit or debit points with a mandatory reason
+-- 2. Goodwill points are recorded as 'bonus' transactions
+-- 3. Balances and customers.loyalty_points stay consistent
+-- 4. Every manual change records the user who made it
+
+USE sck_pos;
+
+-- Allow adjustment and bonus transactions and record who created them
+ALTER TABLE loyalty_point_transactions
+    MODIFY COLUMN transaction_type ENUM('earned', 'redeemed', 'expired', 'adjusted', 'bonus') NOT NULL,
+    ADD COLUMN created_by INT NULL AFTER notes,
+    ADD CONSTRAINT fk_loyalty_transactions_created_by FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL;
+
+DELIMITER //
+
+-- Credit or debit a customer's points
+-- Positive p_points credits a new balance, negative p_points debits oldest balances first
+CREATE PROCEDURE adjust_loyalty_points(
+    IN p_customer_id INT,
+    IN p_points INT,
+    IN p_transaction_type VARCHAR(20),
+    IN p_reason TEXT,
+    IN p_user_id INT,
+    OUT p_transaction_id INT
+)
+BEGIN
+    DECLARE points_available INT DEFAULT 0;
+    DECLARE points_remaining INT DEFAULT 0;
+    DECLARE current_balance_id INT;
+    DECLARE current_balance_points INT;
+    DECLARE points_to_deduct INT;
+    DECLARE new_expiry_date DATE;
+    DECLARE done INT DEFAULT FALSE;
+
+    -- Cursor to get available point balances (oldest first, not expired)
+    DECLARE balance_cursor CURSOR FOR
+        SELECT id, points
+        FROM loyalty_point_balances
+        WHERE customer_id = p_customer_id
+          AND points > 0
+          AND expiry_date > CURDATE()
+          AND is_expired = FALSE
+        ORDER BY earned_date ASC
+        FOR UPDATE;
+
+    DECLARE CONTINUE HANDLER FOR NOT FOUND SET done = TRUE;
+
+    DECLARE EXIT HANDLER FOR SQLEXCEPTION
+    BEGIN
+        ROLLBACK;
+        RESIGNAL;
+    END;
+
+    IF p_transaction_type NOT IN ('adjusted', 'bonus') THEN
+        SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'Invalid adjustment type';
+    END IF;
+
+    IF p_transaction_type = 'bonus' AND p_points <= 0 THEN
+        SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'Bonus points must be positive';
+    END IF;
+
+    START TRANSACTION;
+
+    IF p_points > 0 THEN
+        -- Credited points expire on the standard 180 day schedule
+        SET new_expiry_date = DATE_ADD(CURDATE(), INTERVAL 180 DAY);
+
+        INSERT INTO loyalty_point_transactions (
+            customer_id,
+            transaction_type,
+            points,
+            expiry_date,
+            notes,
+            created_by
+        ) VALUES (
+            p_customer_id,
+            p_transaction_type,
+            p_points,
+            new_expiry_date,
+            p_reason,
+            p_user_id
+        );
+
+        SET p_transaction_id = LAST_INSERT_ID();
+
+        INSERT INTO loyalty_point_balances (
+            customer_id,
+            points,
+            earned_date,
+            expiry_date
+        ) VALUES (
+            p_customer_id,
+            p_points,
+            CURDATE(),
+            new_expiry_date
+        ) ON DUPLICATE KEY UPDATE
+            points = points + p_points,
+            updated_at = CURRENT_TIMESTAMP;
+    ELSE
+        -- Check if customer has enough points to debit
+        SELECT COALESCE(SUM(points), 0) INTO points_available
+        FROM loyalty_point_balances
+        WHERE customer_id = p_customer_id
+          AND points > 0
+          AND expiry_date > CURDATE()
+          AND is_expired = FALSE
+        FOR UPDATE;
+
+        IF points_available < -p_points THEN
+            SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'Insufficient loyalty points';
+        END IF;
+
+        INSERT INTO loyalty_point_transactions (
+            customer_id,
+            transaction_type,
+            points,
+            notes,
+            created_by
+        ) VALUES (
+            p_customer_id,
+            p_transaction_type,
+            p_points,
+            p_reason,
+            p_user_id
+        );
+
+        SET p_transaction_id = LAST_INSERT_ID();
+
+        -- Deduct points from balances (FIFO - oldest first)
+        SET points_remaining = -p_points;
+
+        OPEN balance_cursor;
+
+        read_loop: LOOP
+            FETCH balance_cursor INTO current_balance_id, current_balance_points;
+
+            IF done OR points_remaining <= 0 THEN
+                LEAVE read_loop;
+            END IF;
+
+            IF current_balance_points >= points_remaining THEN
+                SET points_to_deduct = points_remaining;
+                SET points_remaining = 0;
+            ELSE
+                SET points_to_deduct = current_balance_points;
+                SET points_remaining = points_remaining - current_balance_points;
+            END IF;
+
+            UPDATE loyalty_point_balances
+            SET points = points - points_to_deduct,
+                updated_at = CURRENT_TIMESTAMP
+            WHERE id = current_balance_id;
+
+        END LOOP;
+
+        CLOSE balance_cursor;
+    END IF;
+
+    -- Update customer's total loyalty points
+    UPDATE customers
+    SET loyalty_points = loyalty_points + p_points,
+        updated_at = CURRENT_TIMESTAMP
+    WHERE id = p_customer_id;
+
+    COMMIT;
+END//
+
+DELIMITER ;
@@ -0,0 +1,59 @@
+-- Loyalty Expiry Scheduler Migration
+-- Run this after loyalty_sale_redemption_migration.sql
+-- Requirements:
+-- 1. Points expiry runs nightly from the backend scheduler, once across replicas
+-- 2. Every scheduled run is recorded
+-- 3. Customers are warned before their points expire
+
+USE sck_pos;
+
+-- Scheduled Job Runs table
+-- History of background job executions
+CREATE TABLE scheduled_job_runs (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    job_name VARCHAR(100) NOT NULL,
+    instance_id VARCHAR(255) NOT NULL, -- replica that ran the job
+    status ENUM('running', 'succeeded', 'failed') NOT NULL,
+    started_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP NULL,
+    error_message TEXT,
+    INDEX idx_job_started (job_name, started_at)
+);
+
+-- Loyalty Expiry Notifications table
+-- Ensures each expiring balance is only announced once
+CREATE TABLE loyalty_expiry_notifications (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    customer_id INT NOT NULL,
+    expiry_date DATE NOT NULL,
+    points INT NOT NULL,
+    notified_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (customer_id) REFERENCES customers(id) ON DELETE CASCADE,
+    UNIQUE KEY unique_customer_expiry (customer_id, expiry_date)
+);
+
+DELIMITER //
+
+-- List customers with points expiring in the next p_days days
+CREATE PROCEDURE get_expiring_loyalty_points(IN p_days INT)
+BEGIN
+    SELECT
+        c.id,
+        c.name,
+        c.email,
+        c.phone,
+        SUM(lpb.points) as points,
+        points_to_baht(SUM(lpb.points)) as baht_value,
+        lpb.expiry_date
+    FROM loyalty_point_balances lpb
+    JOIN customers c ON c.id = lpb.customer_id
+    WHERE c.is_active = TRUE
+      AND lpb.points > 0
+      AND lpb.is_expired = FALSE
+      AND lpb.expiry_date > CURDATE()
+      AND lpb.expiry_date <= DATE_ADD(CURDATE(), INTERVAL p_days DAY)
+    GROUP BY c.id, c.name, c.email, c.phone, lpb.expiry_date
+    ORDER BY lpb.expiry_date ASC, c.id ASC;
+END//
+
+DELIMITER ;
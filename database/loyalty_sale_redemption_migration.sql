@@ -0,0 +1,136 @@
+-- Loyalty Redemption at Checkout Migration
+-- Run this after loyalty_tiers_migration.sql
+-- Requirements:
+-- 1. Points redeemed at checkout are stored on the sale itself
+-- 2. Redemption, the discount and the sale commit in one transaction
+-- 3. Points are earned on the net amount after the points discount
+
+USE sck_pos;
+
+-- Record the loyalty discount line on the sale
+ALTER TABLE sales
+    ADD COLUMN loyalty_points_used INT NOT NULL DEFAULT 0 AFTER discount_amount,
+    ADD COLUMN loyalty_discount_amount DECIMAL(10, 2) NOT NULL DEFAULT 0 AFTER loyalty_points_used;
+
+DELIMITER //
+
+-- Redeem points without managing the transaction
+-- The caller owns the transaction so the redemption can commit together with a sale
+CREATE PROCEDURE apply_loyalty_redemption(
+    IN p_customer_id INT,
+    IN p_points_to_redeem INT,
+    IN p_sale_id INT,
+    IN p_baht_amount DECIMAL(10,2),
+    OUT p_transaction_id INT
+)
+BEGIN
+    DECLARE points_available INT DEFAULT 0;
+    DECLARE points_remaining INT DEFAULT 0;
+    DECLARE current_balance_id INT;
+    DECLARE current_balance_points INT;
+    DECLARE points_to_deduct INT;
+    DECLARE done INT DEFAULT FALSE;
+
+    -- Cursor to get available point balances (oldest first, not expired)
+    DECLARE balance_cursor CURSOR FOR
+        SELECT id, points
+        FROM loyalty_point_balances
+        WHERE customer_id = p_customer_id
+          AND points > 0
+          AND expiry_date > CURDATE()
+          AND is_expired = FALSE
+        ORDER BY earned_date ASC
+        FOR UPDATE;
+
+    DECLARE CONTINUE HANDLER FOR NOT FOUND SET done = TRUE;
+
+    -- Check if customer has enough points (locking the balances being spent)
+    SELECT COALESCE(SUM(points), 0) INTO points_available
+    FROM loyalty_point_balances
+    WHERE customer_id = p_customer_id
+      AND points > 0
+      AND expiry_date > CURDATE()
+      AND is_expired = FALSE
+    FOR UPDATE;
+
+    IF points_available < p_points_to_redeem THEN
+        SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'Insufficient loyalty points';
+    END IF;
+
+    -- Record the redemption transaction
+    INSERT INTO loyalty_point_transactions (
+        customer_id,
+        transaction_type,
+        points,
+        sale_id,
+        baht_amount,
+        notes
+    ) VALUES (
+        p_customer_id,
+        'redeemed',
+        -p_points_to_redeem,
+        p_sale_id,
+        p_baht_amount,
+        CONCAT('Points redeemed for ฿', p_baht_amount, ' discount')
+    );
+
+    SET p_transaction_id = LAST_INSERT_ID();
+
+    -- Deduct points from balances (FIFO - oldest first)
+    SET points_remaining = p_points_to_redeem;
+
+    OPEN balance_cursor;
+
+    read_loop: LOOP
+        FETCH balance_cursor INTO current_balance_id, current_balance_points;
+
+        IF done OR points_remaining <= 0 THEN
+            LEAVE read_loop;
+        END IF;
+
+        -- Calculate how many points to deduct from this balance
+        IF current_balance_points >= points_remaining THEN
+            SET points_to_deduct = points_remaining;
+            SET points_remaining = 0;
+        ELSE
+            SET points_to_deduct = current_balance_points;
+            SET points_remaining = points_remaining - current_balance_points;
+        END IF;
+
+        -- Update the balance
+        UPDATE loyalty_point_balances
+        SET points = points - points_to_deduct,
+            updated_at = CURRENT_TIMESTAMP
+        WHERE id = current_balance_id;
+
+    END LOOP;
+
+    CLOSE balance_cursor;
+END//
+
+-- Standalone redemption now delegates to apply_loyalty_redemption
+DROP PROCEDURE IF EXISTS redeem_loyalty_points//
+
+CREATE PROCEDURE redeem_loyalty_points(
+    IN p_customer_id INT,
+    IN p_points_to_redeem INT,
+    IN p_sale_id INT,
+    IN p_baht_amount DECIMAL(10,2)
+)
+BEGIN
+    DECLARE transaction_id INT;
+
+    DECLARE EXIT HANDLER FOR SQLEXCEPTION
+    BEGIN
+        ROLLBACK;
+        RESIGNAL;
+    END;
+
+    START TRANSACTION;
+
+    CALL apply_loyalty_redemption(p_customer_id, p_points_to_redeem, p_sale_id, p_baht_amount, transaction_id);
+
+    COMMIT;
+END//
+
+DELIMITER ;
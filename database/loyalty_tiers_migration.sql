@@ -0,0 +1,250 @@
+-- Loyalty Membership Tiers Migration
+-- Run this after loyalty_points_migration.sql
+-- Requirements:
+-- 1. Customers are placed in Silver, Gold or Platinum based on rolling 12-month spend
+-- 2. Each tier has its own earn multiplier and expiry extension
+-- 3. Tiers are re-evaluated by a scheduled job (upgrades and downgrades)
+-- 4. Every tier change is recorded so customer service can explain it
+
+USE sck_pos;
+
+-- Loyalty Tiers table
+-- Defines tier thresholds and benefits
+CREATE TABLE loyalty_tiers (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    code VARCHAR(20) UNIQUE NOT NULL,
+    name VARCHAR(50) NOT NULL,
+    min_annual_spend DECIMAL(12, 2) NOT NULL, -- rolling 12-month spend required for this tier
+    earn_multiplier DECIMAL(4, 2) NOT NULL DEFAULT 1.00, -- applied to the base 1 point per 100 baht
+    expiry_extension_days INT NOT NULL DEFAULT 0, -- added to the base 180 day expiry
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    INDEX idx_min_spend (min_annual_spend)
+);
+
+INSERT INTO loyalty_tiers (code, name, min_annual_spend, earn_multiplier, expiry_extension_days) VALUES
+('silver', 'Silver', 0.00, 1.00, 0),
+('gold', 'Gold', 20000.00, 1.25, 30),
+('platinum', 'Platinum', 50000.00, 1.50, 90);
+
+-- Track each customer's current tier
+ALTER TABLE customers
+    ADD COLUMN loyalty_tier VARCHAR(20) NOT NULL DEFAULT 'silver' AFTER loyalty_points,
+    ADD COLUMN tier_evaluated_at TIMESTAMP NULL AFTER loyalty_tier,
+    ADD INDEX idx_loyalty_tier (loyalty_tier);
+
+-- Loyalty Tier History table
+-- Records every tier upgrade and downgrade
+CREATE TABLE loyalty_tier_history (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    customer_id INT NOT NULL,
+    previous_tier VARCHAR(20) NOT NULL,
+    new_tier VARCHAR(20) NOT NULL,
+    rolling_spend DECIMAL(12, 2) NOT NULL, -- 12-month spend at the time of evaluation
+    change_type ENUM('upgrade', 'downgrade') NOT NULL,
+    notes TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (customer_id) REFERENCES customers(id) ON DELETE CASCADE,
+    INDEX idx_customer_date (customer_id, created_at)
+);
+
+-- Replace the earning trigger so points honour the customer's tier
+
+DROP TRIGGER IF EXISTS award_loyalty_points_after_sale;
+
+DELIMITER //
+
+CREATE TRIGGER award_loyalty_points_after_sale
+AFTER INSERT ON sales
+FOR EACH ROW
+BEGIN
+    DECLARE points_to_award INT DEFAULT 0;
+    DECLARE expiry_date DATE;
+    DECLARE tier_multiplier DECIMAL(4, 2) DEFAULT 1.00;
+    DECLARE tier_extension_days INT DEFAULT 0;
+
+    -- Only award points if customer is specified and sale is completed
+    IF NEW.customer_id IS NOT NULL AND NEW.payment_status = 'completed' THEN
+        -- Look up the customer's tier benefits (defaults apply if the tier is unknown)
+        SELECT lt.earn_multiplier, lt.expiry_extension_days
+        INTO tier_multiplier, tier_extension_days
+        FROM customers c
+        JOIN loyalty_tiers lt ON lt.code = c.loyalty_tier
+        WHERE c.id = NEW.customer_id;
+
+        -- Calculate points: 1 point per 100 baht (floor division), scaled by tier
+        SET points_to_award = FLOOR(FLOOR(NEW.total_amount / 100) * tier_multiplier);
+
+        -- Set expiry date to 180 days from now plus the tier extension
+        SET expiry_date = DATE_ADD(CURDATE(), INTERVAL 180 + tier_extension_days DAY);
+
+        -- Only proceed if points are greater than 0
+        IF points_to_award > 0 THEN
+            -- Insert transaction record
+            INSERT INTO loyalty_point_transactions (
+                customer_id,
+                transaction_type,
+                points,
+                sale_id,
+                baht_amount,
+                expiry_date,
+                notes
+            ) VALUES (
+                NEW.customer_id,
+                'earned',
+                points_to_award,
+                NEW.id,
+                NEW.total_amount,
+                expiry_date,
+                CONCAT('Points earned from sale #', NEW.receipt_number)
+            );
+
+            -- Insert or update balance record
+            INSERT INTO loyalty_point_balances (
+                customer_id,
+                points,
+                earned_date,
+                expiry_date
+            ) VALUES (
+                NEW.customer_id,
+                points_to_award,
+                CURDATE(),
+                expiry_date
+            ) ON DUPLICATE KEY UPDATE
+                points = points + points_to_award,
+                updated_at = CURRENT_TIMESTAMP;
+
+            -- Update customer's total loyalty points
+            UPDATE customers
+            SET loyalty_points = loyalty_points + points_to_award,
+                updated_at = CURRENT_TIMESTAMP
+            WHERE id = NEW.customer_id;
+        END IF;
+    END IF;
+END//
+
+DELIMITER ;
+
+-- Create stored procedure to re-evaluate every customer's tier
+DELIMITER //
+
+CREATE PROCEDURE evaluate_loyalty_tiers()
+BEGIN
+    DECLARE customer_id_var INT;
+    DECLARE current_tier VARCHAR(20);
+    DECLARE target_tier VARCHAR(20);
+    DECLARE current_rank DECIMAL(12, 2);
+    DECLARE target_rank DECIMAL(12, 2);
+    DECLARE spend DECIMAL(12, 2);
+    DECLARE done INT DEFAULT FALSE;
+
+    -- Cursor over active customers with their rolling 12-month spend
+    DECLARE customer_cursor CURSOR FOR
+        SELECT c.id, c.loyalty_tier, COALESCE(SUM(s.total_amount), 0)
+        FROM customers c
+        LEFT JOIN sales s
+          ON s.customer_id = c.id
+         AND s.payment_status = 'completed'
+         AND s.created_at >= DATE_SUB(NOW(), INTERVAL 12 MONTH)
+        WHERE c.is_active = TRUE
+        GROUP BY c.id, c.loyalty_tier;
+
+    DECLARE CONTINUE HANDLER FOR NOT FOUND SET done = TRUE;
+
+    START TRANSACTION;
+
+    OPEN customer_cursor;
+
+    tier_loop: LOOP
+        FETCH customer_cursor INTO customer_id_var, current_tier, spend;
+
+        IF done THEN
+            LEAVE tier_loop;
+        END IF;
+
+        -- Highest tier whose threshold the customer meets
+        SET target_tier = NULL;
+        SELECT code, min_annual_spend INTO target_tier, target_rank
+        FROM loyalty_tiers
+        WHERE min_annual_spend <= spend
+        ORDER BY min_annual_spend DESC
+        LIMIT 1;
+
+        SET current_rank = NULL;
+        SELECT min_annual_spend INTO current_rank
+        FROM loyalty_tiers
+        WHERE code = current_tier;
+
+        -- The NOT FOUND handler also fires on empty lookups above; reset it
+        SET done = FALSE;
+
+        IF target_tier IS NOT NULL AND target_tier <> current_tier THEN
+            INSERT INTO loyalty_tier_history (
+                customer_id,
+                previous_tier,
+                new_tier,
+                rolling_spend,
+                change_type,
+                notes
+            ) VALUES (
+                customer_id_var,
+                current_tier,
+                target_tier,
+                spend,
+                IF(current_rank IS NULL OR target_rank > current_rank, 'upgrade', 'downgrade'),
+                CONCAT('12-month spend of ฿', spend, ' qualifies for ', target_tier)
+            );
+
+            UPDATE customers
+            SET loyalty_tier = target_tier,
+                tier_evaluated_at = CURRENT_TIMESTAMP,
+                updated_at = CURRENT_TIMESTAMP
+            WHERE id = customer_id_var;
+        ELSE
+            UPDATE customers
+            SET tier_evaluated_at = CURRENT_TIMESTAMP
+            WHERE id = customer_id_var;
+        END IF;
+
+    END LOOP;
+
+    CLOSE customer_cursor;
+
+    COMMIT;
+END//
+
+DELIMITER ;
+
+-- Recreate customer loyalty summary view with tier information
+CREATE OR REPLACE VIEW customer_loyalty_summary AS
+SELECT
+    c.id,
+    c.name,
+    c.email,
+    c.phone,
+    c.loyalty_points as total_points,
+    get_available_loyalty_points(c.id) as available_points,
+    points_to_baht(get_available_loyalty_points(c.id)) as available_baht_value,
+    (
+        SELECT COUNT(*)
+        FROM loyalty_point_transactions lpt
+        WHERE lpt.customer_id = c.id AND lpt.transaction_type = 'earned'
+    ) as total_transactions,
+    (
+        SELECT COALESCE(SUM(baht_amount), 0)
+        FROM loyalty_point_transactions lpt
+        WHERE lpt.customer_id = c.id AND lpt.transaction_type = 'earned'
+    ) as total_spent,
+    c.created_at as member_since,
+    c.loyalty_tier as tier,
+    COALESCE(lt.earn_multiplier, 1.00) as tier_earn_multiplier,
+    (
+        SELECT COALESCE(SUM(s.total_amount), 0)
+        FROM sales s
+        WHERE s.customer_id = c.id
+          AND s.payment_status = 'completed'
+          AND s.created_at >= DATE_SUB(NOW(), INTERVAL 12 MONTH)
+    ) as rolling_12_month_spend
+FROM customers c
+LEFT JOIN loyalty_tiers lt ON lt.code = c.loyalty_tier
+WHERE c.is_active = TRUE;
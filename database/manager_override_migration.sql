@@ -0,0 +1,203 @@
+-- Manager Override Migration
+-- Run this after password_policy_migration.sql
+-- Requirements:
+-- 1. Voids, refunds, price overrides and large discounts by cashiers need a manager's approval
+-- 2. An approval is a short-lived token usable for one action only
+-- 3. Every override records both the requesting cashier and the approving manager
+-- 4. Voided and refunded sales return stock and reverse their loyalty points
+
+USE sck_pos;
+
+-- Voided sales are cancelled the same day; refunds can happen later
+ALTER TABLE sales
+    MODIFY COLUMN payment_status ENUM('pending', 'completed', 'refunded', 'voided') DEFAULT 'completed';
+
+-- Manager Overrides table
+-- One row per approval; used_at is set when a sales endpoint consumes it
+CREATE TABLE manager_overrides (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    action ENUM('void', 'refund', 'price_override', 'discount') NOT NULL,
+    requested_by INT NOT NULL,
+    approved_by INT NOT NULL,
+    approval_method ENUM('pin', 'password') NOT NULL,
+    terminal_id INT NULL,
+    sale_id INT NULL,       -- sale being voided or refunded
+    product_id INT NULL,    -- product whose price is overridden
+    amount DECIMAL(10, 2) NULL, -- approved unit price, or maximum discount
+    reason VARCHAR(255) NOT NULL,
+    token_hash CHAR(64) NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP NULL,
+    used_on_sale_id INT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (requested_by) REFERENCES users(id),
+    FOREIGN KEY (approved_by) REFERENCES users(id),
+    FOREIGN KEY (terminal_id) REFERENCES terminals(id) ON DELETE SET NULL,
+    FOREIGN KEY (sale_id) REFERENCES sales(id) ON DELETE SET NULL,
+    FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE SET NULL,
+    FOREIGN KEY (used_on_sale_id) REFERENCES sales(id) ON DELETE SET NULL,
+    UNIQUE KEY unique_token_hash (token_hash),
+    INDEX idx_requested_by (requested_by, created_at),
+    INDEX idx_approved_by (approved_by, created_at)
+);
+
+DELIMITER //
+
+-- Reverse the loyalty effects of a voided or refunded sale
+-- Takes back the points the sale earned (as far as they are unspent) and returns
+-- any points redeemed on it. No transaction control: runs inside the caller's transaction.
+CREATE PROCEDURE reverse_sale_loyalty(
+    IN p_sale_id INT,
+    IN p_user_id INT
+)
+proc: BEGIN
+    DECLARE v_customer_id INT;
+    DECLARE v_receipt_number VARCHAR(50);
+    DECLARE points_earned INT DEFAULT 0;
+    DECLARE points_redeemed INT DEFAULT 0;
+    DECLARE points_available INT DEFAULT 0;
+    DECLARE points_to_debit INT DEFAULT 0;
+    DECLARE points_remaining INT DEFAULT 0;
+    DECLARE current_balance_id INT;
+    DECLARE current_balance_points INT;
+    DECLARE points_to_deduct INT;
+    DECLARE new_expiry_date DATE;
+    DECLARE done INT DEFAULT FALSE;
+
+    -- Newest balances first so the points this sale earned are taken back first
+    DECLARE balance_cursor CURSOR FOR
+        SELECT id, points
+        FROM loyalty_point_balances
+        WHERE customer_id = v_customer_id
+          AND points > 0
+          AND expiry_date > CURDATE()
+          AND is_expired = FALSE
+        ORDER BY earned_date DESC
+        FOR UPDATE;
+
+    DECLARE CONTINUE HANDLER FOR NOT FOUND SET done = TRUE;
+
+    SELECT customer_id, receipt_number INTO v_customer_id, v_receipt_number
+    FROM sales
+    WHERE id = p_sale_id;
+
+    IF v_customer_id IS NULL THEN
+        LEAVE proc;
+    END IF;
+
+    SELECT
+        COALESCE(SUM(CASE WHEN transaction_type = 'earned' THEN points ELSE 0 END), 0),
+        COALESCE(-SUM(CASE WHEN transaction_type = 'redeemed' THEN points ELSE 0 END), 0)
+    INTO points_earned, points_redeemed
+    FROM loyalty_point_transactions
+    WHERE sale_id = p_sale_id;
+
+    IF points_earned > 0 THEN
+        SELECT COALESCE(SUM(points), 0) INTO points_available
+        FROM loyalty_point_balances
+        WHERE customer_id = v_customer_id
+          AND points > 0
+          AND expiry_date > CURDATE()
+          AND is_expired = FALSE
+        FOR UPDATE;
+
+        -- Points already spent elsewhere cannot be taken back
+        SET points_to_debit = LEAST(points_earned, points_available);
+
+        IF points_to_debit > 0 THEN
+            INSERT INTO loyalty_point_transactions (
+                customer_id,
+                transaction_type,
+                points,
+                sale_id,
+                notes,
+                created_by
+            ) VALUES (
+                v_customer_id,
+                'adjusted',
+                -points_to_debit,
+                p_sale_id,
+                CONCAT('Reversal of points earned on sale #', v_receipt_number),
+                p_user_id
+            );
+
+            SET points_remaining = points_to_debit;
+            SET done = FALSE;
+
+            OPEN balance_cursor;
+
+            read_loop: LOOP
+                FETCH balance_cursor INTO current_balance_id, current_balance_points;
+
+                IF done OR points_remaining <= 0 THEN
+                    LEAVE read_loop;
+                END IF;
+
+                IF current_balance_points >= points_remaining THEN
+                    SET points_to_deduct = points_remaining;
+                    SET points_remaining = 0;
+                ELSE
+                    SET points_to_deduct = current_balance_points;
+                    SET points_remaining = points_remaining - current_balance_points;
+                END IF;
+
+                UPDATE loyalty_point_balances
+                SET points = points - points_to_deduct,
+                    updated_at = CURRENT_TIMESTAMP
+                WHERE id = current_balance_id;
+
+            END LOOP;
+
+            CLOSE balance_cursor;
+
+            UPDATE customers
+            SET loyalty_points = loyalty_points - points_to_debit,
+                updated_at = CURRENT_TIMESTAMP
+            WHERE id = v_customer_id;
+        END IF;
+    END IF;
+
+    IF points_redeemed > 0 THEN
+        -- Returned points get a fresh standard expiry
+        SET new_expiry_date = DATE_ADD(CURDATE(), INTERVAL 180 DAY);
+
+        INSERT INTO loyalty_point_transactions (
+            customer_id,
+            transaction_type,
+            points,
+            sale_id,
+            expiry_date,
+            notes,
+            created_by
+        ) VALUES (
+            v_customer_id,
+            'adjusted',
+            points_redeemed,
+            p_sale_id,
+            new_expiry_date,
+            CONCAT('Points returned from reversed sale #', v_receipt_number),
+            p_user_id
+        );
+
+        INSERT INTO loyalty_point_balances (
+            customer_id,
+            points,
+            earned_date,
+            expiry_date
+        ) VALUES (
+            v_customer_id,
+            points_redeemed,
+            CURDATE(),
+            new_expiry_date
+        ) ON DUPLICATE KEY UPDATE
+            points = points + points_redeemed,
+            updated_at = CURRENT_TIMESTAMP;
+
+        UPDATE customers
+        SET loyalty_points = loyalty_points + points_redeemed,
+            updated_at = CURRENT_TIMESTAMP
+        WHERE id = v_customer_id;
+    END IF;
+END//
+
+DELIMITER ;
@@ -0,0 +1,65 @@
+-- Offline Sync Migration
+-- Run this after terminal_registration_migration.sql
+-- Requirements:
+-- 1. Terminals upload sales made while offline, each identified by a client-generated UUID
+-- 2. Uploading the same sale twice records it once
+-- 3. Stock, price and loyalty problems found during sync are kept for a manager to review
+-- 4. Terminals pull catalog changes, including deletions, since their last sync
+
+USE sck_pos;
+
+-- Offline sales keep the terminal's UUID and the time they reached the server;
+-- created_at is when the sale was rung up
+ALTER TABLE sales
+    ADD COLUMN client_uuid CHAR(36) NULL AFTER receipt_number,
+    ADD COLUMN synced_at TIMESTAMP NULL AFTER created_at,
+    ADD UNIQUE INDEX idx_client_uuid (client_uuid);
+
+-- Problems found while recording an offline sale; the sale is kept as rung up
+CREATE TABLE sync_conflicts (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    sale_id INT NOT NULL,
+    terminal_id INT NOT NULL,
+    conflict_type ENUM('negative_stock', 'price_mismatch', 'insufficient_points', 'customer_not_found', 'discount_override') NOT NULL,
+    product_id INT NULL,
+    details VARCHAR(255) NOT NULL,
+    resolved_at TIMESTAMP NULL,
+    resolved_by INT NULL,
+    resolution_notes VARCHAR(255) NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (sale_id) REFERENCES sales(id),
+    FOREIGN KEY (terminal_id) REFERENCES terminals(id),
+    FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE SET NULL,
+    FOREIGN KEY (resolved_by) REFERENCES users(id) ON DELETE SET NULL,
+    INDEX idx_resolved_created (resolved_at, created_at)
+);
+
+-- Catalog deltas are read in updated_at order
+ALTER TABLE products ADD INDEX idx_updated (updated_at, id);
+ALTER TABLE categories ADD INDEX idx_updated (updated_at, id);
+
+-- Hard deletes leave no row to sync, so record them
+CREATE TABLE catalog_deletions (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    entity_type ENUM('product', 'category') NOT NULL,
+    entity_id INT NOT NULL,
+    deleted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+DELIMITER //
+
+CREATE TRIGGER record_product_deletion
+AFTER DELETE ON products
+FOR EACH ROW
+BEGIN
+    INSERT INTO catalog_deletions (entity_type, entity_id) VALUES ('product', OLD.id);
+END//
+
+CREATE TRIGGER record_category_deletion
+AFTER DELETE ON categories
+FOR EACH ROW
+BEGIN
+    INSERT INTO catalog_deletions (entity_type, entity_id) VALUES ('category', OLD.id);
+END//
+
+DELIMITER ;
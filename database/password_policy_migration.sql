@@ -0,0 +1,27 @@
+-- Password Policy Migration
+-- Run this after two_factor_migration.sql
+-- Requirements:
+-- 1. Users can be forced to change their password at next login
+-- 2. Recent passwords are kept so they cannot be reused
+-- 3. The seeded admin account must replace its default password
+
+USE sck_pos;
+
+-- Forced rotation
+ALTER TABLE users
+    ADD COLUMN must_change_password BOOLEAN NOT NULL DEFAULT FALSE AFTER password_hash,
+    ADD COLUMN password_changed_at TIMESTAMP NULL AFTER must_change_password;
+
+-- Password History table
+-- Previous bcrypt hashes, newest kept up to PASSWORD_HISTORY entries
+CREATE TABLE password_history (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    user_id INT NOT NULL,
+    password_hash VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    INDEX idx_user (user_id, id)
+);
+
+-- The default admin password is published in the README
+UPDATE users SET must_change_password = TRUE WHERE username = 'admin';
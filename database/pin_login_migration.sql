@@ -0,0 +1,37 @@
+-- Cashier PIN Login Migration
+-- Run this after sessions_migration.sql
+-- Requirements:
+-- 1. Each user may have a 4-6 digit PIN, stored as a bcrypt hash
+-- 2. PIN login only works from a registered terminal and issues a register-scoped token
+-- 3. Repeated PIN failures lock the PIN temporarily
+
+USE sck_pos;
+
+-- Terminals table
+-- Physical tills enrolled with a device secret
+CREATE TABLE terminals (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    store_id INT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    device_secret_hash CHAR(64) NOT NULL, -- SHA-256 of the device secret; the secret is shown once at enrollment
+    is_active BOOLEAN DEFAULT TRUE,
+    last_seen_at TIMESTAMP NULL,
+    created_by INT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (store_id) REFERENCES stores(id),
+    FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL,
+    INDEX idx_store (store_id)
+);
+
+-- PIN credentials and lockout tracking
+ALTER TABLE users
+    ADD COLUMN pin_hash VARCHAR(255) NULL AFTER password_hash,
+    ADD COLUMN pin_failed_attempts INT NOT NULL DEFAULT 0 AFTER pin_hash,
+    ADD COLUMN pin_locked_until TIMESTAMP NULL AFTER pin_failed_attempts;
+
+-- Sessions started at a till are bound to that terminal
+ALTER TABLE user_sessions
+    ADD COLUMN terminal_id INT NULL AFTER user_id,
+    ADD CONSTRAINT fk_sessions_terminal FOREIGN KEY (terminal_id) REFERENCES terminals(id) ON DELETE CASCADE,
+    ADD INDEX idx_terminal (terminal_id);
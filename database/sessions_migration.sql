@@ -0,0 +1,37 @@
+-- Sessions and Refresh Tokens Migration
+-- Run this after user_invites_migration.sql
+-- Requirements:
+-- 1. Access tokens are short-lived and tied to a session
+-- 2. Refresh tokens rotate on every use and are stored hashed
+-- 3. Sessions can be revoked individually (logout) or all at once per user
+
+USE sck_pos;
+
+-- User Sessions table
+-- One row per login; access tokens carry the session id
+CREATE TABLE user_sessions (
+    id CHAR(32) PRIMARY KEY, -- random session id embedded in tokens as "sid"
+    user_id INT NOT NULL,
+    user_agent VARCHAR(255),
+    ip_address VARCHAR(45),
+    revoked_at TIMESTAMP NULL,
+    revoked_reason VARCHAR(100),
+    last_used_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    INDEX idx_user (user_id)
+);
+
+-- Refresh Tokens table
+-- Each refresh returns a new token; reusing a spent token revokes the session
+CREATE TABLE refresh_tokens (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    session_id CHAR(32) NOT NULL,
+    token_hash CHAR(64) UNIQUE NOT NULL, -- SHA-256 of the refresh token
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (session_id) REFERENCES user_sessions(id) ON DELETE CASCADE,
+    INDEX idx_session (session_id),
+    INDEX idx_expires (expires_at)
+);
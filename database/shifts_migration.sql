@@ -0,0 +1,85 @@
+-- Cashier Shifts Migration
+-- Run this after audit_trail_migration.sql
+-- Requirements:
+-- 1. A cashier opens a shift on a register with an opening float and closes it with counted cash
+-- 2. Cash drops, pay-outs and cash refunds are recorded against the open shift
+-- 3. Expected cash comes from payment_details cash tenders; the variance is kept at close
+-- 4. X reports read a shift at any time; Z reports close the day for a register
+
+USE sck_pos;
+
+-- Z Reports table
+-- End-of-day totals for a register; sequence_number never repeats per terminal
+CREATE TABLE z_reports (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    store_id INT NOT NULL,
+    terminal_id INT NOT NULL,
+    sequence_number INT NOT NULL,
+    business_date DATE NOT NULL,
+    shift_count INT NOT NULL,
+    net_sales DECIMAL(12, 2) NOT NULL,
+    expected_cash DECIMAL(12, 2) NOT NULL,
+    counted_cash DECIMAL(12, 2) NOT NULL,
+    variance DECIMAL(12, 2) NOT NULL,
+    report_data MEDIUMTEXT NOT NULL, -- full report as JSON
+    created_by INT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (store_id) REFERENCES stores(id),
+    FOREIGN KEY (terminal_id) REFERENCES terminals(id),
+    FOREIGN KEY (created_by) REFERENCES users(id),
+    UNIQUE KEY unique_terminal_sequence (terminal_id, sequence_number),
+    INDEX idx_store_date (store_id, business_date)
+);
+
+-- Shifts table
+-- The generated open_* columns allow one open shift per user and per register
+CREATE TABLE shifts (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    store_id INT NOT NULL,
+    terminal_id INT NOT NULL,
+    user_id INT NOT NULL,
+    status ENUM('open', 'closed') NOT NULL DEFAULT 'open',
+    opening_float DECIMAL(10, 2) NOT NULL,
+    opened_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    closed_at TIMESTAMP NULL,
+    closed_by INT NULL,
+    expected_cash DECIMAL(12, 2) NULL,
+    counted_cash DECIMAL(12, 2) NULL,
+    variance DECIMAL(12, 2) NULL, -- counted minus expected; negative is short
+    notes TEXT,
+    z_report_id INT NULL,
+    open_user_id INT AS (IF(status = 'open', user_id, NULL)) STORED,
+    open_terminal_id INT AS (IF(status = 'open', terminal_id, NULL)) STORED,
+    FOREIGN KEY (store_id) REFERENCES stores(id),
+    FOREIGN KEY (terminal_id) REFERENCES terminals(id),
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (closed_by) REFERENCES users(id),
+    FOREIGN KEY (z_report_id) REFERENCES z_reports(id),
+    UNIQUE KEY unique_open_user (open_user_id),
+    UNIQUE KEY unique_open_terminal (open_terminal_id),
+    INDEX idx_terminal_status (terminal_id, status),
+    INDEX idx_user_date (user_id, opened_at)
+);
+
+-- Shift Cash Movements table
+-- Cash taken out of (drop, payout, refund) the drawer during a shift
+CREATE TABLE shift_cash_movements (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    shift_id INT NOT NULL,
+    movement_type ENUM('drop', 'payout', 'refund') NOT NULL,
+    amount DECIMAL(10, 2) NOT NULL,
+    reason VARCHAR(255) NOT NULL,
+    sale_id INT NULL, -- refunded or voided sale
+    created_by INT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (shift_id) REFERENCES shifts(id),
+    FOREIGN KEY (sale_id) REFERENCES sales(id) ON DELETE SET NULL,
+    FOREIGN KEY (created_by) REFERENCES users(id),
+    INDEX idx_shift (shift_id)
+);
+
+-- Sales are counted in the shift that took them
+ALTER TABLE sales
+    ADD COLUMN shift_id INT NULL AFTER user_id,
+    ADD CONSTRAINT fk_sales_shift FOREIGN KEY (shift_id) REFERENCES shifts(id),
+    ADD INDEX idx_shift (shift_id);
@@ -0,0 +1,26 @@
+-- Terminal Registration Migration
+-- Run this after shifts_migration.sql
+-- Requirements:
+-- 1. Every sale records the till it was rung up on
+-- 2. Admins can disable a lost or stolen terminal remotely and see who did it and why
+
+USE sck_pos;
+
+-- Remote disable details; is_active stays the switch that AuthRequired checks
+ALTER TABLE terminals
+    ADD COLUMN disabled_at TIMESTAMP NULL AFTER last_seen_at,
+    ADD COLUMN disabled_by INT NULL AFTER disabled_at,
+    ADD COLUMN disabled_reason VARCHAR(255) NULL AFTER disabled_by,
+    ADD CONSTRAINT fk_terminals_disabled_by FOREIGN KEY (disabled_by) REFERENCES users(id) ON DELETE SET NULL;
+
+-- Sales rung up at a till; NULL for back-office sales
+ALTER TABLE sales
+    ADD COLUMN terminal_id INT NULL AFTER store_id,
+    ADD CONSTRAINT fk_sales_terminal FOREIGN KEY (terminal_id) REFERENCES terminals(id),
+    ADD INDEX idx_terminal_date (terminal_id, created_at);
+
+-- Sales already linked to a shift took place at the shift's register
+UPDATE sales s
+JOIN shifts sh ON sh.id = s.shift_id
+SET s.terminal_id = sh.terminal_id
+WHERE s.terminal_id IS NULL;
@@ -0,0 +1,46 @@
+-- Two-Factor Authentication Migration
+-- Run this after login_throttle_migration.sql
+-- Requirements:
+-- 1. Users can enroll a TOTP authenticator and receive single-use recovery codes
+-- 2. Password login for an enrolled user returns a challenge that needs a code
+-- 3. Sessions record whether the second factor was verified (mandatory for admins)
+
+USE sck_pos;
+
+-- TOTP enrollment
+ALTER TABLE users
+    ADD COLUMN totp_secret VARCHAR(64) NULL AFTER pin_locked_until, -- base32; set at setup, used once enabled
+    ADD COLUMN totp_enabled BOOLEAN NOT NULL DEFAULT FALSE AFTER totp_secret,
+    ADD COLUMN totp_enabled_at TIMESTAMP NULL AFTER totp_enabled,
+    ADD COLUMN totp_last_step BIGINT NOT NULL DEFAULT 0 AFTER totp_enabled_at; -- last accepted time step, blocks code replay
+
+-- Recovery Codes table
+-- Single-use codes for when the authenticator is lost
+CREATE TABLE user_recovery_codes (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    user_id INT NOT NULL,
+    code_hash CHAR(64) NOT NULL, -- SHA-256 of the code
+    used_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    UNIQUE KEY unique_code_hash (code_hash),
+    INDEX idx_user (user_id)
+);
+
+-- Login Challenges table
+-- Short-lived tokens handed out after the password step
+CREATE TABLE login_challenges (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    user_id INT NOT NULL,
+    token_hash CHAR(64) NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    UNIQUE KEY unique_token_hash (token_hash)
+);
+
+-- Whether the session passed the second factor
+ALTER TABLE user_sessions
+    ADD COLUMN mfa_verified BOOLEAN NOT NULL DEFAULT FALSE AFTER terminal_id;
@@ -0,0 +1,33 @@
+-- User Invites Migration
+-- Run this after authorization_migration.sql
+-- Requirements:
+-- 1. Public registration requires a one-time invite code (or an admin token)
+-- 2. Invites carry a preset role and store assignment and expire
+-- 3. Role escalation is impossible from the public endpoint
+
+USE sck_pos;
+
+-- Assign users to a store
+ALTER TABLE users
+    ADD COLUMN store_id INT NULL AFTER role,
+    ADD CONSTRAINT fk_users_store FOREIGN KEY (store_id) REFERENCES stores(id) ON DELETE SET NULL;
+
+-- User Invites table
+-- One-time registration codes created by admins
+CREATE TABLE user_invites (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    code_hash CHAR(64) UNIQUE NOT NULL, -- SHA-256 of the invite code; the code itself is never stored
+    role ENUM('admin', 'manager', 'cashier') NOT NULL DEFAULT 'cashier',
+    store_id INT,
+    email VARCHAR(100), -- optional: restrict the invite to this email
+    created_by INT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP NULL,
+    used_by INT NULL,
+    revoked_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (store_id) REFERENCES stores(id) ON DELETE SET NULL,
+    FOREIGN KEY (created_by) REFERENCES users(id),
+    FOREIGN KEY (used_by) REFERENCES users(id) ON DELETE SET NULL,
+    INDEX idx_expires (expires_at)
+);
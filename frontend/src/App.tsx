@@ -6,10 +6,15 @@ import Layout from './components/Layout';
 import Dashboard from './components/Dashboard';
 import POS from './components/POS';
 import CustomerManagement from './components/CustomerManagement';
+import ChangePassword from './components/ChangePassword';
 
 // Protected Route component
-const ProtectedRoute: React.FC<{ children: React.ReactNode }> = ({ children }) => {
-  const { user, loading } = useAuth();
+// Users on a temporary password are sent to change it first.
+const ProtectedRoute: React.FC<{ children: React.ReactNode; allowPasswordChange?: boolean }> = ({
+  children,
+  allowPasswordChange = false,
+}) => {
+  const { user, loading, passwordChangeRequired } = useAuth();
 
   if (loading) {
     return (
@@ -19,7 +24,13 @@ const ProtectedRoute: React.FC<{ children: React.ReactNode }> = ({ children }) =
     );
   }
 
-  return user ? <>{children}</> : <Navigate to="/login" />;
+  if (!user) {
+    return <Navigate to="/login" />;
+  }
+  if (passwordChangeRequired && !allowPasswordChange) {
+    return <Navigate to="/change-password" />;
+  }
+  return <>{children}</>;
 };
 
 // Placeholder components for routes not yet implemented
@@ -46,6 +57,14 @@ function App() {
         <div className="App">
           <Routes>
             <Route path="/login" element={<Login />} />
+            <Route
+              path="/change-password"
+              element={
+                <ProtectedRoute allowPasswordChange>
+                  <ChangePassword />
+                </ProtectedRoute>
+              }
+            />
             <Route
               path="/"
               element={
@@ -0,0 +1,161 @@
+import React, { useState } from 'react';
+import { useNavigate } from 'react-router-dom';
+import { useAuth } from '../context/AuthContext';
+import { Lock, Store } from 'lucide-react';
+
+const inputClass =
+  'appearance-none block w-full px-3 py-2 border border-gray-300 rounded-md placeholder-gray-400 focus:outline-none focus:ring-primary-500 focus:border-primary-500 sm:text-sm';
+
+const ChangePassword: React.FC = () => {
+  const [currentPassword, setCurrentPassword] = useState('');
+  const [newPassword, setNewPassword] = useState('');
+  const [confirmPassword, setConfirmPassword] = useState('');
+  const [error, setError] = useState('');
+  const [violations, setViolations] = useState<string[]>([]);
+  const [loading, setLoading] = useState(false);
+
+  const { passwordChangeRequired, changePassword, logout } = useAuth();
+  const navigate = useNavigate();
+
+  const handleSubmit = async (e: React.FormEvent) => {
+    e.preventDefault();
+    setError('');
+    setViolations([]);
+
+    if (newPassword !== confirmPassword) {
+      setError('New passwords do not match');
+      return;
+    }
+
+    setLoading(true);
+    try {
+      await changePassword(currentPassword, newPassword);
+      navigate('/dashboard');
+    } catch (err: any) {
+      setError(err.response?.data?.error || 'Failed to change password. Please try again.');
+      setViolations(err.response?.data?.violations || []);
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  const handleLogout = () => {
+    logout();
+    navigate('/login');
+  };
+
+  return (
+    <div className="min-h-screen bg-gray-50 flex flex-col justify-center py-12 sm:px-6 lg:px-8">
+      <div className="sm:mx-auto sm:w-full sm:max-w-md">
+        <div className="flex justify-center">
+          <div className="flex items-center space-x-2">
+            <Store className="h-12 w-12 text-primary-600" />
+            <h1 className="text-3xl font-bold text-gray-900">SCK POS</h1>
+          </div>
+        </div>
+        <h2 className="mt-6 text-center text-3xl font-extrabold text-gray-900">
+          Change your password
+        </h2>
+        {passwordChangeRequired && (
+          <p className="mt-2 text-center text-sm text-gray-600">
+            You are signed in with a temporary password. Choose a new one to continue.
+          </p>
+        )}
+      </div>
+
+      <div className="mt-8 sm:mx-auto sm:w-full sm:max-w-md">
+        <div className="bg-white py-8 px-4 shadow sm:rounded-lg sm:px-10">
+          <form className="space-y-6" onSubmit={handleSubmit}>
+            {error && (
+              <div className="bg-red-50 border border-red-200 text-red-600 px-4 py-3 rounded-md text-sm">
+                {error}
+                {violations.length > 0 && (
+                  <ul className="mt-2 list-disc list-inside">
+                    {violations.map((violation) => (
+                      <li key={violation}>Password {violation}</li>
+                    ))}
+                  </ul>
+                )}
+              </div>
+            )}
+
+            <div>
+              <label htmlFor="current_password" className="block text-sm font-medium text-gray-700">
+                Current password
+              </label>
+              <div className="mt-1">
+                <input
+                  id="current_password"
+                  name="current_password"
+                  type="password"
+                  autoComplete="current-password"
+                  required
+                  value={currentPassword}
+                  onChange={(e) => setCurrentPassword(e.target.value)}
+                  className={inputClass}
+                />
+              </div>
+            </div>
+
+            <div>
+              <label htmlFor="new_password" className="block text-sm font-medium text-gray-700">
+                New password
+              </label>
+              <div className="mt-1">
+                <input
+                  id="new_password"
+                  name="new_password"
+                  type="password"
+                  autoComplete="new-password"
+                  required
+                  value={newPassword}
+                  onChange={(e) => setNewPassword(e.target.value)}
+                  className={inputClass}
+                />
+              </div>
+            </div>
+
+            <div>
+              <label htmlFor="confirm_password" className="block text-sm font-medium text-gray-700">
+                Confirm new password
+              </label>
+              <div className="mt-1">
+                <input
+                  id="confirm_password"
+                  name="confirm_password"
+                  type="password"
+                  autoComplete="new-password"
+                  required
+                  value={confirmPassword}
+                  onChange={(e) => setConfirmPassword(e.target.value)}
+                  className={inputClass}
+                />
+              </div>
+            </div>
+
+            <div>
+              <button
+                type="submit"
+                disabled={loading}
+                className="group relative w-full flex justify-center py-2 px-4 border border-transparent text-sm font-medium rounded-md text-white bg-primary-600 hover:bg-primary-700 focus:outline-none focus:ring-2 focus:ring-offset-2 focus:ring-primary-500 disabled:opacity-50 disabled:cursor-not-allowed"
+              >
+                <span className="absolute left-0 inset-y-0 flex items-center pl-3">
+                  <Lock className="h-5 w-5 text-primary-500 group-hover:text-primary-400" />
+                </span>
+                {loading ? 'Saving...' : 'Change password'}
+              </button>
+            </div>
+          </form>
+
+          <div className="mt-6 text-center">
+            <button type="button" onClick={handleLogout} className="text-sm text-gray-600 hover:text-gray-900">
+              Sign out
+            </button>
+          </div>
+        </div>
+      </div>
+    </div>
+  );
+};
+
+export default ChangePassword;
@@ -1,11 +1,17 @@
-import React, { useState, useEffect } from 'react';
-import { User, Plus, Edit, Trash2, Search, Star, Gift, Calendar, Phone, Mail } from 'lucide-react';
+import React, { useState, useEffect, useRef } from 'react';
+import { User, Plus, Edit, Trash2, Search, Star, Gift, Calendar, Phone, Mail, ChevronLeft, ChevronRight } from 'lucide-react';
 import { Customer, CustomerLoyaltySummary } from '../types';
 import * as api from '../services/api';
 
+const PAGE_SIZE = 20;
+
 const CustomerManagement: React.FC = () => {
   const [customers, setCustomers] = useState<Customer[]>([]);
   const [searchTerm, setSearchTerm] = useState('');
+  const [query, setQuery] = useState('');
+  const [page, setPage] = useState(1);
+  const [total, setTotal] = useState(0);
+  const latestRequest = useRef(0);
   const [loading, setLoading] = useState(true);
   const [showAddModal, setShowAddModal] = useState(false);
   const [showEditModal, setShowEditModal] = useState(false);
@@ -16,32 +22,50 @@ const CustomerManagement: React.FC = () => {
     name: '',
     email: '',
     phone: '',
-    address: ''
+    address: '',
+    tax_id: ''
   });
 
+  // Search on the server once typing pauses, starting again from the first page
+  useEffect(() => {
+    const timer = setTimeout(() => {
+      setQuery(searchTerm.trim());
+      setPage(1);
+    }, 300);
+    return () => clearTimeout(timer);
+  }, [searchTerm]);
+
   useEffect(() => {
     loadCustomers();
-  }, []);
+  }, [query, page]);
 
   const loadCustomers = async () => {
+    // Only the newest request may update the list, so a slow search cannot overwrite a later one
+    const request = ++latestRequest.current;
     try {
       setLoading(true);
-      const customerList = await api.getCustomers();
-      setCustomers(Array.isArray(customerList) ? customerList : []);
+      const result = await api.getCustomers({ q: query || undefined, page, page_size: PAGE_SIZE });
+      if (request !== latestRequest.current) return;
+      setCustomers(Array.isArray(result.customers) ? result.customers : []);
+      setTotal(result.total);
     } catch (error) {
+      if (request !== latestRequest.current) return;
       console.error('Failed to load customers:', error);
       setCustomers([]);
+      setTotal(0);
     } finally {
-      setLoading(false);
+      if (request === latestRequest.current) setLoading(false);
     }
   };
 
+  const totalPages = Math.max(1, Math.ceil(total / PAGE_SIZE));
+
   const handleAddCustomer = async (e: React.FormEvent) => {
     e.preventDefault();
     try {
       await api.createCustomer(formData);
       setShowAddModal(false);
-      setFormData({ name: '', email: '', phone: '', address: '' });
+      setFormData({ name: '', email: '', phone: '', address: '', tax_id: '' });
       loadCustomers();
     } catch (error) {
       console.error('Failed to create customer:', error);
@@ -56,7 +80,7 @@ const CustomerManagement: React.FC = () => {
       await api.updateCustomer(selectedCustomer.id, formData);
       setShowEditModal(false);
       setSelectedCustomer(null);
-      setFormData({ name: '', email: '', phone: '', address: '' });
+      setFormData({ name: '', email: '', phone: '', address: '', tax_id: '' });
       loadCustomers();
     } catch (error) {
       console.error('Failed to update customer:', error);
@@ -91,17 +115,12 @@ const CustomerManagement: React.FC = () => {
       name: customer.name,
       email: customer.email || '',
       phone: customer.phone || '',
-      address: customer.address || ''
+      address: customer.address || '',
+      tax_id: customer.tax_id || ''
     });
     setShowEditModal(true);
   };
 
-  const filteredCustomers = (customers || []).filter(customer =>
-    customer.name.toLowerCase().includes(searchTerm.toLowerCase()) ||
-    customer.email?.toLowerCase().includes(searchTerm.toLowerCase()) ||
-    customer.phone?.includes(searchTerm)
-  );
-
   return (
     <div className="p-6">
       {/* Header */}
@@ -143,7 +162,7 @@ const CustomerManagement: React.FC = () => {
             <User className="h-8 w-8 text-blue-600" />
             <div className="ml-3">
               <p className="text-sm font-medium text-gray-600">Total Customers</p>
-              <p className="text-2xl font-bold text-gray-900">{customers.length}</p>
+              <p className="text-2xl font-bold text-gray-900">{total.toLocaleString()}</p>
             </div>
           </div>
         </div>
@@ -151,7 +170,7 @@ const CustomerManagement: React.FC = () => {
           <div className="flex items-center">
             <Star className="h-8 w-8 text-yellow-600" />
             <div className="ml-3">
-              <p className="text-sm font-medium text-gray-600">With Loyalty Points</p>
+              <p className="text-sm font-medium text-gray-600">With Loyalty Points (this page)</p>
               <p className="text-2xl font-bold text-gray-900">
                 {customers.filter(c => c.loyalty_points > 0).length}
               </p>
@@ -162,7 +181,7 @@ const CustomerManagement: React.FC = () => {
           <div className="flex items-center">
             <Gift className="h-8 w-8 text-green-600" />
             <div className="ml-3">
-              <p className="text-sm font-medium text-gray-600">Total Points</p>
+              <p className="text-sm font-medium text-gray-600">Total Points (this page)</p>
               <p className="text-2xl font-bold text-gray-900">
                 {customers.reduce((sum, c) => sum + c.loyalty_points, 0).toLocaleString()}
               </p>
@@ -213,7 +232,7 @@ const CustomerManagement: React.FC = () => {
                 </tr>
               </thead>
               <tbody className="bg-white divide-y divide-gray-200">
-                {filteredCustomers.map((customer) => (
+                {customers.map((customer) => (
                   <tr key={customer.id} className="hover:bg-gray-50">
                     <td className="px-6 py-4 whitespace-nowrap">
                       <div className="flex items-center">
@@ -297,7 +316,7 @@ const CustomerManagement: React.FC = () => {
               </tbody>
             </table>
             
-            {filteredCustomers.length === 0 && !loading && (
+            {customers.length === 0 && !loading && (
               <div className="p-8 text-center">
                 <User className="h-12 w-12 text-gray-400 mx-auto mb-4" />
                 <p className="text-gray-600">No customers found</p>
@@ -305,6 +324,35 @@ const CustomerManagement: React.FC = () => {
             )}
           </div>
         )}
+
+        {total > 0 && (
+          <div className="flex items-center justify-between px-6 py-3 border-t border-gray-200 text-sm text-gray-600">
+            <span>
+              {(page - 1) * PAGE_SIZE + 1}–{Math.min(page * PAGE_SIZE, total)} of {total.toLocaleString()} customers
+            </span>
+            <div className="flex items-center gap-2">
+              <button
+                onClick={() => setPage(page - 1)}
+                disabled={page <= 1 || loading}
+                className="p-1 rounded hover:bg-gray-100 disabled:opacity-50 disabled:cursor-not-allowed"
+                title="Previous page"
+              >
+                <ChevronLeft className="h-4 w-4" />
+              </button>
+              <span>
+                Page {page} of {totalPages}
+              </span>
+              <button
+                onClick={() => setPage(page + 1)}
+                disabled={page >= totalPages || loading}
+                className="p-1 rounded hover:bg-gray-100 disabled:opacity-50 disabled:cursor-not-allowed"
+                title="Next page"
+              >
+                <ChevronRight className="h-4 w-4" />
+              </button>
+            </div>
+          </div>
+        )}
       </div>
 
       {/* Add Customer Modal */}
@@ -359,13 +407,25 @@ const CustomerManagement: React.FC = () => {
                     className="w-full px-3 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-blue-500 focus:border-transparent"
                   />
                 </div>
+                <div>
+                  <label className="block text-sm font-medium text-gray-700 mb-1">
+                    National ID / Tax ID
+                  </label>
+                  <input
+                    type="text"
+                    inputMode="numeric"
+                    value={formData.tax_id}
+                    onChange={(e) => setFormData({ ...formData, tax_id: e.target.value })}
+                    className="w-full px-3 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-blue-500 focus:border-transparent"
+                  />
+                </div>
               </div>
               <div className="flex gap-3 mt-6">
                 <button
                   type="button"
                   onClick={() => {
                     setShowAddModal(false);
-                    setFormData({ name: '', email: '', phone: '', address: '' });
+                    setFormData({ name: '', email: '', phone: '', address: '', tax_id: '' });
                   }}
                   className="flex-1 px-4 py-2 border border-gray-300 rounded-lg text-gray-700 hover:bg-gray-50"
                 >
@@ -435,6 +495,18 @@ const CustomerManagement: React.FC = () => {
                     className="w-full px-3 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-blue-500 focus:border-transparent"
                   />
                 </div>
+                <div>
+                  <label className="block text-sm font-medium text-gray-700 mb-1">
+                    National ID / Tax ID
+                  </label>
+                  <input
+                    type="text"
+                    inputMode="numeric"
+                    value={formData.tax_id}
+                    onChange={(e) => setFormData({ ...formData, tax_id: e.target.value })}
+                    className="w-full px-3 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-blue-500 focus:border-transparent"
+                  />
+                </div>
               </div>
               <div className="flex gap-3 mt-6">
                 <button
@@ -442,7 +514,7 @@ const CustomerManagement: React.FC = () => {
                   onClick={() => {
                     setShowEditModal(false);
                     setSelectedCustomer(null);
-                    setFormData({ name: '', email: '', phone: '', address: '' });
+                    setFormData({ name: '', email: '', phone: '', address: '', tax_id: '' });
                   }}
                   className="flex-1 px-4 py-2 border border-gray-300 rounded-lg text-gray-700 hover:bg-gray-50"
                 >
@@ -1,4 +1,4 @@
-import React, { useState, useEffect } from 'react';
+import React, { useState, useEffect, useRef } from 'react';
 import { Search, Plus, Minus, Trash2, ShoppingCart, DollarSign, X, User, Gift, Star } from 'lucide-react';
 import { Product, CartItem, Cart, Customer, CustomerLoyaltySummary, CreateSale } from '../types';
 import * as api from '../services/api';
@@ -16,6 +16,8 @@ const THAI_DENOMINATIONS = [
   { value: 1, label: '฿1', color: 'bg-gray-50 border-gray-200 text-gray-700' },
 ];
 
+const CUSTOMER_PAGE_SIZE = 20;
+
 const POS: React.FC = () => {
   const [products, setProducts] = useState<Product[]>([]);
   const [searchTerm, setSearchTerm] = useState('');
@@ -35,10 +37,17 @@ const POS: React.FC = () => {
   const [selectedCustomer, setSelectedCustomer] = useState<Customer | null>(null);
   const [customerSearch, setCustomerSearch] = useState('');
   const [customers, setCustomers] = useState<Customer[]>([]);
+  const [customerPage, setCustomerPage] = useState(1);
+  const [customerTotal, setCustomerTotal] = useState(0);
+  const latestCustomerRequest = useRef(0);
   const [showCustomerModal, setShowCustomerModal] = useState(false);
   const [loyaltySummary, setLoyaltySummary] = useState<CustomerLoyaltySummary | null>(null);
   const [loyaltyPointsToUse, setLoyaltyPointsToUse] = useState(0);
   const [loyaltyDiscount, setLoyaltyDiscount] = useState(0);
+  // Group prices for the selected customer, by product ID
+  const [customerPrices, setCustomerPrices] = useState<{[productId: number]: number}>({});
+  // The customer prices are wanted for; a slow response for an earlier customer is dropped
+  const pricesCustomerId = useRef<number | null>(null);
 
   useEffect(() => {
     loadProducts();
@@ -46,7 +55,19 @@ const POS: React.FC = () => {
 
   useEffect(() => {
     calculateTotals();
-  }, [cart.items, loyaltyDiscount]);
+  }, [cart.items, loyaltyDiscount, customerPrices]);
+
+  // Search customers on the server once typing pauses in the picker
+  useEffect(() => {
+    if (!showCustomerModal) return;
+    const timer = setTimeout(() => loadCustomers(1), 300);
+    return () => clearTimeout(timer);
+  }, [customerSearch, showCustomerModal]);
+
+  const cartProductIds = cart.items.map(item => item.product.id).join(',');
+  useEffect(() => {
+    loadCustomerPrices();
+  }, [selectedCustomer, cartProductIds]);
 
   const loadProducts = async () => {
     try {
@@ -109,8 +130,33 @@ const POS: React.FC = () => {
     }
   };
 
+  // Customers in a group pay the group's price
+  const loadCustomerPrices = async () => {
+    const customerId = selectedCustomer?.id ?? null;
+    if (pricesCustomerId.current !== customerId) {
+      // Never show the previous customer's prices while the new ones load
+      setCustomerPrices({});
+      pricesCustomerId.current = customerId;
+    }
+    if (customerId === null || cart.items.length === 0) {
+      setCustomerPrices({});
+      return;
+    }
+    try {
+      const { prices } = await api.getCustomerPrices(customerId, cart.items.map(item => item.product.id));
+      if (pricesCustomerId.current !== customerId) return;
+      setCustomerPrices(Object.fromEntries(prices.map(price => [price.product_id, price.unit_price])));
+    } catch (error) {
+      if (pricesCustomerId.current !== customerId) return;
+      console.error('Failed to load customer prices:', error);
+      setCustomerPrices({});
+    }
+  };
+
+  const unitPrice = (item: CartItem) => customerPrices[item.product.id] ?? item.product.price;
+
   const calculateTotals = () => {
-    const subtotal = cart.items.reduce((sum, item) => sum + (item.product.price * item.quantity), 0);
+    const subtotal = cart.items.reduce((sum, item) => sum + (unitPrice(item) * item.quantity - item.discount), 0);
     const tax_rate = 0.08; // 8% tax
     const tax_amount = subtotal * tax_rate;
     const total = subtotal + tax_amount - cart.discount_amount - loyaltyDiscount;
@@ -183,13 +229,27 @@ const POS: React.FC = () => {
   };
 
   // Customer and Loyalty Functions
-  const loadCustomers = async () => {
+  // Page 1 replaces the list and later pages add to it; only the newest request may update it
+  const loadCustomers = async (page: number) => {
+    const request = ++latestCustomerRequest.current;
     try {
-      const customerList = await api.getCustomers();
-      setCustomers(Array.isArray(customerList) ? customerList : []);
+      const result = await api.getCustomers({
+        q: customerSearch.trim() || undefined,
+        page,
+        page_size: CUSTOMER_PAGE_SIZE,
+      });
+      if (request !== latestCustomerRequest.current) return;
+      const customerList = Array.isArray(result.customers) ? result.customers : [];
+      setCustomers(prev => (page === 1 ? customerList : [...prev, ...customerList]));
+      setCustomerPage(page);
+      setCustomerTotal(result.total);
     } catch (error) {
+      if (request !== latestCustomerRequest.current) return;
       console.error('Failed to load customers:', error);
-      setCustomers([]); // Ensure customers is always an array
+      if (page === 1) {
+        setCustomers([]); // Ensure customers is always an array
+        setCustomerTotal(0);
+      }
     }
   };
 
@@ -289,16 +349,7 @@ const POS: React.FC = () => {
     }
 
     try {
-      // Redeem loyalty points if any
-      if (loyaltyPointsToUse > 0 && selectedCustomer) {
-        await api.redeemLoyaltyPoints({
-          customer_id: selectedCustomer.id,
-          points_to_redeem: loyaltyPointsToUse,
-          baht_amount: loyaltyDiscount
-        });
-      }
-
-      // Create sale transaction
+      // Create sale transaction (loyalty points are redeemed as part of the sale)
       const saleData: CreateSale = {
         customer_id: selectedCustomer?.id,
         subtotal: cart.subtotal,
@@ -313,9 +364,9 @@ const POS: React.FC = () => {
           product_id: item.product.id,
           product_name: item.product.name,
           quantity: item.quantity,
-          unit_price: item.product.price,
+          unit_price: unitPrice(item),
           discount_amount: item.discount,
-          subtotal: item.product.price * item.quantity - item.discount
+          subtotal: unitPrice(item) * item.quantity - item.discount
         }))
       };
 
@@ -446,7 +497,12 @@ const POS: React.FC = () => {
                 <div key={item.product.id} className="flex items-center justify-between p-3 bg-gray-50 rounded-lg">
                   <div className="flex-1">
                     <h4 className="text-sm font-medium text-gray-900">{item.product.name}</h4>
-                    <p className="text-sm text-gray-500">฿{item.product.price.toFixed(2)} each</p>
+                    <p className="text-sm text-gray-500">
+                      ฿{unitPrice(item).toFixed(2)} each
+                      {unitPrice(item) !== item.product.price && (
+                        <span className="ml-1 line-through">฿{item.product.price.toFixed(2)}</span>
+                      )}
+                    </p>
                   </div>
                   <div className="flex items-center space-x-2">
                     <button
@@ -481,10 +537,7 @@ const POS: React.FC = () => {
             <div className="flex items-center justify-between mb-3">
               <h3 className="text-sm font-medium text-gray-700">Customer</h3>
               <button
-                onClick={() => {
-                  loadCustomers();
-                  setShowCustomerModal(true);
-                }}
+                onClick={() => setShowCustomerModal(true)}
                 className="text-blue-600 hover:text-blue-800 text-sm font-medium"
               >
                 {selectedCustomer ? 'Change' : 'Select Customer'}
@@ -734,7 +787,7 @@ const POS: React.FC = () => {
               <Search className="absolute left-3 top-1/2 transform -translate-y-1/2 h-4 w-4 text-gray-400" />
               <input
                 type="text"
-                placeholder="Search customers..."
+                placeholder="Search by name, email or phone..."
                 value={customerSearch}
                 onChange={(e) => setCustomerSearch(e.target.value)}
                 className="w-full pl-10 pr-4 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-blue-500 focus:border-transparent"
@@ -744,11 +797,6 @@ const POS: React.FC = () => {
             {/* Customer List */}
             <div className="space-y-2 max-h-60 overflow-y-auto">
               {(customers || [])
-                .filter(customer => 
-                  customer.name.toLowerCase().includes(customerSearch.toLowerCase()) ||
-                  customer.email?.toLowerCase().includes(customerSearch.toLowerCase()) ||
-                  customer.phone?.includes(customerSearch)
-                )
                 .map(customer => (
                   <button
                     key={customer.id}
@@ -774,6 +822,15 @@ const POS: React.FC = () => {
                   No customers found
                 </div>
               )}
+
+              {customers.length < customerTotal && (
+                <button
+                  onClick={() => loadCustomers(customerPage + 1)}
+                  className="w-full py-2 text-sm font-medium text-blue-600 hover:text-blue-800"
+                >
+                  Show more ({customerTotal - customers.length} left)
+                </button>
+              )}
             </div>
 
             {/* Action Buttons */}
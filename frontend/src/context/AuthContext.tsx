@@ -1,12 +1,17 @@
 import React, { createContext, useContext, useState, useEffect, ReactNode, useMemo } from 'react';
-import { User } from '../types';
+import { LoginResponse, User } from '../types';
 import * as authAPI from '../services/api';
 
 interface AuthContextType {
   user: User | null;
   token: string | null;
-  login: (username: string, password: string) => Promise<void>;
+  // Resolves to a challenge token when a two-factor code is still needed
+  login: (username: string, password: string) => Promise<string | null>;
+  verifyMFA: (challengeToken: string, code: string) => Promise<void>;
   logout: () => void;
+  // Set while the user is on a temporary password
+  passwordChangeRequired: boolean;
+  changePassword: (currentPassword: string, newPassword: string) => Promise<void>;
   loading: boolean;
 }
 
@@ -19,6 +24,7 @@ interface AuthProviderProps {
 export const AuthProvider: React.FC<AuthProviderProps> = ({ children }) => {
   const [user, setUser] = useState<User | null>(null);
   const [token, setToken] = useState<string | null>(null);
+  const [passwordChangeRequired, setPasswordChangeRequired] = useState(false);
   const [loading, setLoading] = useState(true);
 
   useEffect(() => {
@@ -29,42 +35,85 @@ export const AuthProvider: React.FC<AuthProviderProps> = ({ children }) => {
     if (storedToken && storedUser) {
       setToken(storedToken);
       setUser(JSON.parse(storedUser));
+      setPasswordChangeRequired(localStorage.getItem('pos_password_change_required') === 'true');
     }
     
     setLoading(false);
   }, []);
 
+  const startSession = (response: LoginResponse) => {
+    const { token: newToken, user: newUser } = response;
+
+    setToken(newToken);
+    setUser(newUser);
+
+    // Store in localStorage
+    localStorage.setItem('pos_token', newToken);
+    localStorage.setItem('pos_refresh_token', response.refresh_token);
+    localStorage.setItem('pos_user', JSON.stringify(newUser));
+
+    setPasswordChangeRequired(!!response.password_change_required);
+    if (response.password_change_required) {
+      localStorage.setItem('pos_password_change_required', 'true');
+    } else {
+      localStorage.removeItem('pos_password_change_required');
+    }
+  };
+
   const login = async (username: string, password: string) => {
     try {
       const response = await authAPI.login(username, password);
-      const { token: newToken, user: newUser } = response;
-      
-      setToken(newToken);
-      setUser(newUser);
-      
-      // Store in localStorage
-      localStorage.setItem('pos_token', newToken);
-      localStorage.setItem('pos_user', JSON.stringify(newUser));
+      if ('mfa_required' in response) {
+        return response.challenge_token;
+      }
+      startSession(response);
+      return null;
     } catch (error) {
       console.error('Login failed:', error);
       throw error;
     }
   };
 
+  const verifyMFA = async (challengeToken: string, code: string) => {
+    try {
+      startSession(await authAPI.verifyMFA(challengeToken, code));
+    } catch (error) {
+      console.error('Two-factor verification failed:', error);
+      throw error;
+    }
+  };
+
+  const changePassword = async (currentPassword: string, newPassword: string) => {
+    await authAPI.changePassword(currentPassword, newPassword);
+    setPasswordChangeRequired(false);
+    localStorage.removeItem('pos_password_change_required');
+  };
+
   const logout = () => {
+    // Revoke the session server-side; clear local state regardless of the outcome
+    const currentToken = localStorage.getItem('pos_token');
+    if (currentToken) {
+      authAPI.logout(currentToken).catch((error) => console.error('Logout failed:', error));
+    }
     setUser(null);
     setToken(null);
     localStorage.removeItem('pos_token');
+    localStorage.removeItem('pos_refresh_token');
     localStorage.removeItem('pos_user');
+    localStorage.removeItem('pos_password_change_required');
+    setPasswordChangeRequired(false);
   };
 
   const value = useMemo(() => ({
     user,
     token,
     login,
+    verifyMFA,
     logout,
+    passwordChangeRequired,
+    changePassword,
     loading,
-  }), [user, token, loading]);
+  }), [user, token, passwordChangeRequired, loading]);
 
   return (
     <AuthContext.Provider value={value}>
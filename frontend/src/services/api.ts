@@ -1,10 +1,13 @@
 import axios from 'axios';
 import { 
   LoginResponse, 
+  MFAChallengeResponse,
   User, 
   Product, 
   Category, 
-  Customer, 
+  Customer,
+  CustomerPage, 
+  CustomerPrices,
   Store, 
   Sale,
   CreateSale,
@@ -36,25 +39,75 @@ api.interceptors.request.use((config) => {
   return config;
 });
 
-// Handle token expiration
+// Share one in-flight refresh between concurrent 401s
+let refreshPromise: Promise<string> | null = null;
+
+const refreshAccessToken = async (): Promise<string> => {
+  const refreshToken = localStorage.getItem('pos_refresh_token');
+  if (!refreshToken) {
+    throw new Error('No refresh token');
+  }
+  const response = await axios.post<LoginResponse>(`${API_BASE_URL}/auth/refresh`, { refresh_token: refreshToken });
+  localStorage.setItem('pos_token', response.data.token);
+  localStorage.setItem('pos_refresh_token', response.data.refresh_token);
+  return response.data.token;
+};
+
+// Handle token expiration: try one refresh, then fall back to the login page
 api.interceptors.response.use(
   (response) => response,
-  (error) => {
+  async (error) => {
+    const original = error.config;
+    if (error.response?.status === 401 && original && !original._retry && !original.url?.startsWith('/auth/')) {
+      original._retry = true;
+      try {
+        refreshPromise = refreshPromise || refreshAccessToken();
+        const token = await refreshPromise;
+        original.headers.Authorization = `Bearer ${token}`;
+        return api(original);
+      } catch {
+        // fall through to logout
+      } finally {
+        refreshPromise = null;
+      }
+    }
     if (error.response?.status === 401) {
       localStorage.removeItem('pos_token');
+      localStorage.removeItem('pos_refresh_token');
       localStorage.removeItem('pos_user');
+      localStorage.removeItem('pos_password_change_required');
       window.location.href = '/login';
     }
+    // A temporary password must be replaced before anything else works
+    if (error.response?.status === 403 && error.response.data?.code === 'password_change_required') {
+      localStorage.setItem('pos_password_change_required', 'true');
+      if (window.location.pathname !== '/change-password') {
+        window.location.href = '/change-password';
+      }
+    }
     return Promise.reject(error);
   }
 );
 
 // Authentication API
-export const login = async (username: string, password: string): Promise<LoginResponse> => {
+export const login = async (username: string, password: string): Promise<LoginResponse | MFAChallengeResponse> => {
   const response = await api.post('/auth/login', { username, password });
   return response.data;
 };
 
+export const verifyMFA = async (challengeToken: string, code: string): Promise<LoginResponse> => {
+  const response = await api.post('/auth/2fa/verify', { challenge_token: challengeToken, code });
+  return response.data;
+};
+
+export const logout = async (token: string): Promise<void> => {
+  await api.post('/auth/logout', null, { headers: { Authorization: `Bearer ${token}` } });
+};
+
+export const changePassword = async (currentPassword: string, newPassword: string): Promise<void> => {
+  await api.post('/auth/change-password', { current_password: currentPassword, new_password: newPassword });
+};
+
 export const register = async (userData: {
   username: string;
   email: string;
@@ -147,8 +200,10 @@ export const deleteCategory = async (id: number): Promise<void> => {
 };
 
 // Customer API
-export const getCustomers = async (): Promise<Customer[]> => {
-  const response = await api.get('/customers');
+export const getCustomers = async (
+  params: { q?: string; page?: number; page_size?: number } = {}
+): Promise<CustomerPage> => {
+  const response = await api.get('/customers', { params });
   return response.data;
 };
 
@@ -157,6 +212,13 @@ export const getCustomer = async (id: number): Promise<Customer> => {
   return response.data;
 };
 
+export const getCustomerPrices = async (id: number, productIds: number[]): Promise<CustomerPrices> => {
+  const response = await api.get(`/customers/${id}/prices`, {
+    params: { product_ids: productIds.join(',') },
+  });
+  return response.data;
+};
+
 export const createCustomer = async (customerData: Partial<Customer>): Promise<Customer> => {
   const response = await api.post('/customers', customerData);
   return response.data;
@@ -5,6 +5,7 @@ export interface User {
   email: string;
   full_name: string;
   role: 'admin' | 'manager' | 'cashier';
+  store_id?: number;
   is_active: boolean;
 }
 
@@ -43,7 +44,10 @@ export interface Customer {
   name: string;
   email?: string;
   phone?: string;
+  phone_normalized?: string;
   address?: string;
+  tax_id?: string;
+  customer_group_id?: number | null;
   loyalty_points: number;
   available_points?: number;
   available_baht_value?: number;
@@ -52,16 +56,48 @@ export interface Customer {
   updated_at: string;
 }
 
+export interface CustomerPage {
+  customers: Customer[];
+  page: number;
+  page_size: number;
+  total: number;
+}
+
+// Customer group pricing types
+export interface CustomerGroup {
+  id: number;
+  code: string;
+  name: string;
+  discount_percent: number;
+  is_active: boolean;
+  created_at: string;
+  updated_at: string;
+}
+
+export interface ItemPrice {
+  product_id: number;
+  list_price: number;
+  unit_price: number;
+  source: 'list' | 'price_list' | 'group_discount';
+}
+
+export interface CustomerPrices {
+  customer_id: number;
+  customer_group: CustomerGroup | null;
+  prices: ItemPrice[];
+}
+
 // Loyalty Points types
 export interface LoyaltyPointTransaction {
   id: number;
   customer_id: number;
-  transaction_type: 'earned' | 'redeemed' | 'expired';
+  transaction_type: 'earned' | 'redeemed' | 'expired' | 'adjusted' | 'bonus';
   points: number;
   sale_id?: number;
   baht_amount?: number;
   expiry_date?: string;
   notes?: string;
+  created_by?: number;
   created_at: string;
 }
 
@@ -87,6 +123,9 @@ export interface CustomerLoyaltySummary {
   total_transactions: number;
   total_spent: number;
   member_since: string;
+  tier: 'silver' | 'gold' | 'platinum';
+  tier_earn_multiplier: number;
+  rolling_12_month_spend: number;
 }
 
 export interface LoyaltyRedemption {
@@ -181,7 +220,18 @@ export interface Cart {
 // API Response types
 export interface LoginResponse {
   token: string;
+  refresh_token: string;
+  expires_in: number;
   user: User;
+  mfa_enrollment_required?: boolean;
+  password_change_required?: boolean;
+}
+
+// Returned by login instead of tokens when the user has two-factor enabled
+export interface MFAChallengeResponse {
+  mfa_required: true;
+  challenge_token: string;
+  expires_in: number;
 }
 
 export interface ApiResponse<T> {